@@ -1,3 +1,10 @@
 module decompress
 
-go 1.21 
\ No newline at end of file
+go 1.21
+
+require (
+	github.com/andybalholm/brotli v1.1.1
+	logger v0.0.0
+)
+
+replace logger => ../logger
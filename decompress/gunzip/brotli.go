@@ -0,0 +1,67 @@
+package gunzip
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// isBrotliFile reports whether a path names a Brotli-compressed file
+func isBrotliFile(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".br")
+}
+
+// brotliDecompress decompresses a .br file into the output directory,
+// following the same steps as simpleDecompress
+func brotliDecompress(ctx context.Context, brFile string, inputHash io.Writer) error {
+	outputFile, err := outputPath(brFile)
+	if err != nil {
+		return err
+	}
+
+	// Check if already decompressed
+	if isAlreadyDecompressed(brFile) {
+		slog.Info("skipping file, already decompressed", "file", filepath.Base(brFile), "output", filepath.Base(outputFile))
+		return nil
+	}
+
+	// Open the brotli file
+	file, err := os.Open(brFile)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+	input := teeInput(file, inputHash)
+
+	// Ensure output directory exists
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %v", err)
+	}
+
+	output, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	defer output.Close()
+
+	bytesWritten, err := copyToOutput(output, contextReader{ctx, brotli.NewReader(input)})
+	if ctx.Err() != nil {
+		removePartialOutput(output, outputFile)
+		return ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to copy data: %v", err)
+	}
+	if err := drainInput(input, inputHash); err != nil {
+		return fmt.Errorf("failed to hash input: %v", err)
+	}
+
+	slog.Info("decompressed file", "bytes", bytesWritten, "output", outputFile)
+	return nil
+}
@@ -0,0 +1,44 @@
+package gunzip
+
+import (
+	"bufio"
+	"io"
+)
+
+// bufferSize, when set by -buffer-size, replaces the built-in sizes of the
+// buffers compressed files are read through and outputs are written through.
+// Zero keeps each loop's built-in size.
+var bufferSize int
+
+// minBufferSize is the smallest -buffer-size accepted
+const minBufferSize = 4 * 1024 // 4KB
+
+// readBuffer returns a buffer of bufferSize bytes, or defaultSize if unset
+func readBuffer(defaultSize int) []byte {
+	if bufferSize > 0 {
+		return make([]byte, bufferSize)
+	}
+	return make([]byte, defaultSize)
+}
+
+// newInputReader buffers a compressed input, through bufferSize bytes when set
+func newInputReader(r io.Reader) *bufio.Reader {
+	if bufferSize > 0 {
+		return bufio.NewReaderSize(r, bufferSize)
+	}
+	return bufio.NewReader(r)
+}
+
+// copyToOutput copies src to an output file, in chunks of bufferSize when set
+func copyToOutput(output io.Writer, src io.Reader) (int64, error) {
+	if bufferSize == 0 {
+		return io.Copy(output, src)
+	}
+	// The bufio.Writer reads src straight into its buffer
+	buffered := bufio.NewWriterSize(output, bufferSize)
+	written, err := io.Copy(buffered, src)
+	if flushErr := buffered.Flush(); err == nil {
+		err = flushErr
+	}
+	return written, err
+}
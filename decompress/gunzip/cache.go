@@ -0,0 +1,135 @@
+package gunzip
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+)
+
+// decompressCacheFile maps the SHA-256 of each input to the output it produced
+const decompressCacheFile = "decompress-cache.json"
+
+// cacheEntry records the output decompressed from one input content. Input,
+// Size and ModTime describe the file last seen with that content, so an
+// unchanged file is recognised without reading it again.
+type cacheEntry struct {
+	Output  string    `json:"output"`
+	Valid   bool      `json:"valid"`             // output was complete and valid JSON
+	Trailer string    `json:"trailer,omitempty"` // outcome of the gzip trailer checks
+	Input   string    `json:"input"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// decompressCache is the decompress-cache.json contents, keyed by input SHA-256
+type decompressCache map[string]cacheEntry
+
+// loadDecompressCache reads the cache, returning an empty one if there is none
+func loadDecompressCache() (decompressCache, error) {
+	cache := make(decompressCache)
+	data, err := os.ReadFile(decompressCacheFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cache, nil
+		}
+		return nil, err
+	}
+	if len(data) == 0 {
+		return cache, nil
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+// save writes the cache through a temporary file, so an interrupted run
+// cannot leave it truncated
+func (c decompressCache) save() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := decompressCacheFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, decompressCacheFile)
+}
+
+// knownHash returns the hash of path without reading it when the cache saw
+// the file last with the same size and modification time, or else by hashing
+// it if some cached input has the same size and the content could be a
+// renamed or touched copy. An empty hash means the content is new; it is then
+// hashed while it is decompressed.
+func (c decompressCache) knownHash(path string, info os.FileInfo) (string, error) {
+	sameSize := false
+	for hash, entry := range c {
+		if entry.Input == path && entry.Size == info.Size() && entry.ModTime.Equal(info.ModTime()) {
+			return hash, nil
+		}
+		if entry.Size == info.Size() {
+			sameSize = true
+		}
+	}
+	if !sameSize {
+		return "", nil
+	}
+	return hashFile(path)
+}
+
+// hasPath reports whether any entry was last seen at path
+func (c decompressCache) hasPath(path string) bool {
+	for _, entry := range c {
+		if entry.Input == path {
+			return true
+		}
+	}
+	return false
+}
+
+// record stores the output of the input at path, dropping the entry the
+// path had for older content
+func (c decompressCache) record(hash, path string, info os.FileInfo, output string, valid bool, trailer string) {
+	for oldHash, entry := range c {
+		if entry.Input == path && oldHash != hash {
+			delete(c, oldHash)
+		}
+	}
+	c[hash] = cacheEntry{Output: output, Valid: valid, Trailer: trailer, Input: path, Size: info.Size(), ModTime: info.ModTime()}
+}
+
+// hashFile returns the hex SHA-256 of a file
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// teeInput returns in, copying everything read from it to inputHash when set
+func teeInput(in io.Reader, inputHash io.Writer) io.Reader {
+	if inputHash == nil {
+		return in
+	}
+	return io.TeeReader(in, inputHash)
+}
+
+// drainInput reads the rest of in, so a hash fed by teeInput covers bytes the
+// decompressor did not need, such as trailing padding
+func drainInput(in io.Reader, inputHash io.Writer) error {
+	if inputHash == nil {
+		return nil
+	}
+	_, err := io.Copy(io.Discard, in)
+	return err
+}
@@ -0,0 +1,31 @@
+package gunzip
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// contextReader fails reads with the context's error once it is cancelled, so
+// io.Copy and io.ReadAll stop at the next chunk
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// removePartialOutput closes and deletes an output file left incomplete by a
+// cancelled decompression, so a later run does not skip it as already done
+func removePartialOutput(output *os.File, outputFile string) {
+	output.Close()
+	if err := os.Remove(outputFile); err != nil && !os.IsNotExist(err) {
+		slog.Warn("could not remove partial output", "file", outputFile, "error", err)
+	}
+}
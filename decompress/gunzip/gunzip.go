@@ -0,0 +1,753 @@
+package gunzip
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"logger"
+)
+
+// robustDecompress handles corrupted gzip files by reading as much as possible.
+// Cancelling ctx removes the partial output and returns ctx.Err(). When
+// inputHash is set, the compressed input is written to it as it is read.
+func robustDecompress(ctx context.Context, gzipFile string, inputHash io.Writer) error {
+	outputFile, err := outputPath(gzipFile)
+	if err != nil {
+		return err
+	}
+
+	// Check if already decompressed
+	if isAlreadyDecompressed(gzipFile) {
+		slog.Info("skipping file, already decompressed", "file", filepath.Base(gzipFile), "output", filepath.Base(outputFile))
+		return nil
+	}
+
+	// Open the gzip file
+	file, err := os.Open(gzipFile)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+	input := teeInput(file, inputHash)
+
+	// Create gzip reader
+	gzipReader, err := gzip.NewReader(input)
+	if err != nil {
+		return fmt.Errorf("failed to create gzip reader: %v", err)
+	}
+	// Don't defer close - we'll handle errors manually
+
+	// Ensure output directory exists
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		gzipReader.Close()
+		return fmt.Errorf("failed to create output directory: %v", err)
+	}
+
+	output, err := os.Create(outputFile)
+	if err != nil {
+		gzipReader.Close()
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	defer output.Close()
+
+	// Read in chunks and handle errors gracefully
+	buffer := readBuffer(8192)
+	totalBytes := 0
+	chunkCount := 0
+
+	for {
+		if err := ctx.Err(); err != nil {
+			gzipReader.Close()
+			removePartialOutput(output, outputFile)
+			return err
+		}
+
+		n, err := gzipReader.Read(buffer)
+		if n > 0 {
+			_, writeErr := output.Write(buffer[:n])
+			if writeErr != nil {
+				gzipReader.Close()
+				return fmt.Errorf("failed to write to output: %v", writeErr)
+			}
+			totalBytes += n
+			chunkCount++
+
+			// Progress updates
+			if chunkCount%1000 == 0 {
+				slog.Debug("decompression progress", "chunks", chunkCount, "bytes", totalBytes)
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// If we get an error but have read some data, try to close gracefully
+			if totalBytes > 0 {
+				slog.Warn("error during decompression, saving partial output", "file", filepath.Base(gzipFile), "bytes", totalBytes, "error", err)
+
+				// Try to close the reader - ignore close errors
+				closeErr := gzipReader.Close()
+				if closeErr != nil {
+					slog.Warn("gzip reader close error (ignored)", "file", filepath.Base(gzipFile), "error", closeErr)
+				}
+
+				preserveModTime(outputFile, gzipReader.Header)
+				slog.Info("saved partial decompression", "bytes", totalBytes, "output", outputFile)
+				return nil
+			}
+			gzipReader.Close()
+			return fmt.Errorf("error reading gzip: %v", err)
+		}
+	}
+
+	// Try to close the reader
+	closeErr := gzipReader.Close()
+	if closeErr != nil {
+		slog.Warn("gzip reader close error (but decompression succeeded)", "file", filepath.Base(gzipFile), "error", closeErr)
+	}
+	if err := drainInput(input, inputHash); err != nil {
+		return fmt.Errorf("failed to hash input: %v", err)
+	}
+
+	preserveModTime(outputFile, gzipReader.Header)
+
+	slog.Info("decompressed file", "bytes", totalBytes, "output", outputFile)
+	return nil
+}
+
+// useGzipName names outputs after the gzip header's original file name and
+// copies the header's modification time onto them
+var useGzipName bool
+
+// outputPath returns the file gzipFile decompresses to: the base name of the
+// gzip header name when useGzipName is set and the header has one, else the
+// basename without its .gz or .br extension. A header name that would escape
+// the output directory is an error rather than being silently shortened.
+func outputPath(gzipFile string) (string, error) {
+	if shared, ok := sharedOutputs[gzipFile]; ok {
+		return shared.path, shared.err
+	}
+	if isBrotliFile(gzipFile) {
+		return safeOutputPath(outputDir, filepath.Base(strings.TrimSuffix(gzipFile, ".br")))
+	}
+
+	name := filepath.Base(strings.TrimSuffix(gzipFile, ".gz"))
+
+	if useGzipName {
+		if file, err := os.Open(gzipFile); err == nil {
+			headerName := ""
+			if gzipReader, err := gzip.NewReader(file); err == nil {
+				headerName = gzipReader.Header.Name
+				gzipReader.Close()
+			}
+			file.Close()
+
+			if headerName != "" {
+				if _, err := safeOutputPath(outputDir, headerName); err != nil {
+					return "", fmt.Errorf("gzip header: %v", err)
+				}
+				// Only the base name is used, keeping output/ flat
+				name = filepath.Base(strings.ReplaceAll(headerName, `\`, "/"))
+			}
+		}
+	}
+
+	return safeOutputPath(outputDir, name)
+}
+
+// preserveModTime sets the output's modification time from the gzip header
+// when useGzipName is set and the header carries one
+func preserveModTime(outputFile string, header gzip.Header) {
+	if !useGzipName || header.ModTime.IsZero() {
+		return
+	}
+	if err := os.Chtimes(outputFile, header.ModTime, header.ModTime); err != nil {
+		slog.Warn("could not set modification time from gzip header", "file", outputFile, "error", err)
+	}
+}
+
+// hasOutput reports whether an output file exists and is not empty
+func hasOutput(outputFile string) bool {
+	info, err := os.Stat(outputFile)
+	return err == nil && info.Size() > 0
+}
+
+// isAlreadyDecompressed checks if a gzip file has already been decompressed
+func isAlreadyDecompressed(gzipFile string) bool {
+	outputFile, err := outputPath(gzipFile)
+	if err != nil {
+		return false
+	}
+
+	// Check if output file exists
+	if _, err := os.Stat(outputFile); os.IsNotExist(err) {
+		return false
+	}
+
+	// Check if output file is not empty
+	if info, err := os.Stat(outputFile); err == nil && info.Size() > 0 {
+		return true
+	}
+
+	return false
+}
+
+// simpleDecompress uses the most basic approach possible, checking every gzip
+// trailer on the way. It returns the outcome of the trailer checks: one of the
+// trailer constants, or "" when the trailers were not reached.
+// Cancelling ctx removes the partial output and returns ctx.Err(). When
+// inputHash is set, the compressed input is written to it as it is read.
+func simpleDecompress(ctx context.Context, gzipFile string, inputHash io.Writer) (string, error) {
+	outputFile, err := outputPath(gzipFile)
+	if err != nil {
+		return "", err
+	}
+
+	// Check if already decompressed
+	if isAlreadyDecompressed(gzipFile) {
+		slog.Info("skipping file, already decompressed", "file", filepath.Base(gzipFile), "output", filepath.Base(outputFile))
+		return "", nil
+	}
+
+	// Open the gzip file
+	file, err := os.Open(gzipFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+	input := teeInput(file, inputHash)
+
+	// Create gzip reader
+	gzipReader, err := newCheckedGzipReader(input)
+	if err != nil {
+		return "", fmt.Errorf("failed to create gzip reader: %v", err)
+	}
+	// Don't defer close here - we'll close it manually after reading
+
+	// Ensure output directory exists
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		gzipReader.Close()
+		return "", fmt.Errorf("failed to create output directory: %v", err)
+	}
+
+	output, err := os.Create(outputFile)
+	if err != nil {
+		gzipReader.Close()
+		return "", fmt.Errorf("failed to create output file: %v", err)
+	}
+	defer output.Close()
+
+	// Copy data - this is the key part
+	bytesWritten, err := copyToOutput(output, contextReader{ctx, gzipReader})
+	if ctx.Err() != nil {
+		gzipReader.Close()
+		removePartialOutput(output, outputFile)
+		return "", ctx.Err()
+	}
+	if errors.Is(err, errCRCMismatch) {
+		gzipReader.Close()
+		return trailerCRCMismatch, err
+	}
+	if err != nil {
+		gzipReader.Close()
+		return "", fmt.Errorf("failed to copy data: %v", err)
+	}
+
+	// Close the gzip reader AFTER copying
+	err = gzipReader.Close()
+	if err != nil {
+		return "", fmt.Errorf("gzip reader close error: %v", err)
+	}
+	if err := drainInput(input, inputHash); err != nil {
+		return "", fmt.Errorf("failed to hash input: %v", err)
+	}
+
+	preserveModTime(outputFile, gzipReader.Header)
+
+	slog.Info("decompressed file", "bytes", bytesWritten, "members", gzipReader.members, "output", outputFile)
+	return gzipReader.status(), nil
+}
+
+// readGzippedJSON reads a gzipped JSON file and validates the JSON structure
+func readGzippedJSON(ctx context.Context, filename string) ([]byte, error) {
+	// Open the gzip file
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	// Create gzip reader
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gzip reader: %v", err)
+	}
+	defer gzipReader.Close()
+
+	// Read all decompressed data
+	data, err := io.ReadAll(contextReader{ctx, gzipReader})
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("unexpected EOF - gzip file may be corrupted or incomplete: %v", err)
+		}
+		return nil, fmt.Errorf("failed to read decompressed data: %v", err)
+	}
+
+	// Verify the gzip reader closed properly
+	if err := gzipReader.Close(); err != nil {
+		return nil, fmt.Errorf("gzip reader close error (file may be corrupted): %v", err)
+	}
+
+	// Validate that it's valid JSON
+	if len(data) > 0 {
+		var jsonTest interface{}
+		if err := json.Unmarshal(data, &jsonTest); err != nil {
+			return nil, fmt.Errorf("decompressed data is not valid JSON: %v", err)
+		}
+		slog.Debug("valid JSON structure detected", "file", filename)
+	}
+
+	return data, nil
+}
+
+// decompressGzipToFile decompresses a gzip file to a new file.
+// Cancelling ctx removes the partial output and returns ctx.Err().
+func decompressGzipToFile(ctx context.Context, gzipFile, outputFile string) error {
+	if err := withinDir(outputDir, outputFile); err != nil {
+		return fmt.Errorf("refusing to write output: %v", err)
+	}
+
+	// Open the gzip file
+	file, err := os.Open(gzipFile)
+	if err != nil {
+		return fmt.Errorf("failed to open gzip file: %v", err)
+	}
+	defer file.Close()
+
+	// Create gzip reader
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("failed to create gzip reader: %v", err)
+	}
+	defer gzipReader.Close()
+
+	// Create output file
+	output, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	defer output.Close()
+
+	// Copy decompressed data to output file
+	bytesWritten, err := copyToOutput(output, contextReader{ctx, gzipReader})
+	if ctx.Err() != nil {
+		removePartialOutput(output, outputFile)
+		return ctx.Err()
+	}
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("unexpected EOF during decompression - file may be corrupted: %v", err)
+		}
+		return fmt.Errorf("failed to write decompressed data: %v", err)
+	}
+
+	// Verify the gzip reader close properly
+	if err := gzipReader.Close(); err != nil {
+		return fmt.Errorf("gzip reader close error (file may be corrupted): %v", err)
+	}
+
+	slog.Info("wrote decompressed file", "bytes", bytesWritten, "output", outputFile)
+	return nil
+}
+
+// processGzipStream processes a gzip file as a stream (good for large files),
+// stopping with ctx.Err() if ctx is cancelled
+func processGzipStream(ctx context.Context, filename string) error {
+	// Open the gzip file
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	// Create gzip reader
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("failed to create gzip reader: %v", err)
+	}
+	defer gzipReader.Close()
+
+	// Process the stream in chunks
+	buffer := readBuffer(4096) // 4KB chunks by default
+	totalBytes := 0
+	chunkCount := 0
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := gzipReader.Read(buffer)
+		if n > 0 {
+			totalBytes += n
+			chunkCount++
+
+			// Process the chunk here (example: just count bytes)
+			// In a real application, you might parse JSON, search for patterns, etc.
+			if chunkCount%1000 == 0 {
+				slog.Debug("stream progress", "chunks", chunkCount, "bytes", totalBytes)
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return fmt.Errorf("unexpected EOF during stream processing - file may be corrupted: %v", err)
+			}
+			return fmt.Errorf("error reading stream: %v", err)
+		}
+	}
+
+	// Verify the gzip reader close properly
+	if err := gzipReader.Close(); err != nil {
+		return fmt.Errorf("gzip reader close error (file may be corrupted): %v", err)
+	}
+
+	slog.Info("stream processing complete", "chunks", chunkCount, "bytes", totalBytes)
+	return nil
+}
+
+// Main runs the decompressor on the command-line arguments args; name is
+// the program name shown in its usage message
+func Main(name string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	var logConfig logger.Config
+	logConfig.RegisterFlags(fs)
+	quiet := fs.Bool("quiet", false, "suppress the terminal progress display")
+	force := fs.Bool("force", false, "decompress every file again, ignoring existing outputs and "+decompressCacheFile)
+	validateOnly := fs.Bool("validate-only", false, "only check that every file decompresses to valid JSON, counting valid, partial and invalid files; nothing is written")
+	fs.IntVar(&bufferSize, "buffer-size", 0, "size in bytes of the buffers inputs are read through and outputs written through (0 = built-in sizes of 4-32KB)")
+	reportFile := fs.String("report", "", "write each file's status, sizes, compression ratio and error, with the count of each status, to this JSON file (e.g. decompress.json)")
+	fs.BoolVar(&useGzipName, "use-gzip-name", false, "name outputs after the original file name in the gzip header and keep its modification time")
+	fs.Parse(args)
+
+	if bufferSize != 0 && bufferSize < minBufferSize {
+		fmt.Fprintf(os.Stderr, "Error: -buffer-size must be at least %d (or 0 for the built-in sizes)\n", minBufferSize)
+		os.Exit(2)
+	}
+
+	if err := logger.Init(logConfig); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	// Process all gzip files in the downloads directory
+	downloadsDir := "../scraper/downloads"
+
+	slog.Info("scanning directory", "dir", downloadsDir)
+
+	// Find all .gz and .br files in the directory
+	gzipFiles, err := findCompressedFiles(downloadsDir)
+	if err != nil {
+		slog.Error("error scanning directory", "dir", downloadsDir, "error", err)
+		return
+	}
+
+	slog.Info("found compressed files to process", "count", len(gzipFiles))
+	resolveSharedOutputs(gzipFiles)
+
+	if *validateOnly {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		validateAll(ctx, gzipFiles, *quiet)
+		return
+	}
+
+	cache, err := loadDecompressCache()
+	if err != nil {
+		slog.Warn("could not read decompress cache, starting a new one", "file", decompressCacheFile, "error", err)
+		cache = make(decompressCache)
+	}
+
+	// Stop on Ctrl-C, removing the output of the file in progress
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Process each file
+	successCount := 0
+	errorCount := 0
+	partialCount := 0
+	skippedCount := 0
+	crcMismatchCount := 0
+	sizeMismatchCount := 0
+
+	var report *decompressReport
+	if *reportFile != "" {
+		report = &decompressReport{}
+	}
+	addResult := func(result fileResult) {
+		if report != nil {
+			report.add(result)
+		}
+	}
+
+	var progress *logger.Progress
+	if !*quiet {
+		progress = logger.StartProgress(os.Stderr, "Progress", len(gzipFiles), 0)
+	}
+
+	for i, gzipFile := range gzipFiles {
+		if ctx.Err() != nil {
+			break
+		}
+		if progress != nil && i > 0 {
+			progress.Add(1, 0) // the previous file is done
+		}
+
+		fileName := filepath.Base(gzipFile)
+		slog.Info("processing file", "index", i+1, "total", len(gzipFiles), "file", fileName)
+
+		result := fileResult{File: gzipFile, Status: statusFailed}
+		outputFile, err := outputPath(gzipFile)
+		if err != nil {
+			slog.Error("skipping file without a usable output name", "file", fileName, "error", err)
+			errorCount++
+			result.Error = err.Error()
+			addResult(result)
+			continue
+		}
+
+		info, err := os.Stat(gzipFile)
+		if err != nil {
+			slog.Error("could not read file", "file", fileName, "error", err)
+			errorCount++
+			result.Error = err.Error()
+			addResult(result)
+			continue
+		}
+		result.InputSize = info.Size()
+
+		// An empty contentHash means the content is new and is hashed while
+		// it is decompressed
+		contentHash := ""
+		if !*force {
+			if contentHash, err = cache.knownHash(gzipFile, info); err != nil {
+				slog.Warn("could not hash file, decompressing it again", "file", fileName, "error", err)
+				contentHash = ""
+			}
+			if entry, ok := cache[contentHash]; contentHash != "" && ok && entry.Valid && hasOutput(entry.Output) {
+				slog.Info("skipping file, content already decompressed", "file", fileName, "output", entry.Output)
+				cache.record(contentHash, gzipFile, info, entry.Output, true, entry.Trailer)
+				skippedCount++
+				result.Status, result.Output, result.Trailer = statusSkipped, entry.Output, entry.Trailer
+				addResult(result)
+				continue
+			}
+			// Outputs from before the cache are trusted as they always were
+			if !cache.hasPath(gzipFile) && isAlreadyDecompressed(gzipFile) {
+				skippedCount++
+				result.Status, result.Output = statusSkipped, outputFile
+				addResult(result)
+				continue
+			}
+		}
+
+		// The output is stale, of unknown origin or -force was given, so
+		// remove it; the decompressors would otherwise skip it
+		if err := os.Remove(outputFile); err != nil && !os.IsNotExist(err) {
+			slog.Error("could not remove previous output", "file", outputFile, "error", err)
+			errorCount++
+			result.Error = err.Error()
+			addResult(result)
+			continue
+		}
+
+		var inputHash hash.Hash
+		if contentHash == "" {
+			inputHash = sha256.New()
+		}
+
+		// Brotli files have no partial-recovery fallback; gzip files try
+		// simple decompression first
+		complete := true
+		trailer := ""
+		if isBrotliFile(gzipFile) {
+			if err := brotliDecompress(ctx, gzipFile, inputHash); err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				slog.Error("brotli decompression failed", "file", fileName, "error", err)
+				errorCount++
+				result.Error = err.Error()
+				addResult(result)
+				continue
+			}
+			slog.Info("brotli decompression successful", "file", fileName)
+			successCount++
+		} else if trailer, err = simpleDecompress(ctx, gzipFile, inputHash); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			// The reason the file could not simply be decompressed is the
+			// one worth reporting, even if the robust fallback saves some
+			result.Error = err.Error()
+			if trailer == trailerCRCMismatch {
+				crcMismatchCount++
+				slog.Warn("gzip CRC-32 mismatch, the file is corrupt; trying robust decompression", "file", fileName, "error", err)
+			} else {
+				slog.Warn("simple decompression failed, trying robust decompression", "file", fileName, "error", err)
+			}
+
+			// Fall back to robust decompression. It may stop early, so its
+			// reads do not give a trustworthy input hash.
+			err = robustDecompress(ctx, gzipFile, nil)
+			if ctx.Err() != nil {
+				break
+			}
+			if err != nil {
+				slog.Error("both decompression methods failed", "file", fileName, "error", err)
+				errorCount++
+				result.Error = err.Error()
+				addResult(result)
+				continue
+			} else {
+				slog.Warn("robust decompression completed (may be partial)", "file", fileName)
+				partialCount++
+				complete = false
+			}
+		} else {
+			if trailer == trailerSizeMismatch {
+				sizeMismatchCount++
+			}
+			slog.Info("simple decompression successful", "file", fileName, "trailer", trailer)
+			successCount++
+		}
+
+		// Validate the JSON output
+		valid := isValidJSON(outputFile)
+		if valid {
+			slog.Info("JSON validation passed", "file", outputFile)
+		} else {
+			slog.Warn("JSON validation failed - file may be incomplete", "file", outputFile)
+			if successCount > 0 {
+				successCount--
+			}
+			partialCount++
+		}
+
+		if contentHash == "" && complete {
+			contentHash = hex.EncodeToString(inputHash.Sum(nil))
+		}
+		if contentHash != "" {
+			cache.record(contentHash, gzipFile, info, outputFile, valid && complete, trailer)
+		}
+
+		result.Output, result.Trailer = outputFile, trailer
+		switch {
+		case !complete:
+			result.Status = statusPartial
+		case !valid:
+			result.Status = statusInvalid
+			result.Error = "decompressed data is not valid JSON"
+		default:
+			result.Status = statusComplete
+		}
+		addResult(result)
+	}
+
+	if err := cache.save(); err != nil {
+		slog.Warn("could not save decompress cache", "file", decompressCacheFile, "error", err)
+	}
+
+	if report != nil {
+		if err := report.write(*reportFile); err != nil {
+			slog.Warn("could not write decompress report", "file", *reportFile, "error", err)
+		} else {
+			slog.Info("wrote decompress report", "file", *reportFile, "files", report.Total)
+		}
+	}
+
+	if ctx.Err() != nil {
+		slog.Warn("decompression interrupted, removed the partial output of the file in progress")
+	}
+
+	if progress != nil {
+		if len(gzipFiles) > 0 && ctx.Err() == nil {
+			progress.Add(1, 0)
+		}
+		progress.Stop()
+	}
+
+	slog.Info("decompression summary",
+		"total", len(gzipFiles),
+		"skipped", skippedCount,
+		"complete", successCount,
+		"partial", partialCount,
+		"failed", errorCount,
+		"crc_mismatch", crcMismatchCount,
+		"size_mismatch", sizeMismatchCount,
+	)
+
+	if partialCount > 0 {
+		slog.Warn("some files may have incomplete JSON due to gzip corruption; these may cause 'unexpected end of JSON input' errors in the pipeline", "partial", partialCount)
+	}
+}
+
+// isValidJSON checks if a file contains valid JSON, reading it as a stream
+func isValidJSON(filename string) bool {
+	file, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	// This will fail if JSON is incomplete
+	return validateJSONStream(file) == nil
+}
+
+// findCompressedFiles recursively finds all .gz and .br files in a directory
+func findCompressedFiles(dir string) ([]string, error) {
+	var gzipFiles []string
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Skip directories and files that are neither .gz nor .br
+		lowerName := strings.ToLower(info.Name())
+		if info.IsDir() || !(strings.HasSuffix(lowerName, ".gz") || strings.HasSuffix(lowerName, ".br")) {
+			return nil
+		}
+
+		// Skip empty files
+		if info.Size() == 0 {
+			slog.Warn("skipping empty file", "file", filepath.Base(path))
+			return nil
+		}
+
+		gzipFiles = append(gzipFiles, path)
+		return nil
+	})
+
+	return gzipFiles, err
+}
@@ -0,0 +1,96 @@
+package gunzip
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// outputDir is the directory decompressed files are written to
+const outputDir = "output"
+
+// safeOutputPath joins name onto dir, rejecting names that are absolute or
+// that resolve outside dir once cleaned, such as a gzip header name of
+// "../../etc/foo". Backslashes count as separators, since names may come from
+// archives written on Windows.
+func safeOutputPath(dir, name string) (string, error) {
+	slashed := strings.ReplaceAll(name, `\`, "/")
+	if name == "" || strings.HasPrefix(slashed, "/") || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("unsafe output name %q: must be a relative path", name)
+	}
+	path := filepath.Join(dir, filepath.FromSlash(slashed))
+	if err := withinDir(dir, path); err != nil {
+		return "", fmt.Errorf("unsafe output name %q: %v", name, err)
+	}
+	return path, nil
+}
+
+// withinDir returns an error unless path, once cleaned, is strictly inside dir
+func withinDir(dir, path string) error {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	if err != nil {
+		return fmt.Errorf("%s is not inside %s: %v", path, dir, err)
+	}
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s escapes %s", path, dir)
+	}
+	return nil
+}
+
+// sharedOutput is the output of an input whose natural output name, usually
+// from its gzip header, is shared with another input
+type sharedOutput struct {
+	path string
+	err  error
+}
+
+// sharedOutputs overrides outputPath for inputs with a shared output name,
+// as set by resolveSharedOutputs
+var sharedOutputs map[string]sharedOutput
+
+// resolveSharedOutputs gives every input whose output name another input
+// also has, as happens when -use-gzip-name finds the same header name in
+// several files, an output of its own: the shared name with the input's base
+// name added, e.g. in-network_a.json and in-network_b.json for a.json.gz and
+// b.json.gz. An input that still cannot have a name of its own gets an error
+// rather than having its data skipped as already decompressed.
+func resolveSharedOutputs(files []string) {
+	claims := make(map[string][]string) // output path -> inputs
+	for _, file := range files {
+		if path, err := outputPath(file); err == nil {
+			claims[path] = append(claims[path], file)
+		}
+	}
+
+	paths := make([]string, 0, len(claims))
+	for path, inputs := range claims {
+		if len(inputs) > 1 {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	shared := make(map[string]sharedOutput)
+	for _, path := range paths {
+		ext := filepath.Ext(path)
+		stem := strings.TrimSuffix(filepath.Base(path), ext)
+		for _, file := range claims[path] {
+			source := filepath.Base(strings.TrimSuffix(strings.TrimSuffix(file, ".gz"), ".br"))
+			source = strings.TrimSuffix(source, filepath.Ext(source))
+			name := fmt.Sprintf("%s_%s%s", stem, source, ext)
+
+			own, err := safeOutputPath(outputDir, name)
+			if err == nil && len(claims[own]) > 0 {
+				err = fmt.Errorf("output %s is shared with another input, and %s is taken too", filepath.Base(path), name)
+			}
+			if err == nil {
+				claims[own] = []string{file}
+				slog.Warn("output name is shared with another input, using another", "file", filepath.Base(file), "shared", filepath.Base(path), "output", filepath.Base(own))
+			}
+			shared[file] = sharedOutput{path: own, err: err}
+		}
+	}
+	sharedOutputs = shared
+}
@@ -0,0 +1,82 @@
+package gunzip
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// Per-file statuses in the -report file
+const (
+	statusComplete = "complete" // decompressed completely to valid JSON
+	statusPartial  = "partial"  // only part of the data could be recovered
+	statusInvalid  = "invalid"  // decompressed completely, but the JSON is not valid
+	statusFailed   = "failed"   // nothing usable was written
+	statusSkipped  = "skipped"  // already decompressed by an earlier run
+)
+
+// fileResult is the outcome of one compressed file
+type fileResult struct {
+	File       string  `json:"file"`
+	Output     string  `json:"output,omitempty"`
+	InputSize  int64   `json:"input_size"`
+	OutputSize int64   `json:"output_size"`
+	Ratio      float64 `json:"ratio,omitempty"` // output size over input size
+	Status     string  `json:"status"`
+	Trailer    string  `json:"trailer,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// decompressReport is the -report file: every file's result and the counts
+// of each status
+type decompressReport struct {
+	Total    int          `json:"total"`
+	Complete int          `json:"complete"`
+	Partial  int          `json:"partial"`
+	Invalid  int          `json:"invalid"`
+	Failed   int          `json:"failed"`
+	Skipped  int          `json:"skipped"`
+	Files    []fileResult `json:"files"`
+}
+
+// add records a file's result, filling in the output size and ratio
+func (r *decompressReport) add(result fileResult) {
+	if result.Output != "" {
+		if info, err := os.Stat(result.Output); err == nil {
+			result.OutputSize = info.Size()
+		}
+	}
+	if result.InputSize > 0 && result.OutputSize > 0 {
+		result.Ratio = float64(result.OutputSize) / float64(result.InputSize)
+	}
+
+	switch result.Status {
+	case statusComplete:
+		r.Complete++
+	case statusPartial:
+		r.Partial++
+	case statusInvalid:
+		r.Invalid++
+	case statusFailed:
+		r.Failed++
+	case statusSkipped:
+		r.Skipped++
+	}
+	r.Total++
+	r.Files = append(r.Files, result)
+}
+
+// write saves the report through a temporary file, like the cache
+func (r *decompressReport) write(path string) error {
+	if r.Files == nil {
+		r.Files = []fileResult{}
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
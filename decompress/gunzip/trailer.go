@@ -0,0 +1,131 @@
+package gunzip
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+)
+
+// errCRCMismatch is returned when a gzip member's data does not match the
+// CRC-32 in its trailer: the file is corrupt, not just cut short
+var errCRCMismatch = errors.New("gzip CRC-32 mismatch")
+
+// Outcomes of checking a file's gzip trailers, recorded in the cache
+const (
+	trailerVerified     = "verified"      // every member matched its CRC-32 and ISIZE
+	trailerSizeMismatch = "size_mismatch" // the CRC-32s matched but an ISIZE did not
+	trailerCRCMismatch  = "crc_mismatch"  // a member's data failed its CRC-32
+)
+
+// checkedGzipReader decompresses every member of a gzip stream like
+// gzip.Reader, but checks each member's trailer itself. gzip.Reader reports
+// a bad CRC-32 and a bad ISIZE alike as gzip.ErrChecksum; here a bad CRC-32
+// is errCRCMismatch, and an ISIZE that disagrees with the decompressed length
+// while the CRC-32 matches is only warned about, since the data is intact.
+type checkedGzipReader struct {
+	gz     *gzip.Reader
+	src    *trailerReader
+	Header gzip.Header // of the first member
+
+	crc            uint32 // of the current member's data so far
+	size           uint32 // length of the current member's data, modulo 2^32 like ISIZE
+	members        int
+	sizeMismatches int
+	err            error // the error that ended the stream
+}
+
+func newCheckedGzipReader(r io.Reader) (*checkedGzipReader, error) {
+	src := &trailerReader{r: newInputReader(r)}
+	gz, err := gzip.NewReader(src)
+	if err != nil {
+		return nil, err
+	}
+	gz.Multistream(false)
+	return &checkedGzipReader{gz: gz, src: src, Header: gz.Header, members: 1}, nil
+}
+
+func (c *checkedGzipReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.gz.Read(p)
+	c.crc = crc32.Update(c.crc, crc32.IEEETable, p[:n])
+	c.size += uint32(n)
+	if err != io.EOF && err != gzip.ErrChecksum {
+		c.err = err
+		return n, err
+	}
+
+	// The member has ended and its trailer was the last thing read
+	if c.err = c.checkTrailer(); c.err != nil {
+		return n, c.err
+	}
+
+	// Continue with the next member, if there is one
+	if c.err = c.gz.Reset(c.src); c.err != nil {
+		return n, c.err
+	}
+	c.gz.Multistream(false)
+	c.members++
+	c.crc, c.size = 0, 0
+	return n, nil
+}
+
+// checkTrailer compares the trailer of the member just read with its data
+func (c *checkedGzipReader) checkTrailer() error {
+	crc := binary.LittleEndian.Uint32(c.src.tail[:4])
+	size := binary.LittleEndian.Uint32(c.src.tail[4:])
+	if crc != c.crc {
+		return fmt.Errorf("%w in member %d: trailer has %08x, data has %08x", errCRCMismatch, c.members, crc, c.crc)
+	}
+	if size != c.size {
+		c.sizeMismatches++
+		slog.Warn("gzip ISIZE disagrees with the decompressed length", "member", c.members, "isize", size, "bytes", c.size)
+	}
+	return nil
+}
+
+// status returns the trailer outcome of a stream read to the end
+func (c *checkedGzipReader) status() string {
+	if c.sizeMismatches > 0 {
+		return trailerSizeMismatch
+	}
+	return trailerVerified
+}
+
+func (c *checkedGzipReader) Close() error {
+	return c.gz.Close()
+}
+
+// trailerReader is the gzip reader's source. It implements io.ByteReader, so
+// the decompressor reads no further than each member's end, and it keeps the
+// last 8 bytes read: after a member, its CRC-32 and ISIZE.
+type trailerReader struct {
+	r    *bufio.Reader
+	tail [8]byte
+}
+
+func (t *trailerReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n >= len(t.tail) {
+		copy(t.tail[:], p[n-len(t.tail):n])
+	} else {
+		copy(t.tail[:], t.tail[n:])
+		copy(t.tail[len(t.tail)-n:], p[:n])
+	}
+	return n, err
+}
+
+func (t *trailerReader) ReadByte() (byte, error) {
+	b, err := t.r.ReadByte()
+	if err == nil {
+		copy(t.tail[:], t.tail[1:])
+		t.tail[len(t.tail)-1] = b
+	}
+	return b, err
+}
@@ -0,0 +1,141 @@
+package gunzip
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/andybalholm/brotli"
+
+	"logger"
+)
+
+// Outcomes of -validate-only for one file
+const (
+	validationValid   = "valid"   // decompresses completely to well-formed JSON
+	validationPartial = "partial" // the data ends early, as in a truncated download
+	validationInvalid = "invalid" // corrupt compressed data or malformed JSON
+)
+
+// validateJSONStream reads r to the end, checking that it is well-formed JSON
+// token by token, so memory does not grow with the size of the document
+func validateJSONStream(r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	depth := 0
+	for tokens := 0; ; tokens++ {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			// Token reports the end of the input as io.EOF even inside an
+			// unclosed object or array
+			if depth > 0 {
+				return io.ErrUnexpectedEOF
+			}
+			if tokens == 0 {
+				return fmt.Errorf("no JSON value")
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+}
+
+// validateFile streams one compressed file through its decompressor and
+// validateJSONStream without writing anything, returning a validation outcome
+// and, unless it is valid, the error that decided it
+func validateFile(ctx context.Context, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return validationInvalid, fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	var input io.Reader
+	if isBrotliFile(path) {
+		input = brotli.NewReader(file)
+	} else {
+		gzipReader, err := newCheckedGzipReader(file)
+		if err != nil {
+			if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+				return validationPartial, fmt.Errorf("failed to create gzip reader: %v", err)
+			}
+			return validationInvalid, fmt.Errorf("failed to create gzip reader: %v", err)
+		}
+		defer gzipReader.Close()
+		input = gzipReader
+	}
+
+	err = validateJSONStream(contextReader{ctx, input})
+	switch {
+	case err == nil:
+		return validationValid, nil
+	case ctx.Err() != nil:
+		return "", ctx.Err()
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return validationPartial, err
+	default:
+		return validationInvalid, err
+	}
+}
+
+// validateAll is the -validate-only run: it checks every file and logs the
+// valid, partial and invalid counts, writing nothing to disk
+func validateAll(ctx context.Context, files []string, quiet bool) {
+	counts := make(map[string]int)
+
+	var progress *logger.Progress
+	if !quiet {
+		progress = logger.StartProgress(os.Stderr, "Validating", len(files), 0)
+	}
+
+	checked := 0
+	for i, path := range files {
+		fileName := filepath.Base(path)
+		slog.Info("validating file", "index", i+1, "total", len(files), "file", fileName)
+
+		status, err := validateFile(ctx, path)
+		if ctx.Err() != nil {
+			break
+		}
+		counts[status]++
+		checked++
+		switch status {
+		case validationValid:
+			slog.Info("file is valid", "file", fileName)
+		case validationPartial:
+			slog.Warn("file is incomplete", "file", fileName, "error", err)
+		default:
+			slog.Error("file is invalid", "file", fileName, "error", err)
+		}
+		if progress != nil {
+			progress.Add(1, 0)
+		}
+	}
+
+	if progress != nil {
+		progress.Stop()
+	}
+	if ctx.Err() != nil {
+		slog.Warn("validation interrupted")
+	}
+
+	slog.Info("validation summary",
+		"total", len(files),
+		"checked", checked,
+		"valid", counts[validationValid],
+		"partial", counts[validationPartial],
+		"invalid", counts[validationInvalid],
+	)
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"decompress/gunzip"
+)
+
+func main() {
+	gunzip.Main(os.Args[0], os.Args[1:])
+}
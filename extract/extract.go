@@ -0,0 +1,539 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Define the schema structure based on your interpretation
+type NegotiatedPrice struct {
+	BillingClass   string   `json:"billing_class"`
+	ExpirationDate string   `json:"expiration_date"`
+	NegotiatedRate float64  `json:"negotiated_rate"`
+	NegotiatedType string   `json:"negotiated_type"`
+	ServiceCode    []string `json:"service_code"`
+}
+
+type NegotiatedRate struct {
+	NegotiatedPrices  []NegotiatedPrice `json:"negotiated_prices"`
+	ProviderReference []int64           `json:"provider_references"`
+}
+
+type ICD10Record struct {
+	BillingCode            string           `json:"billing_code"`
+	BillingCodeType        string           `json:"billing_code_type"`
+	BillingCodeTypeVersion string           `json:"billing_code_type_version"`
+	Description            string           `json:"description"`
+	Name                   string           `json:"name"`
+	NegotiatedRates        []NegotiatedRate `json:"negotiated_rates"`
+	NegotiationArrangment  string           `json:"negotiation_arrangement"`
+}
+
+// Flatten nested object into dot-notation keys
+func flattenObject(obj map[string]interface{}, prefix string) map[string]interface{} {
+	flattened := make(map[string]interface{})
+
+	for key, value := range obj {
+		newKey := key
+		if prefix != "" {
+			newKey = prefix + "." + key
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			// Recursively flatten nested objects
+			nested := flattenObject(v, newKey)
+			for nestedKey, nestedValue := range nested {
+				flattened[nestedKey] = nestedValue
+			}
+		case []interface{}:
+			// Handle arrays - join with pipe separator
+			if len(v) > 0 {
+				strValues := make([]string, len(v))
+				for i, item := range v {
+					strValues[i] = fmt.Sprintf("%v", item)
+				}
+				flattened[newKey] = strings.Join(strValues, "|")
+			} else {
+				flattened[newKey] = ""
+			}
+		default:
+			flattened[newKey] = value
+		}
+	}
+
+	return flattened
+}
+
+// Extract value from flattened object using dot notation
+func extractValue(obj map[string]interface{}, path string) string {
+	if val, ok := obj[path]; ok {
+		switch v := val.(type) {
+		case string:
+			return v
+		case float64:
+			return fmt.Sprintf("%.2f", v)
+		case int:
+			return strconv.Itoa(v)
+		case bool:
+			return strconv.FormatBool(v)
+		case nil:
+			return ""
+		default:
+			return fmt.Sprintf("%v", v)
+		}
+	}
+	return ""
+}
+
+// Discover all available fields in the flattened data
+func discoverFields(records []map[string]interface{}) []string {
+	fieldSet := make(map[string]bool)
+
+	for _, record := range records {
+		// Flatten each record first
+		flattened := flattenObject(record, "")
+		for field := range flattened {
+			fieldSet[field] = true
+		}
+	}
+
+	// Convert to slice and sort for consistent ordering
+	fields := make([]string, 0, len(fieldSet))
+	for field := range fieldSet {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	return fields
+}
+
+func handleNullValues(value string) string {
+	if value == "" || value == "<nil>" || value == "null" {
+		return "N/A"
+	}
+	return value
+}
+
+// Extract using the structured approach. With percentageColumn, the rate of
+// a price whose negotiated_type is percentage goes in a negotiated_percentage
+// column instead of negotiated_rate, so percentages are never averaged with
+// dollar amounts.
+func ExtractToCSV(percentageColumn bool) {
+	fmt.Println("Starting CSV extraction")
+
+	// Read the JSON file with matching objects
+	jsonFile, err := os.Open("billing_code_matches.json")
+	if err != nil {
+		panic(err)
+	}
+	defer jsonFile.Close()
+
+	var records []ICD10Record
+	if err := json.NewDecoder(jsonFile).Decode(&records); err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("Loaded %d records from billing_code_matches.json\n", len(records))
+
+	if len(records) == 0 {
+		fmt.Println("No records to process")
+		return
+	}
+
+	// Find the maximum number of service codes and provider references across all records
+	maxServiceCodes := 0
+	maxProviderRefs := 0
+
+	for _, record := range records {
+		for _, rate := range record.NegotiatedRates {
+			for _, price := range rate.NegotiatedPrices {
+				if len(price.ServiceCode) > maxServiceCodes {
+					maxServiceCodes = len(price.ServiceCode)
+				}
+				if len(rate.ProviderReference) > maxProviderRefs {
+					maxProviderRefs = len(rate.ProviderReference)
+				}
+			}
+		}
+	}
+
+	fmt.Printf("Maximum service codes per record: %d\n", maxServiceCodes)
+	fmt.Printf("Maximum provider references per record: %d\n", maxProviderRefs)
+
+	// Define CSV columns based on your schema with separate columns for arrays
+	csvColumns := []string{
+		"billing_code",
+		"billing_code_type",
+		"billing_code_type_version",
+		"description",
+		"name",
+		"negotiated_rates_count",
+		"negotiation_arrangement",
+		"negotiated_prices_count",
+		"billing_class",
+		"expiration_date",
+		"negotiated_rate",
+	}
+	if percentageColumn {
+		csvColumns = append(csvColumns, "negotiated_percentage")
+	}
+	csvColumns = append(csvColumns, "negotiated_type")
+	// The service code and provider reference columns follow these
+	fixedColumns := len(csvColumns)
+
+	// Add service code columns
+	for i := 0; i < maxServiceCodes; i++ {
+		csvColumns = append(csvColumns, fmt.Sprintf("service_code_%d", i+1))
+	}
+
+	// Add provider reference columns
+	for i := 0; i < maxProviderRefs; i++ {
+		csvColumns = append(csvColumns, fmt.Sprintf("provider_reference_%d", i+1))
+	}
+
+	// Create CSV output file
+	csvFile, err := os.Create("extracted.csv")
+	if err != nil {
+		panic(err)
+	}
+	defer csvFile.Close()
+
+	writer := csv.NewWriter(csvFile)
+	defer writer.Flush()
+
+	// Write header
+	if err := writer.Write(csvColumns); err != nil {
+		panic(err)
+	}
+
+	// Process each record
+	rowCount := 0
+	for i, record := range records {
+		// For each negotiated rate, create a row
+		for _, rate := range record.NegotiatedRates {
+			// For each negotiated price, create a row
+			for _, price := range rate.NegotiatedPrices {
+				row := make([]string, len(csvColumns))
+
+				// Fill basic fields
+				row[0] = handleNullValues(record.BillingCode)
+				row[1] = handleNullValues(record.BillingCodeType)
+				row[2] = record.BillingCodeTypeVersion
+				row[3] = record.Description
+				row[4] = record.Name
+				row[5] = strconv.Itoa(len(record.NegotiatedRates))
+				row[6] = record.NegotiationArrangment
+				row[7] = strconv.Itoa(len(rate.NegotiatedPrices))
+				row[8] = price.BillingClass
+				row[9] = price.ExpirationDate
+				row[10] = fmt.Sprintf("%.2f", price.NegotiatedRate)
+				if percentageColumn && strings.EqualFold(price.NegotiatedType, "percentage") {
+					row[10], row[11] = "", row[10]
+				}
+				row[fixedColumns-1] = price.NegotiatedType
+
+				// Fill service code columns
+				serviceCodeStart := fixedColumns
+				for j, serviceCode := range price.ServiceCode {
+					if j < maxServiceCodes {
+						row[serviceCodeStart+j] = handleNullValues(serviceCode)
+					}
+				}
+				// Fill remaining service code columns with empty strings
+				for j := len(price.ServiceCode); j < maxServiceCodes; j++ {
+					row[serviceCodeStart+j] = ""
+				}
+
+				// Fill provider reference columns
+				providerRefStart := fixedColumns + maxServiceCodes
+				for j, providerRef := range rate.ProviderReference {
+					if j < maxProviderRefs {
+						row[providerRefStart+j] = handleNullValues(strconv.FormatInt(providerRef, 10))
+					}
+				}
+				// Fill remaining provider reference columns with empty strings
+				for j := len(rate.ProviderReference); j < maxProviderRefs; j++ {
+					row[providerRefStart+j] = ""
+				}
+
+				if err := writer.Write(row); err != nil {
+					panic(err)
+				}
+				rowCount++
+			}
+		}
+
+		if (i+1)%10 == 0 {
+			fmt.Printf("Processed %d/%d records\n", i+1, len(records))
+		}
+	}
+
+	fmt.Printf("Extracted %d rows to extracted.csv\n", rowCount)
+}
+
+// flattenBatchSize bounds how many raw records are held while discovering fields
+const flattenBatchSize = 1000
+
+// forEachRecord streams the objects of a top-level JSON array, one at a time
+func forEachRecord(path string, fn func(map[string]interface{}) error) error {
+	return forEachArrayElement(path, func(decoder *json.Decoder) error {
+		var record map[string]interface{}
+		if err := decoder.Decode(&record); err != nil {
+			return fmt.Errorf("failed to decode record: %v", err)
+		}
+		return fn(record)
+	})
+}
+
+// forEachRawRecord is forEachRecord passing each object undecoded
+func forEachRawRecord(path string, fn func(json.RawMessage) error) error {
+	return forEachArrayElement(path, func(decoder *json.Decoder) error {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return fmt.Errorf("failed to decode record: %v", err)
+		}
+		return fn(raw)
+	})
+}
+
+// forEachArrayElement opens the top-level JSON array in path and calls decode
+// to read each of its elements from the decoder
+func forEachArrayElement(path string, decode func(*json.Decoder) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	tok, err := decoder.Token()
+	if err != nil {
+		return fmt.Errorf("failed to read opening token: %v", err)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("expected a JSON array in %s", path)
+	}
+
+	for decoder.More() {
+		if err := decode(decoder); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Field orders for -field-order
+const (
+	fieldOrderAlpha = "alpha" // sorted by name, the same for any record order
+	fieldOrderSeen  = "seen"  // as the fields appear in the records
+)
+
+// seenFieldOrder lists flattened fields in the order they appear in the
+// records. A field first seen in a later record is placed right after the
+// field before it in that record, or first if it leads the record, so fields
+// stay next to their neighbours in the MRF; ties go to the earlier record.
+type seenFieldOrder struct {
+	seen   map[string]bool
+	fields []string
+}
+
+func newSeenFieldOrder() *seenFieldOrder {
+	return &seenFieldOrder{seen: make(map[string]bool)}
+}
+
+// add merges the fields of one record, in the order they appear in it
+func (o *seenFieldOrder) add(keys []string) {
+	position := 0 // where a new field goes: after the previous key of the record
+	for _, key := range keys {
+		if o.seen[key] {
+			position = slices.Index(o.fields, key) + 1
+			continue
+		}
+		o.seen[key] = true
+		o.fields = slices.Insert(o.fields, position, key)
+		position++
+	}
+}
+
+// flattenedKeys returns the keys flattenObject would produce for the JSON
+// object raw, in document order. A decoded map has lost that order.
+func flattenedKeys(raw json.RawMessage) ([]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	tok, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("record is not a JSON object")
+	}
+	return appendFlattenedKeys(decoder, "", nil)
+}
+
+// appendFlattenedKeys appends the keys of the object whose opening brace the
+// decoder has just read, consuming it up to its closing brace
+func appendFlattenedKeys(decoder *json.Decoder, prefix string, keys []string) ([]string, error) {
+	for decoder.More() {
+		tok, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := tok.(string)
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		tok, err = decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch tok {
+		case json.Delim('{'):
+			// Nested objects are flattened into their own keys
+			if keys, err = appendFlattenedKeys(decoder, key, keys); err != nil {
+				return nil, err
+			}
+			continue
+		case json.Delim('['):
+			// Arrays are joined into one value, so skip their elements
+			for depth := 1; depth > 0; {
+				tok, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				switch tok {
+				case json.Delim('['), json.Delim('{'):
+					depth++
+				case json.Delim(']'), json.Delim('}'):
+					depth--
+				}
+			}
+		}
+		keys = append(keys, key)
+	}
+	// Closing brace
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// discoverFieldsSorted is the first pass of ExtractFlattenedToCSV for
+// fieldOrderAlpha. It discovers fields batch by batch so only one batch is in
+// memory, and returns them sorted along with the number of records.
+func discoverFieldsSorted(path string) ([]string, int) {
+	fieldSet := make(map[string]bool)
+	batch := make([]map[string]interface{}, 0, flattenBatchSize)
+	recordCount := 0
+	mergeBatch := func() {
+		for _, field := range discoverFields(batch) {
+			fieldSet[field] = true
+		}
+		batch = batch[:0]
+	}
+
+	err := forEachRecord(path, func(record map[string]interface{}) error {
+		batch = append(batch, record)
+		recordCount++
+		if len(batch) == flattenBatchSize {
+			mergeBatch()
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	mergeBatch()
+
+	fields := make([]string, 0, len(fieldSet))
+	for field := range fieldSet {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields, recordCount
+}
+
+// discoverFieldsInOrder is the first pass of ExtractFlattenedToCSV for
+// fieldOrderSeen. Each record's keys are read in document order, one record
+// at a time.
+func discoverFieldsInOrder(path string) ([]string, int) {
+	order := newSeenFieldOrder()
+	recordCount := 0
+	err := forEachRawRecord(path, func(raw json.RawMessage) error {
+		keys, err := flattenedKeys(raw)
+		if err != nil {
+			return fmt.Errorf("failed to read fields of record %d: %v", recordCount+1, err)
+		}
+		order.add(keys)
+		recordCount++
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	return order.fields, recordCount
+}
+
+// Extract using the generic flattener, with one column per discovered field.
+// order is fieldOrderAlpha or fieldOrderSeen.
+func ExtractFlattenedToCSV(order string) {
+	fmt.Println("Starting flattened CSV extraction")
+
+	var fields []string
+	var recordCount int
+	if order == fieldOrderSeen {
+		fields, recordCount = discoverFieldsInOrder("billing_code_matches.json")
+	} else {
+		fields, recordCount = discoverFieldsSorted("billing_code_matches.json")
+	}
+
+	fmt.Printf("Loaded %d records from billing_code_matches.json\n", recordCount)
+
+	if recordCount == 0 {
+		fmt.Println("No records to process")
+		return
+	}
+
+	fmt.Printf("Discovered %d fields\n", len(fields))
+
+	csvFile, err := os.Create("extracted.csv")
+	if err != nil {
+		panic(err)
+	}
+	defer csvFile.Close()
+
+	writer := csv.NewWriter(csvFile)
+	defer writer.Flush()
+
+	if err := writer.Write(fields); err != nil {
+		panic(err)
+	}
+
+	// Second pass: write one row per record
+	rowCount := 0
+	err = forEachRecord("billing_code_matches.json", func(record map[string]interface{}) error {
+		flattened := flattenObject(record, "")
+		row := make([]string, len(fields))
+		for i, field := range fields {
+			row[i] = extractValue(flattened, field)
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+		rowCount++
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("Extracted %d rows to extracted.csv\n", rowCount)
+}
@@ -1,7 +1,10 @@
-package main
+package extract
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"os"
@@ -62,7 +65,20 @@ func findMatchingObjects(data interface{}) []InNetworkObj {
 	return findMatchingObjectsOptimized(data)
 }
 
-func main() {
+// Main runs the legacy parser on the command-line arguments args; name is
+// the program name shown in its usage message
+func Main(name string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	flatten := fs.Bool("flatten", false, "write a CSV column for every field discovered in the records instead of the fixed schema")
+	fieldOrder := fs.String("field-order", fieldOrderAlpha, "column order of -flatten: alpha (sorted by name) or seen (as the fields first appear in the records)")
+	percentageColumn := fs.Bool("percentage-column", false, "write the rate of a price whose negotiated_type is percentage to a negotiated_percentage column after negotiated_rate, leaving negotiated_rate for dollar amounts (adds a column)")
+	fs.Parse(args)
+
+	if *fieldOrder != fieldOrderAlpha && *fieldOrder != fieldOrderSeen {
+		fmt.Fprintf(os.Stderr, "Error: -field-order must be %s or %s\n", fieldOrderAlpha, fieldOrderSeen)
+		os.Exit(2)
+	}
+
 	fmt.Println("Starting JSON parser...")
 
 	jsonFile, err := os.Open("billing_code_matches.json")
@@ -89,8 +105,13 @@ func main() {
 		},
 	}
 
+	reader := bufio.NewReader(progressReader)
+	if skipBOM(reader) {
+		fmt.Println("Warning: skipped UTF-8 byte order mark at start of billing_code_matches.json")
+	}
+
 	var data interface{}
-	if err := json.NewDecoder(progressReader).Decode(&data); err != nil {
+	if err := json.NewDecoder(reader).Decode(&data); err != nil {
 		panic(err)
 	}
 	fmt.Println("\nJSON file loaded successfully!")
@@ -120,7 +141,21 @@ func main() {
 
 	fmt.Printf("Done! %d matching objects written to billing_code_matches.json\n", len(records))
 
-	ExtractToCSV()
+	if *flatten {
+		ExtractFlattenedToCSV(*fieldOrder)
+	} else {
+		ExtractToCSV(*percentageColumn)
+	}
+}
+
+// skipBOM consumes a leading UTF-8 byte order mark, reporting whether there was one
+func skipBOM(reader *bufio.Reader) bool {
+	prefix, _ := reader.Peek(3)
+	if !bytes.Equal(prefix, []byte{0xEF, 0xBB, 0xBF}) {
+		return false
+	}
+	reader.Discard(3)
+	return true
 }
 
 // ProgressReader wraps an io.Reader and reports progress
@@ -1,8 +1,10 @@
 package jsonformatter
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -16,6 +18,8 @@ func ParseAndFormatJSON(inputFile string) (interface{}, error) {
 		return nil, fmt.Errorf("error reading file %s: %v", inputFile, err)
 	}
 
+	input = trimBOM(inputFile, input)
+
 	// Parse the JSON to validate it
 	var data interface{}
 	if err := json.Unmarshal(input, &data); err != nil {
@@ -25,20 +29,37 @@ func ParseAndFormatJSON(inputFile string) (interface{}, error) {
 	return data, nil
 }
 
+// Options changes how FormatJSONToFileWith formats a file
+type Options struct {
+	// NormalizeStrings applies NormalizeStrings before formatting
+	NormalizeStrings bool
+}
+
 // FormatJSONToFile reads a JSON file, formats it, and writes to a new file
 func FormatJSONToFile(inputFile string) error {
+	return FormatJSONToFileWith(inputFile, Options{})
+}
+
+// FormatJSONToFileWith is FormatJSONToFile with options
+func FormatJSONToFileWith(inputFile string, opts Options) error {
 	// Read JSON from input file
 	input, err := os.ReadFile(inputFile)
 	if err != nil {
 		return fmt.Errorf("error reading file %s: %v", inputFile, err)
 	}
 
+	input = trimBOM(inputFile, input)
+
 	// Parse the JSON to validate it
 	var data interface{}
 	if err := json.Unmarshal(input, &data); err != nil {
 		return fmt.Errorf("error parsing JSON in %s: %v", inputFile, err)
 	}
 
+	if opts.NormalizeStrings {
+		data = NormalizeStrings(data)
+	}
+
 	// Format the JSON with proper indentation
 	formatted, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
@@ -58,24 +79,67 @@ func FormatJSONToFile(inputFile string) error {
 	return nil
 }
 
-// GetFormattedFilename returns the formatted filename for a given input file
-func GetFormattedFilename(inputFile string) string {
-	baseName := strings.TrimSuffix(filepath.Base(inputFile), filepath.Ext(inputFile))
-	return baseName + "_formatted.json"
-}
+// FormatJSON reads one JSON document from r and writes it to w indented with
+// two spaces. The whole document is held in memory while it is formatted.
+func FormatJSON(r io.Reader, w io.Writer) error {
+	input, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("error reading JSON: %v", err)
+	}
+	if bytes.HasPrefix(input, utf8BOM) {
+		input = input[len(utf8BOM):]
+	}
 
-// main function for standalone usage
-func main() {
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s <input_file.json>\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "Example: %s data.json\n", os.Args[0])
-		os.Exit(1)
+	var data interface{}
+	if err := json.Unmarshal(input, &data); err != nil {
+		return fmt.Errorf("error parsing JSON: %v", err)
 	}
 
-	inputFile := os.Args[1]
+	formatted, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error formatting JSON: %v", err)
+	}
+	if _, err := w.Write(append(formatted, '\n')); err != nil {
+		return fmt.Errorf("error writing JSON: %v", err)
+	}
+	return nil
+}
 
-	if err := FormatJSONToFile(inputFile); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+// NormalizeStrings collapses every run of whitespace in the string values of
+// data to a single space and trims them, recursing through objects and arrays.
+// Only values are changed, never keys. It is lossy: tabs, line breaks and
+// spacing in the values cannot be recovered afterwards.
+func NormalizeStrings(data interface{}) interface{} {
+	switch v := data.(type) {
+	case string:
+		return strings.Join(strings.Fields(v), " ")
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = NormalizeStrings(value)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = NormalizeStrings(item)
+		}
 	}
+	return data
+}
+
+// trimBOM strips a leading UTF-8 byte order mark, which encoding/json rejects,
+// and warns that it did so
+func trimBOM(inputFile string, input []byte) []byte {
+	if !bytes.HasPrefix(input, utf8BOM) {
+		return input
+	}
+	fmt.Fprintf(os.Stderr, "Warning: skipped UTF-8 byte order mark at start of %s\n", inputFile)
+	return input[len(utf8BOM):]
+}
+
+// utf8BOM is the byte order mark some publishers write at the start of a file
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// GetFormattedFilename returns the formatted filename for a given input file
+func GetFormattedFilename(inputFile string) string {
+	baseName := strings.TrimSuffix(filepath.Base(inputFile), filepath.Ext(inputFile))
+	return baseName + "_formatted.json"
 }
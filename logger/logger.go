@@ -0,0 +1,67 @@
+package logger
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Config holds the logging options shared by every stage
+type Config struct {
+	Level  string
+	Format string
+}
+
+// RegisterFlags adds the -log-level and -log-format flags to a flag set
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Level, "log-level", "info", "minimum log level: debug, info, warn, error")
+	fs.StringVar(&c.Format, "log-format", "text", "log output format: text or json")
+}
+
+// parseLevel converts a level name into a slog.Level
+func parseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level %q", level)
+}
+
+// New builds a logger writing to w using the configured level and format
+func New(w io.Writer, c Config) (*slog.Logger, error) {
+	level, err := parseLevel(c.Level)
+	if err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(strings.TrimSpace(c.Format)) {
+	case "", "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", c.Format)
+	}
+	return slog.New(handler), nil
+}
+
+// Init creates a logger on stderr and installs it as the slog default
+func Init(c Config) error {
+	l, err := New(os.Stderr, c)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(l)
+	return nil
+}
@@ -0,0 +1,85 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// ProgressInterval is how often a Progress redraws its line
+const ProgressInterval = 2 * time.Second
+
+// Progress draws a single self-updating "files done / total" line, with
+// bytes when a byte total is known. Add is safe to call from any goroutine.
+type Progress struct {
+	w          io.Writer
+	label      string
+	totalFiles int64
+	totalBytes int64
+	files      atomic.Int64
+	bytes      atomic.Int64
+	start      time.Time
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// StartProgress begins redrawing the progress line on w every ProgressInterval
+// until Stop is called. totalBytes may be 0 to show file counts only.
+func StartProgress(w io.Writer, label string, totalFiles int, totalBytes int64) *Progress {
+	p := &Progress{
+		w:          w,
+		label:      label,
+		totalFiles: int64(totalFiles),
+		totalBytes: totalBytes,
+		start:      time.Now(),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Add records finished files and the bytes they account for
+func (p *Progress) Add(files int, bytes int64) {
+	p.files.Add(int64(files))
+	p.bytes.Add(bytes)
+}
+
+// Stop draws the final line and ends it with a newline
+func (p *Progress) Stop() {
+	close(p.stop)
+	<-p.done
+}
+
+func (p *Progress) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(ProgressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.draw()
+		case <-p.stop:
+			p.draw()
+			fmt.Fprintln(p.w)
+			return
+		}
+	}
+}
+
+func (p *Progress) draw() {
+	files := p.files.Load()
+	percentage := 100.0
+	if p.totalFiles > 0 {
+		percentage = float64(files) / float64(p.totalFiles) * 100
+	}
+
+	line := fmt.Sprintf("\r%s: %.1f%% (%d/%d files)", p.label, percentage, files, p.totalFiles)
+	if p.totalBytes > 0 {
+		line += fmt.Sprintf(" %.1f/%.1f MB", float64(p.bytes.Load())/(1024*1024), float64(p.totalBytes)/(1024*1024))
+	}
+	line += fmt.Sprintf(" %s   ", time.Since(p.start).Round(time.Second))
+	fmt.Fprint(p.w, line)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"decompress/gunzip"
+	"jsonformatter"
+	"parsing/extract"
+	"scraper/scrape"
+	"search/pipeline"
+)
+
+// subcommand is one stage of the tool. run gets the name to show in usage
+// messages and the arguments after the subcommand.
+type subcommand struct {
+	name    string
+	summary string
+	run     func(name string, args []string)
+}
+
+var subcommands = []subcommand{
+	{"scrape", "download the files listed in urls.txt", scrape.Main},
+	{"decompress", "decompress downloaded .gz and .br files to JSON", gunzip.Main},
+	{"match", "stream downloaded files and write the records with the target billing codes", pipeline.Main},
+	{"extract", "search billing_code_matches.json and write extracted.csv (legacy parser)", extract.Main},
+	{"format", "indent JSON files into <name>_formatted.json", runFormat},
+}
+
+func main() {
+	program := filepath.Base(os.Args[0])
+	if len(os.Args) < 2 {
+		usage(program)
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	switch name {
+	case "help", "-h", "-help", "--help":
+		usage(program)
+		return
+	}
+	for _, cmd := range subcommands {
+		if cmd.name == name {
+			cmd.run(program+" "+name, os.Args[2:])
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Error: unknown subcommand %q\n", name)
+	usage(program)
+	os.Exit(2)
+}
+
+// usage lists the subcommands. Each stage still reads and writes its files
+// relative to the working directory, as its own binary does.
+func usage(program string) {
+	fmt.Fprintf(os.Stderr, "Usage: %s <subcommand> [flags] [args]\n\nSubcommands:\n", program)
+	for _, cmd := range subcommands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun %s <subcommand> -h for its flags.\n", program)
+}
+
+// runFormat is the format subcommand: it indents each JSON file given
+func runFormat(name string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	normalize := fs.Bool("normalize-strings", false, "collapse runs of whitespace (tabs, newlines, spaces) in string values to single spaces and trim them; keys are untouched, and the original spacing is lost")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags] <input_file.json>...\n", name)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	opts := jsonformatter.Options{NormalizeStrings: *normalize}
+	failed := false
+	for _, inputFile := range fs.Args() {
+		if err := jsonformatter.FormatJSONToFileWith(inputFile, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -2,6 +2,24 @@ module search
 
 go 1.24.4
 
-require jsonformatter v0.0.0
+require (
+	github.com/parquet-go/parquet-go v0.25.1
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
+	jsonformatter v0.0.0
+	logger v0.0.0
+	scraper v0.0.0
+)
 
-replace jsonformatter => ../jsonformatter
+require (
+	github.com/andybalholm/brotli v1.1.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/pierrec/lz4/v4 v4.1.21 // indirect
+	golang.org/x/sys v0.22.0 // indirect
+)
+
+replace (
+	jsonformatter => ../jsonformatter
+	logger => ../logger
+	scraper => ../scraper
+)
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"search/pipeline"
+)
+
+func main() {
+	pipeline.Main(os.Args[0], os.Args[1:])
+}
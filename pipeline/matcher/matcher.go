@@ -0,0 +1,600 @@
+package matcher
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// MatchPredicate reports whether a decoded record should be written to the output
+type MatchPredicate func(record map[string]interface{}) bool
+
+// RecordWriter is implemented by writers that take each match as its decoded
+// record. The processor hands a RecordWriter the record itself instead of
+// encoding it, so a writer that only reads a field or two skips the encoding
+// and the parse back.
+type RecordWriter interface {
+	io.Writer
+	WriteRecord(record map[string]interface{}) error
+}
+
+// matchWriter writes each match that keep lets through to w, encoded as one
+// JSON line or, when w is a RecordWriter, as the record itself
+type matchWriter struct {
+	encoder *json.Encoder
+	records RecordWriter // nil unless w takes records
+	keep    func(match map[string]interface{}) bool
+}
+
+func newMatchWriter(w io.Writer, keep func(match map[string]interface{}) bool) *matchWriter {
+	records, _ := w.(RecordWriter)
+	return &matchWriter{encoder: json.NewEncoder(w), records: records, keep: keep}
+}
+
+// write writes match unless keep drops it, and reports whether it did
+func (mw *matchWriter) write(match map[string]interface{}) (bool, error) {
+	if mw.keep != nil && !mw.keep(match) {
+		return false, nil
+	}
+	if mw.records != nil {
+		return true, mw.records.WriteRecord(match)
+	}
+	return true, mw.encoder.Encode(match)
+}
+
+// BillingCodePredicate matches records whose billing_code is one of codes
+func BillingCodePredicate(codes map[string]bool) MatchPredicate {
+	return func(record map[string]interface{}) bool {
+		code, ok := record["billing_code"].(string)
+		return ok && codes[code]
+	}
+}
+
+// All combines predicates; a record matches only if every predicate matches.
+// Predicates are evaluated in order, so cheap checks such as billing_code should come first.
+func All(predicates ...MatchPredicate) MatchPredicate {
+	return func(record map[string]interface{}) bool {
+		for _, predicate := range predicates {
+			if !predicate(record) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// BillingCodeTypePredicate matches records whose billing_code_type equals
+// codeType, ignoring case
+func BillingCodeTypePredicate(codeType string) MatchPredicate {
+	return func(record map[string]interface{}) bool {
+		got, ok := record["billing_code_type"].(string)
+		return ok && strings.EqualFold(got, codeType)
+	}
+}
+
+// NegotiatedPricePredicate matches records with at least one
+// negotiated_rates[].negotiated_prices[] entry whose fields equal every value in want
+func NegotiatedPricePredicate(want map[string]string) MatchPredicate {
+	return func(record map[string]interface{}) bool {
+		rates, _ := record["negotiated_rates"].([]interface{})
+		for _, rate := range rates {
+			rateObj, ok := rate.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			prices, _ := rateObj["negotiated_prices"].([]interface{})
+			for _, price := range prices {
+				priceObj, ok := price.(map[string]interface{})
+				if ok && priceFieldsMatch(priceObj, want) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// priceFieldsMatch reports whether every wanted field has the wanted string value
+func priceFieldsMatch(price map[string]interface{}, want map[string]string) bool {
+	for field, value := range want {
+		if got, ok := price[field].(string); !ok || got != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Stats summarizes a ProcessMatches run
+type Stats struct {
+	Matches        int  // records written to the output
+	NestedMatches  int  // of Matches, those found by the recursive fallback
+	RecordsScanned int  // top-level records decoded from the stream
+	MalformedLines int  // JSON Lines input lines that failed to parse
+	SkippedRecords int  // records skipped because they could not be decoded
+	SkippedBOM     bool // the stream started with a UTF-8 byte order mark
+
+	OversizedRecords int // records skipped for exceeding MaxRecordBytes
+	ExcludedRecords  int // matches dropped for a billing_code in ExcludeCodes
+
+	UnresolvedPointers int // matches written whole because Extract did not resolve in them
+}
+
+// maxJSONLineSize bounds a single line in JSON Lines input
+const maxJSONLineSize = 256 * 1024 * 1024
+
+// FindMatchingObjectsRecursive recursively searches for objects satisfying match.
+// Used as a fallback for JSON files that are not a simple array of records.
+func FindMatchingObjectsRecursive(data interface{}, match MatchPredicate) []map[string]interface{} {
+	var matches []map[string]interface{}
+
+	var search func(d interface{})
+	search = func(d interface{}) {
+		switch v := d.(type) {
+		case map[string]interface{}:
+			// Check if this object itself is a match.
+			if match(v) {
+				matches = append(matches, v)
+			}
+			// Recursively search all values in the map.
+			for _, val := range v {
+				search(val)
+			}
+		case []interface{}:
+			// Recursively search all elements in the slice.
+			for _, item := range v {
+				search(item)
+			}
+		}
+	}
+
+	search(data)
+	return matches
+}
+
+// StreamingGzipProcessor provides streaming processing of gzip files
+type StreamingGzipProcessor struct {
+	reader     *bufio.Reader // the decompressed JSON; every read goes through it
+	decoder    *json.Decoder
+	gzipReader *gzip.Reader // nil for uncompressed input
+	file       *os.File
+	match      MatchPredicate
+
+	// SkipBadRecords skips records that are valid JSON but not objects instead
+	// of failing the file. Syntax errors still fail it, as the decoder cannot
+	// resynchronise after one; with MaxRecordBytes set, a record read whole
+	// that then fails to decode for any other reason is skipped too.
+	SkipBadRecords bool
+
+	// MaxRecordBytes, when positive, skips records whose JSON is longer than
+	// this. They are read as raw bytes first, so a skipped record never becomes
+	// a map, which for large records takes many times its encoded size. Each
+	// top-level value is one record, so a whole-file MRF object counts as one.
+	MaxRecordBytes int64
+
+	// ExcludeCodes drops records that match but whose billing_code is listed,
+	// so a large code list can leave out a few codes. Nil excludes nothing.
+	ExcludeCodes map[string]bool
+
+	// Extract, when not empty, writes only the part of each match it points
+	// to, as {"billing_code": ..., <last pointer token>: part}, to shrink the
+	// output. A match it does not resolve in is written whole and counted in
+	// Stats.UnresolvedPointers.
+	Extract JSONPointer
+
+	// Workers, when above 1, matches and encodes the records of a top-level
+	// array on this many goroutines while the decoder reads ahead. It only pays
+	// when matching outweighs decoding; the predicate must be safe for
+	// concurrent use.
+	Workers int
+
+	// Keep, when set, is asked about each match just before it is written, in
+	// output order, and drops those it rejects; they are not counted in
+	// Stats.Matches. Unlike the predicate, which the recursive fallback may run
+	// again on the same objects, it is asked exactly once per match, so it can
+	// keep state such as a sampler's generator.
+	Keep func(match map[string]interface{}) bool
+
+	// Visit, when set, is called once with every record decoded from the
+	// input, before it is matched, on the goroutine reading the input. Unlike
+	// the predicate, which the recursive fallback may run again on the same
+	// objects, it sees each record exactly once.
+	Visit func(record map[string]interface{})
+}
+
+// scanned counts a decoded record and hands it to Visit
+func (sgp *StreamingGzipProcessor) scanned(record map[string]interface{}, stats *Stats) {
+	stats.RecordsScanned++
+	if sgp.Visit != nil {
+		sgp.Visit(record)
+	}
+}
+
+// DefaultBufferSize is the size of the buffer the decompressed JSON is read through
+const DefaultBufferSize = 64 * 1024 // 64KB
+
+// MinBufferSize is the smallest buffer size worth configuring; smaller
+// buffers mean a system call for every few records
+const MinBufferSize = 4 * 1024 // 4KB
+
+// NewStreamingGzipProcessor creates a streaming processor reading gzip data from r.
+// The caller remains responsible for closing r.
+func NewStreamingGzipProcessor(r io.Reader, match MatchPredicate) (*StreamingGzipProcessor, error) {
+	return NewStreamingGzipProcessorSize(r, match, DefaultBufferSize)
+}
+
+// NewStreamingGzipProcessorSize is NewStreamingGzipProcessor reading the
+// decompressed JSON through a buffer of the given size
+func NewStreamingGzipProcessorSize(r io.Reader, match MatchPredicate, size int) (*StreamingGzipProcessor, error) {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+
+	sgp := NewStreamingProcessorSize(gzipReader, match, size)
+	sgp.gzipReader = gzipReader
+	return sgp, nil
+}
+
+// NewStreamingProcessor creates a streaming processor reading uncompressed JSON
+// from r. The caller remains responsible for closing r.
+func NewStreamingProcessor(r io.Reader, match MatchPredicate) *StreamingGzipProcessor {
+	return NewStreamingProcessorSize(r, match, DefaultBufferSize)
+}
+
+// NewStreamingProcessorSize is NewStreamingProcessor reading r through a
+// buffer of the given size
+func NewStreamingProcessorSize(r io.Reader, match MatchPredicate, size int) *StreamingGzipProcessor {
+	// The structure detection peeks through the same buffer the decoder
+	// reads, so nothing it looks at is lost
+	bufferedReader := bufio.NewReaderSize(r, size)
+	return &StreamingGzipProcessor{
+		reader:  bufferedReader,
+		decoder: json.NewDecoder(bufferedReader),
+		match:   match,
+	}
+}
+
+// OpenStreamingGzipProcessor creates a streaming processor for a gzip file on disk.
+// The file is closed together with the processor.
+func OpenStreamingGzipProcessor(gzipFilePath string, match MatchPredicate) (*StreamingGzipProcessor, error) {
+	file, err := os.Open(gzipFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gzip file: %w", err)
+	}
+
+	sgp, err := NewStreamingGzipProcessor(file, match)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	sgp.file = file
+
+	return sgp, nil
+}
+
+// Close closes all resources
+func (sgp *StreamingGzipProcessor) Close() error {
+	var gzipErr, fileErr error
+
+	if sgp.gzipReader != nil {
+		gzipErr = sgp.gzipReader.Close()
+	}
+	if sgp.file != nil {
+		fileErr = sgp.file.Close()
+	}
+
+	if gzipErr != nil {
+		return gzipErr
+	}
+	return fileErr
+}
+
+// ProcessMatches processes the gzip stream and writes matching objects to w as JSON Lines
+func (sgp *StreamingGzipProcessor) ProcessMatches(w io.Writer) (Stats, error) {
+	defer sgp.Close()
+
+	var stats Stats
+
+	// Check if the JSON starts with an array or object
+	firstByte, err := sgp.peekFirstNonWhitespace(&stats)
+	if err != nil {
+		return Stats{}, fmt.Errorf("failed to peek first byte: %w", err)
+	}
+
+	if firstByte == '[' {
+		// Process as JSON array
+		err = sgp.processArray(w, &stats)
+	} else if firstByte == '{' {
+		// Process as single object or stream of objects
+		err = sgp.processObjects(w, &stats)
+	} else {
+		return Stats{}, fmt.Errorf("unexpected JSON structure, starts with: %c", firstByte)
+	}
+
+	return stats, err
+}
+
+// ProcessJSONLines processes a gzip stream holding one JSON record per line.
+// Each line is matched directly without the recursive fallback, and malformed
+// lines are counted and skipped instead of aborting the file.
+func (sgp *StreamingGzipProcessor) ProcessJSONLines(w io.Writer) (Stats, error) {
+	defer sgp.Close()
+
+	var stats Stats
+	out := newMatchWriter(w, sgp.Keep)
+
+	stats.SkippedBOM = skipBOM(sgp.reader)
+	scanner := bufio.NewScanner(sgp.reader)
+	scanner.Buffer(make([]byte, 64*1024), maxJSONLineSize)
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if sgp.MaxRecordBytes > 0 && int64(len(line)) > sgp.MaxRecordBytes {
+			stats.OversizedRecords++
+			continue
+		}
+
+		var record map[string]interface{}
+		if err := json.Unmarshal(line, &record); err != nil {
+			stats.MalformedLines++
+			continue
+		}
+		sgp.scanned(record, &stats)
+
+		if matched, _ := sgp.matchRecord(record, &stats); matched {
+			written, err := out.write(sgp.output(record, &stats))
+			if err != nil {
+				return stats, fmt.Errorf("failed to write match: %v", err)
+			}
+			if written {
+				stats.Matches++
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return stats, fmt.Errorf("failed to read line: %w", err)
+	}
+
+	return stats, nil
+}
+
+// utf8BOM is the byte order mark some publishers write at the start of a file
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// skipBOM consumes a leading UTF-8 byte order mark, reporting whether there was one
+func skipBOM(reader *bufio.Reader) bool {
+	prefix, _ := reader.Peek(len(utf8BOM))
+	if !bytes.Equal(prefix, utf8BOM) {
+		return false
+	}
+	reader.Discard(len(utf8BOM))
+	return true
+}
+
+// peekFirstNonWhitespace looks ahead to find the first non-whitespace character,
+// skipping a leading byte order mark and recording it in stats. Leading
+// whitespace is discarded from the decoder's reader and the character itself
+// is left unread, however much whitespace precedes it.
+func (sgp *StreamingGzipProcessor) peekFirstNonWhitespace(stats *Stats) (byte, error) {
+	stats.SkippedBOM = skipBOM(sgp.reader)
+
+	for {
+		// Look at what is buffered, filling the buffer first if it is empty
+		n := sgp.reader.Buffered()
+		if n == 0 {
+			n = 1
+		}
+		buffered, err := sgp.reader.Peek(n)
+		for i, b := range buffered {
+			if !unicode.IsSpace(rune(b)) {
+				sgp.reader.Discard(i)
+				return b, nil
+			}
+		}
+		if err != nil {
+			return 0, err
+		}
+		sgp.reader.Discard(len(buffered))
+	}
+}
+
+// decodeRecord decodes the next value from the stream. With SkipBadRecords set,
+// a value that is not an object is counted and reported with ok false, as is
+// any value that fails to decode once it has been read whole, which needs
+// MaxRecordBytes. Syntax errors are always returned.
+// io.EOF is returned unwrapped.
+func (sgp *StreamingGzipProcessor) decodeRecord(stats *Stats) (record map[string]interface{}, ok bool, err error) {
+	// consumed is set once the decoder has read the whole value, so that any
+	// error from here on leaves it positioned at the next one
+	consumed := false
+	if sgp.MaxRecordBytes > 0 {
+		var raw json.RawMessage
+		if err = sgp.decoder.Decode(&raw); err == nil {
+			if int64(len(raw)) > sgp.MaxRecordBytes {
+				stats.OversizedRecords++
+				return nil, false, nil
+			}
+			consumed = true
+			err = json.Unmarshal(raw, &record)
+		}
+	} else {
+		err = sgp.decoder.Decode(&record)
+	}
+	if err == io.EOF {
+		return nil, false, err
+	}
+	if err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if sgp.SkipBadRecords && (consumed || errors.As(err, &typeErr)) {
+			stats.SkippedRecords++
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to decode record: %w", err)
+	}
+	return record, true, nil
+}
+
+// matchRecord reports whether record matches and is not excluded by
+// ExcludeCodes, and whether it was excluded, which is counted in stats
+func (sgp *StreamingGzipProcessor) matchRecord(record map[string]interface{}, stats *Stats) (matched, excluded bool) {
+	if !sgp.match(record) {
+		return false, false
+	}
+	if sgp.excluded(record) {
+		stats.ExcludedRecords++
+		return false, true
+	}
+	return true, false
+}
+
+// excluded reports whether record's billing_code is in ExcludeCodes
+func (sgp *StreamingGzipProcessor) excluded(record map[string]interface{}) bool {
+	if sgp.ExcludeCodes == nil {
+		return false
+	}
+	code, ok := record["billing_code"].(string)
+	return ok && sgp.ExcludeCodes[code]
+}
+
+// output returns what is written for a match: the match itself, or with
+// Extract set, the part of it the pointer refers to
+func (sgp *StreamingGzipProcessor) output(record map[string]interface{}, stats *Stats) map[string]interface{} {
+	if len(sgp.Extract) == 0 {
+		return record
+	}
+	part, ok := sgp.Extract.Resolve(record)
+	if !ok {
+		stats.UnresolvedPointers++
+		return record
+	}
+	// The billing code keeps the part identifiable
+	extracted := map[string]interface{}{sgp.Extract[len(sgp.Extract)-1]: part}
+	if code, ok := record["billing_code"]; ok {
+		extracted["billing_code"] = code
+	}
+	return extracted
+}
+
+// processArray processes a JSON array structure
+func (sgp *StreamingGzipProcessor) processArray(w io.Writer, stats *Stats) error {
+	// Consume opening bracket
+	token, err := sgp.decoder.Token()
+	if err != nil {
+		return fmt.Errorf("failed to read opening bracket: %w", err)
+	}
+
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("expected '[' but got %v", token)
+	}
+
+	if sgp.Workers > 1 {
+		if err := sgp.matchArrayParallel(w, stats); err != nil {
+			return err
+		}
+		return sgp.endArray()
+	}
+
+	out := newMatchWriter(w, sgp.Keep)
+
+	// Process array elements
+	for sgp.decoder.More() {
+		record, ok, err := sgp.decodeRecord(stats)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		sgp.scanned(record, stats)
+
+		// Check if this record matches our criteria
+		if matched, _ := sgp.matchRecord(record, stats); matched {
+			written, err := out.write(sgp.output(record, stats))
+			if err != nil {
+				return fmt.Errorf("failed to write match: %v", err)
+			}
+			if written {
+				stats.Matches++
+			}
+		}
+	}
+
+	return sgp.endArray()
+}
+
+// endArray consumes the closing bracket, then makes sure nothing follows the
+// array: trailing data means a damaged file, even after an empty []
+func (sgp *StreamingGzipProcessor) endArray() error {
+	if _, err := sgp.decoder.Token(); err != nil {
+		return fmt.Errorf("failed to read closing bracket: %w", err)
+	}
+	if token, err := sgp.decoder.Token(); err != io.EOF {
+		if err != nil {
+			return fmt.Errorf("invalid data after the array: %w", err)
+		}
+		return fmt.Errorf("unexpected %v after the array", token)
+	}
+
+	return nil
+}
+
+// processObjects processes individual JSON objects (single object or stream)
+func (sgp *StreamingGzipProcessor) processObjects(w io.Writer, stats *Stats) error {
+	out := newMatchWriter(w, sgp.Keep)
+
+	for {
+		record, ok, err := sgp.decodeRecord(stats)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		sgp.scanned(record, stats)
+
+		// Check if this record matches our criteria
+		matched, excluded := sgp.matchRecord(record, stats)
+		if matched {
+			written, err := out.write(sgp.output(record, stats))
+			if err != nil {
+				return fmt.Errorf("failed to write match: %v", err)
+			}
+			if written {
+				stats.Matches++
+			}
+		} else if !excluded {
+			// If the object itself isn't a match, search recursively
+			nestedMatches := FindMatchingObjectsRecursive(record, sgp.match)
+			for _, match := range nestedMatches {
+				if sgp.excluded(match) {
+					stats.ExcludedRecords++
+					continue
+				}
+				written, err := out.write(sgp.output(match, stats))
+				if err != nil {
+					return fmt.Errorf("failed to write nested match: %v", err)
+				}
+				if written {
+					stats.Matches++
+					stats.NestedMatches++
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+package matcher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// gzipped compresses data into a single gzip member
+func gzipped(t *testing.T, data string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+var testCodes = map[string]bool{"99283": true}
+
+func TestProcessMatchesArrayEnd(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		matches int
+		wantErr string
+	}{
+		{name: "empty array", input: `[]`},
+		{name: "trailing garbage", input: `[] x`, wantErr: "after the array"},
+		{name: "trailing value", input: `[{"billing_code":"99283"}] {}`, wantErr: "after the array"},
+		{name: "one match", input: `[{"billing_code":"99283"},{"billing_code":"1"}]`, matches: 1},
+		{name: "trailing whitespace", input: "[{\"billing_code\":\"99283\"}]\n\n", matches: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sgp, err := NewStreamingGzipProcessor(gzipped(t, tt.input), BillingCodePredicate(testCodes))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			stats, err := sgp.ProcessMatches(&out)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ProcessMatches error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ProcessMatches: %v", err)
+			}
+			if stats.Matches != tt.matches {
+				t.Errorf("Matches = %d, want %d", stats.Matches, tt.matches)
+			}
+			if lines := strings.Count(out.String(), "\n"); lines != tt.matches {
+				t.Errorf("wrote %d lines, want %d", lines, tt.matches)
+			}
+		})
+	}
+}
+
+func TestProcessMatchesSkipsBOM(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "array", input: "\xEF\xBB\xBF[{\"billing_code\":\"99283\"},{\"billing_code\":\"1\"}]"},
+		{name: "object", input: "\xEF\xBB\xBF{\"billing_code\":\"99283\"}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sgp, err := NewStreamingGzipProcessor(gzipped(t, tt.input), BillingCodePredicate(testCodes))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			stats, err := sgp.ProcessMatches(&out)
+			if err != nil {
+				t.Fatalf("ProcessMatches: %v", err)
+			}
+			if !stats.SkippedBOM {
+				t.Error("SkippedBOM = false, want true")
+			}
+			if stats.Matches != 1 {
+				t.Errorf("Matches = %d, want 1", stats.Matches)
+			}
+			if got, want := out.String(), "{\"billing_code\":\"99283\"}\n"; got != want {
+				t.Errorf("output = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestPeekFirstNonWhitespacePastBuffer(t *testing.T) {
+	// Far more leading whitespace than the buffer holds
+	padding := strings.Repeat(" \n\t\r", 50*1024)
+	for _, delim := range []string{"[", "{"} {
+		t.Run(delim, func(t *testing.T) {
+			input := padding + `{"billing_code":"99283"}`
+			if delim == "[" {
+				input = padding + `[{"billing_code":"99283"}]`
+			}
+			sgp := NewStreamingProcessorSize(strings.NewReader(input), BillingCodePredicate(testCodes), MinBufferSize)
+
+			var stats Stats
+			got, err := sgp.peekFirstNonWhitespace(&stats)
+			if err != nil {
+				t.Fatalf("peekFirstNonWhitespace: %v", err)
+			}
+			if string(got) != delim {
+				t.Fatalf("first byte = %q, want %q", got, delim)
+			}
+
+			var out bytes.Buffer
+			stats, err = sgp.ProcessMatches(&out)
+			if err != nil {
+				t.Fatalf("ProcessMatches: %v", err)
+			}
+			if stats.Matches != 1 {
+				t.Errorf("Matches = %d, want 1", stats.Matches)
+			}
+		})
+	}
+}
+
+func TestProcessMatchesSkipBadRecords(t *testing.T) {
+	tests := []struct {
+		name           string
+		input          string
+		maxRecordBytes int64
+		skipped        int
+		wantErr        string
+	}{
+		{name: "not an object", input: `[1,{"billing_code":"99283"},"x"]`, skipped: 2},
+		{name: "not an object read raw", input: `[1,{"billing_code":"99283"},"x"]`, maxRecordBytes: 1024, skipped: 2},
+		{name: "syntax error", input: `[{"billing_code":"99283"},{"billing_code":}]`, wantErr: "failed to decode record"},
+		{name: "syntax error read raw", input: `[{"billing_code":"99283"},{"billing_code":}]`, maxRecordBytes: 1024, wantErr: "failed to decode record"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sgp, err := NewStreamingGzipProcessor(gzipped(t, tt.input), BillingCodePredicate(testCodes))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sgp.SkipBadRecords = true
+			sgp.MaxRecordBytes = tt.maxRecordBytes
+			var out bytes.Buffer
+			stats, err := sgp.ProcessMatches(&out)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ProcessMatches error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ProcessMatches: %v", err)
+			}
+			if stats.SkippedRecords != tt.skipped {
+				t.Errorf("SkippedRecords = %d, want %d", stats.SkippedRecords, tt.skipped)
+			}
+			if stats.Matches != 1 {
+				t.Errorf("Matches = %d, want 1", stats.Matches)
+			}
+		})
+	}
+}
+
+// recordCollector is a RecordWriter that fails if a match is encoded for it
+type recordCollector struct {
+	codes []string
+}
+
+func (rc *recordCollector) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("encoded match written: %s", p)
+}
+
+func (rc *recordCollector) WriteRecord(record map[string]interface{}) error {
+	code, _ := record["billing_code"].(string)
+	rc.codes = append(rc.codes, code)
+	return nil
+}
+
+func TestProcessMatchesRecordWriter(t *testing.T) {
+	codes := map[string]bool{"1": true, "2": true}
+	input := `[{"billing_code":"1"},{"billing_code":"3"},{"billing_code":"2"},{"billing_code":"1"}]`
+	for _, workers := range []int{0, 4} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			sgp := NewStreamingProcessor(strings.NewReader(input), BillingCodePredicate(codes))
+			sgp.Workers = workers
+			var rc recordCollector
+			stats, err := sgp.ProcessMatches(&rc)
+			if err != nil {
+				t.Fatalf("ProcessMatches: %v", err)
+			}
+			if stats.Matches != 3 {
+				t.Errorf("Matches = %d, want 3", stats.Matches)
+			}
+			if got, want := strings.Join(rc.codes, ","), "1,2,1"; got != want {
+				t.Errorf("records = %s, want %s", got, want)
+			}
+		})
+	}
+}
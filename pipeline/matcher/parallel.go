@@ -0,0 +1,130 @@
+package matcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// recordJob is one array record handed to the matching goroutines. done is
+// buffered, so a worker never waits for the writer.
+type recordJob struct {
+	record map[string]interface{}
+	done   chan recordResult
+}
+
+// recordResult is a worker's verdict on one record
+type recordResult struct {
+	match map[string]interface{} // nil if the record did not match
+	data  []byte                 // the encoded match, unless written to a RecordWriter
+	stats Stats                  // only ExcludedRecords and UnresolvedPointers are counted
+	err   error
+}
+
+// matchArrayParallel reads the elements of an array whose opening bracket has
+// been consumed, matching and encoding them on sgp.Workers goroutines. The
+// decoder is not safe for concurrent use, so records are still decoded one at
+// a time here; matches are written in the order of the records, as they are
+// by the sequential loop.
+func (sgp *StreamingGzipProcessor) matchArrayParallel(w io.Writer, stats *Stats) error {
+	records, _ := w.(RecordWriter)
+	jobs := make(chan recordJob, sgp.Workers)
+	// Bounds how far decoding runs ahead of writing, and so the records held
+	ordered := make(chan recordJob, sgp.Workers*4)
+
+	var workers sync.WaitGroup
+	for i := 0; i < sgp.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for job := range jobs {
+				job.done <- sgp.encodeMatch(job.record, records == nil)
+			}
+		}()
+	}
+
+	// The writer owns w and its own counts until it has finished
+	var failed atomic.Bool
+	var written Stats
+	writeErr := make(chan error, 1)
+	go func() {
+		var err error
+		for job := range ordered {
+			result := <-job.done
+			if err != nil {
+				continue // drain, so the decoder is never left blocked
+			}
+			written.ExcludedRecords += result.stats.ExcludedRecords
+			written.UnresolvedPointers += result.stats.UnresolvedPointers
+			// Keep is asked here, so it sees the matches in order
+			if result.err == nil && result.match != nil && (sgp.Keep == nil || sgp.Keep(result.match)) {
+				if records != nil {
+					result.err = records.WriteRecord(result.match)
+				} else {
+					_, result.err = w.Write(result.data)
+				}
+				if result.err == nil {
+					written.Matches++
+				}
+			}
+			if result.err != nil {
+				err = fmt.Errorf("failed to write match: %v", result.err)
+				failed.Store(true)
+			}
+		}
+		writeErr <- err
+	}()
+
+	var decodeErr error
+	for !failed.Load() && sgp.decoder.More() {
+		record, ok, err := sgp.decodeRecord(stats)
+		if err != nil {
+			decodeErr = err
+			break
+		}
+		if !ok {
+			continue
+		}
+		sgp.scanned(record, stats)
+
+		job := recordJob{record: record, done: make(chan recordResult, 1)}
+		ordered <- job
+		jobs <- job
+	}
+	close(jobs)
+	close(ordered)
+	err := <-writeErr
+	workers.Wait()
+
+	stats.Matches += written.Matches
+	stats.ExcludedRecords += written.ExcludedRecords
+	stats.UnresolvedPointers += written.UnresolvedPointers
+
+	if decodeErr != nil {
+		return decodeErr
+	}
+	return err
+}
+
+// encodeMatch matches one record and, with encode set, encodes it as the
+// sequential loop's encoder would, newline included
+func (sgp *StreamingGzipProcessor) encodeMatch(record map[string]interface{}, encode bool) recordResult {
+	var result recordResult
+	if matched, _ := sgp.matchRecord(record, &result.stats); !matched {
+		return result
+	}
+	result.match = sgp.output(record, &result.stats)
+	if !encode {
+		return result
+	}
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(result.match); err != nil {
+		result.err = err
+		return result
+	}
+	result.data = buf.Bytes()
+	return result
+}
@@ -0,0 +1,73 @@
+package matcher
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JSONPointer is an RFC 6901 JSON Pointer, held as its unescaped reference
+// tokens. The empty pointer refers to the whole document.
+type JSONPointer []string
+
+// ParseJSONPointer parses the string form of a JSON Pointer, such as
+// /negotiated_rates/0/provider_groups
+func ParseJSONPointer(s string) (JSONPointer, error) {
+	if s == "" {
+		return JSONPointer{}, nil
+	}
+	if s[0] != '/' {
+		return nil, fmt.Errorf("JSON pointer %q must start with /", s)
+	}
+
+	tokens := strings.Split(s[1:], "/")
+	for i, token := range tokens {
+		for j := 0; j < len(token); j++ {
+			if token[j] == '~' && (j+1 == len(token) || (token[j+1] != '0' && token[j+1] != '1')) {
+				return nil, fmt.Errorf("JSON pointer %q: ~ must be followed by 0 or 1", s)
+			}
+		}
+		// ~1 first, so that ~01 becomes ~1 rather than /
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return JSONPointer(tokens), nil
+}
+
+// String returns the pointer in its escaped form
+func (p JSONPointer) String() string {
+	var b strings.Builder
+	for _, token := range p {
+		b.WriteByte('/')
+		b.WriteString(strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1"))
+	}
+	return b.String()
+}
+
+// Resolve returns the value the pointer refers to in a decoded JSON document,
+// and false if some token names a missing member or element
+func (p JSONPointer) Resolve(doc interface{}) (interface{}, bool) {
+	for _, token := range p {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			value, ok := v[token]
+			if !ok {
+				return nil, false
+			}
+			doc = value
+		case []interface{}:
+			// Indexes are plain decimals without leading zeros; "-", the
+			// element after the last, never exists to be read
+			if token == "" || (token[0] == '0' && len(token) > 1) {
+				return nil, false
+			}
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, false
+			}
+			doc = v[index]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
@@ -0,0 +1,189 @@
+package pipeline
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+)
+
+// Allowed-amount (out-of-network) MRF schema
+
+type OONProvider struct {
+	BilledCharge float64 `json:"billed_charge"`
+	NPI          []NPI   `json:"npi"`
+}
+
+type Payment struct {
+	AllowedAmount       float64       `json:"allowed_amount"`
+	BillingCodeModifier []string      `json:"billing_code_modifier"`
+	Providers           []OONProvider `json:"providers"`
+}
+
+type AllowedAmount struct {
+	TIN          TIN       `json:"tin"`
+	ServiceCode  []string  `json:"service_code"`
+	BillingClass string    `json:"billing_class"`
+	Payments     []Payment `json:"payments"`
+}
+
+type AllowedAmountRecord struct {
+	BillingCode            string          `json:"billing_code"`
+	BillingCodeType        string          `json:"billing_code_type"`
+	BillingCodeTypeVersion string          `json:"billing_code_type_version"`
+	Description            string          `json:"description"`
+	Name                   string          `json:"name"`
+	AllowedAmounts         []AllowedAmount `json:"allowed_amounts"`
+}
+
+// ExtractAllowedAmountsToCSV reads allowed-amount records from input and
+// writes one CSV row per payment and provider to matches.csv, after a UTF-8 byte
+// order mark when bom is set.
+func ExtractAllowedAmountsToCSV(input string, bom bool) {
+	slog.Info("starting allowed-amount CSV extraction", "input", input)
+
+	jsonlFile, err := openMatches(input)
+	if err != nil {
+		if os.IsNotExist(err) {
+			slog.Warn("matches not found, skipping CSV extraction", "input", input)
+			return
+		}
+		panic(err)
+	}
+	defer jsonlFile.Close()
+
+	var records []AllowedAmountRecord
+	lines := newJSONLReader(jsonlFile, input)
+
+	for {
+		raw, err := lines.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			panic(err)
+		}
+		var record AllowedAmountRecord
+		if err := json.Unmarshal(raw, &record); err != nil {
+			lines.skip(err.Error())
+			continue
+		}
+		records = append(records, record)
+	}
+	lines.logUnreadable()
+
+	slog.Info("loaded records", "count", len(records), "input", input)
+
+	if len(records) == 0 {
+		slog.Info("no records to process")
+		return
+	}
+
+	const MAX_SERVICE_CODES = 100
+
+	maxServiceCodes := 0
+	for _, record := range records {
+		for _, amount := range record.AllowedAmounts {
+			if len(amount.ServiceCode) > maxServiceCodes {
+				maxServiceCodes = len(amount.ServiceCode)
+			}
+		}
+	}
+	if maxServiceCodes > MAX_SERVICE_CODES {
+		slog.Info("limiting service code columns", "limit", MAX_SERVICE_CODES, "found", maxServiceCodes)
+		maxServiceCodes = MAX_SERVICE_CODES
+	}
+
+	csvColumns := []string{
+		"billing_code",
+		"billing_code_type",
+		"billing_code_type_version",
+		"name",
+		"allowed_amounts_count",
+		"tin_type",
+		"tin_value",
+		"billing_class",
+		"payments_count",
+		"allowed_amount",
+		"billing_code_modifier",
+		"providers_count",
+		"billed_charge",
+		"npi_count",
+	}
+	for i := 0; i < maxServiceCodes; i++ {
+		csvColumns = append(csvColumns, fmt.Sprintf("service_code_%d", i+1))
+	}
+
+	csvFile, err := os.Create("matches.csv")
+	if err != nil {
+		panic(err)
+	}
+	defer csvFile.Close()
+
+	if bom {
+		// Written to the file itself, ahead of anything the csv.Writer buffers
+		if _, err := csvFile.Write(csvBOM); err != nil {
+			panic(err)
+		}
+	}
+
+	writer := csv.NewWriter(csvFile)
+	defer writer.Flush()
+
+	if err := writer.Write(csvColumns); err != nil {
+		panic(err)
+	}
+
+	rowCount := 0
+	for _, record := range records {
+		for _, amount := range record.AllowedAmounts {
+			for _, payment := range amount.Payments {
+				// One row per provider; payments without providers still get a row
+				providers := payment.Providers
+				if len(providers) == 0 {
+					providers = []OONProvider{{}}
+				}
+
+				for _, provider := range providers {
+					row := make([]string, len(csvColumns))
+
+					row[0] = handleNullValues(record.BillingCode)
+					row[1] = handleNullValues(record.BillingCodeType)
+					row[2] = record.BillingCodeTypeVersion
+					row[3] = record.Name
+					row[4] = strconv.Itoa(len(record.AllowedAmounts))
+					row[5] = handleNullValues(amount.TIN.Type)
+					row[6] = handleNullValues(amount.TIN.Value)
+					row[7] = amount.BillingClass
+					row[8] = strconv.Itoa(len(amount.Payments))
+					row[9] = fmt.Sprintf("%.2f", payment.AllowedAmount)
+					if len(payment.BillingCodeModifier) > 0 {
+						row[10] = payment.BillingCodeModifier[0]
+					}
+					row[11] = strconv.Itoa(len(payment.Providers))
+					if len(payment.Providers) > 0 {
+						row[12] = fmt.Sprintf("%.2f", provider.BilledCharge)
+					}
+					row[13] = strconv.Itoa(len(provider.NPI))
+
+					serviceCodeStart := 14
+					for j, serviceCode := range amount.ServiceCode {
+						if j < maxServiceCodes {
+							row[serviceCodeStart+j] = handleNullValues(serviceCode)
+						}
+					}
+
+					if err := writer.Write(row); err != nil {
+						panic(err)
+					}
+					rowCount++
+				}
+			}
+		}
+	}
+
+	slog.Info("extracted rows", "rows", rowCount, "output", "matches.csv")
+}
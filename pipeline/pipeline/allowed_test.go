@@ -0,0 +1,19 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestOONProviderDecodesNPIs(t *testing.T) {
+	var provider OONProvider
+	data := `{"billed_charge": 100, "npi": [1234567893, "1987654321", 1.234567894e9]}`
+	if err := json.Unmarshal([]byte(data), &provider); err != nil {
+		t.Fatal(err)
+	}
+	want := []NPI{"1234567893", "1987654321", "1234567894"}
+	if !slices.Equal(provider.NPI, want) {
+		t.Errorf("NPI = %q, want %q", provider.NPI, want)
+	}
+}
@@ -0,0 +1,36 @@
+package pipeline
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// writeFileAtomic writes a file through write into path+".tmp" and renames it
+// over path, so a crash mid-write leaves the previous version intact instead
+// of a truncated one
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	err = write(file)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write %s: %v", tmpPath, err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// schemaAuditor compares raw records against the fields a schema struct models
+// and logs each distinct unknown or missing field once.
+type schemaAuditor struct {
+	known    map[string]bool // dot paths modelled by the schema
+	required []string        // top-level fields the schema expects
+	reported map[string]bool
+	unknown  int
+	missing  int
+}
+
+func newSchemaAuditor(schema interface{}) *schemaAuditor {
+	a := &schemaAuditor{
+		known:    make(map[string]bool),
+		reported: make(map[string]bool),
+	}
+	a.addFields(reflect.TypeOf(schema), "", true)
+	sort.Strings(a.required)
+	return a
+}
+
+// addFields records the json paths of a struct type, descending into nested
+// structs and slice elements
+func (a *schemaAuditor) addFields(t reflect.Type, prefix string, top bool) {
+	for t.Kind() == reflect.Slice || t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		a.known[path] = true
+		if top {
+			a.required = append(a.required, name)
+		}
+		a.addFields(t.Field(i).Type, path, false)
+	}
+}
+
+// audit checks one raw record against the schema
+func (a *schemaAuditor) audit(raw json.RawMessage) {
+	var record map[string]interface{}
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return
+	}
+
+	a.walk(record, "")
+
+	for _, field := range a.required {
+		if _, ok := record[field]; !ok && !a.reported["missing:"+field] {
+			a.reported["missing:"+field] = true
+			a.missing++
+			slog.Warn("record is missing a schema field", "field", field, "billing_code", record["billing_code"])
+		}
+	}
+}
+
+func (a *schemaAuditor) walk(value interface{}, prefix string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range v {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			if !a.known[path] {
+				if !a.reported[path] {
+					a.reported[path] = true
+					a.unknown++
+					slog.Warn("record has a field the schema does not model", "field", path)
+				}
+				continue
+			}
+			a.walk(nested, path)
+		}
+	case []interface{}:
+		for _, item := range v {
+			a.walk(item, prefix)
+		}
+	}
+}
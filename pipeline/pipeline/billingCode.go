@@ -0,0 +1,1202 @@
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"logger"
+	"scraper/downloader"
+	"search/matcher"
+)
+
+var targetCodes = map[string]bool{
+	"99283": true,
+	"99284": true,
+	"99285": true,
+	"99291": true,
+}
+
+// processedFilesLog is the file that tracks processed files
+const processedFilesLog = "processed_files.json"
+
+// loadProcessedFiles loads the processed files and their content hashes from the log.
+// Logs written before hashes were recorded hold a plain list of names; those
+// entries are migrated with an empty hash.
+func loadProcessedFiles() (map[string]string, error) {
+	files := make(map[string]string)
+	file, err := os.Open(processedFilesLog)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return files, nil // No log yet
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	// Check if file is empty
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fileInfo.Size() == 0 {
+		return files, nil // Empty log, treat as no files processed
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(file).Decode(&raw); err != nil {
+		if err == io.EOF {
+			return files, nil
+		}
+		return nil, err
+	}
+
+	// Current format: {"name": "hash"}
+	if err := json.Unmarshal(raw, &files); err == nil {
+		return files, nil
+	}
+
+	// Old format: ["name", ...]
+	var fileList []string
+	if err := json.Unmarshal(raw, &fileList); err != nil {
+		return nil, fmt.Errorf("unrecognized %s format: %v", processedFilesLog, err)
+	}
+	files = make(map[string]string, len(fileList))
+	for _, f := range fileList {
+		files[f] = ""
+	}
+	slog.Info("migrated processed files log to name/hash format", "entries", len(files))
+	return files, nil
+}
+
+// saveProcessedFiles saves the processed files and their content hashes to the log
+func saveProcessedFiles(files map[string]string) error {
+	return writeFileAtomic(processedFilesLog, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(files)
+	})
+}
+
+// processedLogCheckpoint is how often the processed files log is saved while
+// files are being processed, so an interrupted run keeps what it finished
+const processedLogCheckpoint = 30 * time.Second
+
+// processJSONFileAndWriteMatches processes regular JSON files (legacy function for non-gzip files) - COMMENTED OUT
+// func processJSONFileAndWriteMatches(filePath string, writer *bufio.Writer) (int, error) {
+// 	file, err := os.Open(filePath)
+// 	if err != nil {
+// 		return 0, err
+// 	}
+// 	defer file.Close()
+//
+// 	// Use a buffered reader to allow peeking at the first characters without consuming them.
+// 	br := bufio.NewReader(file)
+// 	var firstChar byte
+//
+// 	// Loop to skip any leading whitespace and find the first actual character.
+// 	for {
+// 		b, err := br.ReadByte()
+// 		if err != nil {
+// 			if err == io.EOF {
+// 				return 0, nil // File is empty, which is not an error.
+// 			}
+// 			return 0, err
+// 		}
+// 		if !unicode.IsSpace(rune(b)) {
+// 			firstChar = b
+// 			break
+// 		}
+// 	}
+//
+// 	// Put the character back into the reader stream so the JSON decoder can see it.
+// 	if err := br.UnreadByte(); err != nil {
+// 		return 0, err
+// 	}
+//
+// 	decoder := json.NewDecoder(br)
+// 	encoder := json.NewEncoder(writer)
+// 	count := 0
+//
+// 	// Handle file based on whether it's a JSON array or object.
+// 	if firstChar == '[' {
+// 		// It's an array. Consume the opening '['.
+// 		if _, err := decoder.Token(); err != nil {
+// 			return 0, fmt.Errorf("failed to read opening `[`: %w", err)
+// 		}
+//
+// 		// Loop through the array elements as long as there are more.
+// 		for decoder.More() {
+// 			var record map[string]interface{}
+// 			if err := decoder.Decode(&record); err != nil {
+// 				fmt.Printf("\nWarning: could not decode an object in %s: %v. Skipping object.", filepath.Base(filePath), err)
+// 				continue
+// 			}
+//
+// 			if billingCode, exists := record["billing_code"].(string); exists && targetCodes[billingCode] {
+// 				if err := encoder.Encode(record); err != nil {
+// 					return count, fmt.Errorf("failed to write matched record to output: %w", err)
+// 				}
+// 				count++
+// 			}
+// 		}
+// 	} else if firstChar == '{' {
+// 		// The file starts with an object. It could be a single large object,
+// 		// or a stream of objects (JSON Lines format). We'll process it as a stream
+// 		// by decoding objects one by one until we reach the end of the file.
+// 		for {
+// 			var record map[string]interface{}
+// 			if err := decoder.Decode(&record); err != nil {
+// 				if err == io.EOF {
+// 					break // End of file, we're done.
+// 				}
+// 				// If there's an error, we'll stop processing this file.
+// 				fmt.Printf("\nWarning: could not decode an object in %s: %v. File may be malformed.", filepath.Base(filePath), err)
+// 				break
+// 			}
+//
+// 			// We have a single decoded object. Check if it's a match.
+// 			if billingCode, exists := record["billing_code"].(string); exists && targetCodes[billingCode] {
+// 				if err := encoder.Encode(record); err != nil {
+// 					return count, fmt.Errorf("failed to write matched record to output: %w", err)
+// 				}
+// 				count++
+// 			} else {
+// 				// If the object itself isn't a match, it might contain matches within it.
+// 				// This handles cases where records are nested inside a larger structure.
+// 				nestedMatches := findMatchingObjectsRecursive(record)
+// 				for _, match := range nestedMatches {
+// 					if err := encoder.Encode(match); err != nil {
+// 						return count, fmt.Errorf("failed to write matched record from object: %w", err)
+// 					}
+// 					count++
+// 				}
+// 			}
+// 		}
+// 	} else {
+// 		return 0, fmt.Errorf("file does not appear to be valid JSON (starts with %c)", firstChar)
+// 	}
+//
+// 	return count, nil
+// }
+
+// A result struct to pass information back from workers.
+type result struct {
+	fileName  string
+	hash      string // SHA-256 of the input file, computed while streaming
+	stats     matcher.Stats
+	err       error
+	workerID  int
+	bytesRead int64         // compressed bytes read from the input file
+	duration  time.Duration // time spent processing the file
+	cutOff    bool          // the run was cancelled before the file was fully processed
+}
+
+// workerOptions holds the per-run settings shared by all workers.
+type workerOptions struct {
+	match     matcher.MatchPredicate
+	jsonLines bool // treat every input as JSON Lines, not just *.jsonl.gz
+	// called once with every decoded record, as -list-codes tallies (nil = none)
+	visit func(record map[string]interface{})
+	// asked once about each match before it is written (nil = keep all)
+	keep func(match map[string]interface{}) bool
+	// skip records that are not JSON objects instead of failing the file
+	skipBadRecords bool
+	// skip records longer than this many bytes (0 = unlimited)
+	maxRecordBytes int64
+	// drop matches with these billing codes (nil = none)
+	excludeCodes map[string]bool
+	// write only this part of each match (empty = the whole match)
+	extractPointer matcher.JSONPointer
+	// extra attempts for files failing with transient errors
+	fileRetries int
+	// spool each file's matches and write them only once the file completes,
+	// so a file cut off by -max-runtime or -limit leaves none behind
+	spoolMatches bool
+	// the -limit writer, which spooled files are checked against (nil = no limit)
+	limit *limitWriter
+	// whether a spooled match will reach the limit writer (nil = every match)
+	limitCounts func(p []byte) bool
+	// size of the buffer each input's JSON is read through
+	bufferSize int
+	// goroutines matching the records of one array file (0 or 1 = the file's worker alone)
+	intraFileWorkers int
+
+	// save each input's decompressed JSON in this directory ("" = don't)
+	teeDir string
+	// the name of each input's decompressed file in teeDir
+	teeNames map[string]teeName
+
+	// Remote (http/https) inputs
+	fetchTimeout time.Duration
+	retry        downloader.RetryConfig
+}
+
+// isJSONLinesFile reports whether a path names a gzipped JSON Lines file.
+func isJSONLinesFile(filePath string) bool {
+	lower := strings.ToLower(filePath)
+	return strings.HasSuffix(lower, ".jsonl.gz") || strings.HasSuffix(lower, ".ndjson.gz")
+}
+
+// worker is the function that will be run concurrently.
+// It reads file paths from the jobs channel, processes them, and sends the result to the results channel.
+func worker(ctx context.Context, id int, jobs <-chan string, results chan<- result, writer outputWriter, writerMutex *sync.Mutex, opts workerOptions) {
+	for filePath := range jobs {
+		// Each worker locks the writer before processing a file to ensure that
+		// all writes from a single file are contiguous and not interleaved with other workers.
+		writerMutex.Lock()
+
+		// Leave remaining files untouched once the run is cancelled
+		if ctx.Err() != nil {
+			writerMutex.Unlock()
+			results <- result{fileName: fileKey(filePath), workerID: id, cutOff: true}
+			continue
+		}
+
+		// Process gzip files only (JSON file processing commented out)
+		var stats matcher.Stats
+		var hash string
+		var bytesRead int64
+		var err error
+		start := time.Now()
+
+		if isURL(filePath) || strings.HasSuffix(strings.ToLower(filePath), ".gz") {
+			// Process gzip file directly with streaming
+			stats, hash, err = processFileWithRetries(ctx, filePath, writer, opts, &bytesRead)
+		} else {
+			// Process regular JSON file (legacy path) - COMMENTED OUT
+			// recordsFound, err = processJSONFileAndWriteMatches(filePath, writer)
+			err = fmt.Errorf("JSON file processing is disabled - only processing .gz files")
+		}
+
+		// Flush the buffer after each file
+		if flushErr := writer.Flush(); flushErr != nil && err == nil {
+			err = fmt.Errorf("failed to flush writer: %v", flushErr)
+		}
+
+		writerMutex.Unlock()
+
+		results <- result{
+			fileName:  fileKey(filePath),
+			hash:      hash,
+			stats:     stats,
+			err:       err,
+			workerID:  id,
+			bytesRead: bytesRead,
+			duration:  time.Since(start),
+			// A file that failed after cancellation was cut off, not broken
+			cutOff: err != nil && ctx.Err() != nil,
+		}
+	}
+}
+
+// buildMatchPredicate combines the billing_code check with the optional
+// billing_code_type and negotiated price filters, which only run after a billing_code hit
+func buildMatchPredicate(codeType, negotiatedType, billingClass string) matcher.MatchPredicate {
+	predicates := []matcher.MatchPredicate{matcher.BillingCodePredicate(targetCodes)}
+	if codeType != "" {
+		predicates = append(predicates, matcher.BillingCodeTypePredicate(codeType))
+	}
+
+	priceFields := make(map[string]string)
+	if negotiatedType != "" {
+		priceFields["negotiated_type"] = negotiatedType
+	}
+	if billingClass != "" {
+		priceFields["billing_class"] = billingClass
+	}
+	if len(priceFields) > 0 {
+		predicates = append(predicates, matcher.NegotiatedPricePredicate(priceFields))
+	}
+
+	return matcher.All(predicates...)
+}
+
+// saveLogs writes the processed-files and quarantine logs. Basename-only
+// entries from older logs were re-keyed by path if they matched a file in
+// this run; the rest are not carried forward.
+func saveLogs(processedFiles map[string]string, quarantine map[string]quarantineEntry) {
+	if dropped := dropLegacyKeys(processedFiles) + dropLegacyKeys(quarantine); dropped > 0 {
+		slog.Info("migrated processed files and quarantine logs to path keys", "basename_entries", dropped)
+	}
+	if err := saveProcessedFiles(processedFiles); err != nil {
+		slog.Warn("could not update processed files log", "log", processedFilesLog, "error", err)
+	}
+	if err := saveQuarantine(quarantine); err != nil {
+		slog.Warn("could not update quarantine log", "log", quarantineLog, "error", err)
+	}
+}
+
+// Main runs the pipeline on the command-line arguments args; name is the
+// program name shown in its usage message
+func Main(name string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	var logConfig logger.Config
+	logConfig.RegisterFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "list the files that would be processed or skipped, then exit without writing output")
+	codeType := fs.String("code-type", "", "only match records whose billing_code_type is this type (e.g. CPT)")
+	negotiatedType := fs.String("negotiated-type", "", "only match records with a negotiated price of this negotiated_type")
+	billingClass := fs.String("billing-class", "", "only match records with a negotiated price of this billing_class")
+	mode := fs.String("mode", "in-network", "MRF schema of the input files: in-network or allowed-amount")
+	jsonLines := fs.Bool("jsonl", false, "treat every input file as JSON Lines (one record per line)")
+	rehash := fs.Bool("rehash", false, "recompute content hashes of every logged file instead of only files modified since the last run")
+	metricsFile := fs.String("metrics", "", "write run throughput metrics to this JSON file")
+	notExpired := fs.Bool("not-expired", false, "skip negotiated prices whose expiration_date is before today (or -as-of)")
+	asOf := fs.String("as-of", "", "reference date for -not-expired, as YYYY-MM-DD (implies -not-expired)")
+	countOnly := fs.Bool("count-only", false, "only count matches per billing code into "+countsFile+", without writing matches.jsonl or any -format output; every file is counted and "+processedFilesLog+" is left unchanged")
+	listCodes := fs.Bool("list-codes", false, "tally every billing_code in the input into "+codeHistogramFile+", ignoring the match filters and writing no matches; every file is read and "+processedFilesLog+" is left unchanged")
+	listCodesByType := fs.Bool("list-codes-by-type", false, "with -list-codes, tally each billing_code_type separately (implies -list-codes)")
+	partitionByCode := fs.Bool("partition-by-code", false, "write matches to one matches-<billing_code>.jsonl file per code instead of matches.jsonl")
+	auditSchema := fs.Bool("audit-schema", false, "warn about fields in matched records that the CSV schema does not model")
+	dedupeRows := fs.Bool("dedupe-rows", false, "skip CSV or Parquet rows identical to one already written")
+	dedupBloom := fs.Bool("dedup-bloom", false, "deduplicate rows with a fixed-size Bloom filter instead of an exact set (implies -dedupe-rows; may rarely drop a distinct row)")
+	dedupExpected := fs.Int("dedup-expected", 10000000, "number of distinct rows to size the -dedup-bloom filter for")
+	dedupFPRate := fs.Float64("dedup-fp-rate", 0.001, "target false-positive rate of the -dedup-bloom filter at -dedup-expected rows")
+	manifest := fs.String("manifest", "", "read input files from this NDJSON manifest of {path, expected_hash} lines instead of scanning ../scraper/downloads")
+	fetchTimeout := fs.Duration("fetch-timeout", 30*time.Minute, "deadline for fetching and processing each http(s) input")
+	maxRecordBytes := fs.Int64("max-record-bytes", 0, "skip and count records whose JSON is longer than this many bytes (0 = unlimited); a file that is one top-level object is one record")
+	skipBadRecords := fs.Bool("skip-bad-records", false, "skip and count records that are valid JSON but not objects instead of failing the whole file; malformed JSON still fails it, as the stream cannot be resynchronised after a syntax error")
+	limit := fs.Int("limit", 0, "stop after writing this many matches across all workers (0 = no limit); a file whose matches would pass the limit writes none of them and is left for the next run")
+	verify := fs.Bool("verify", false, "re-check every record in matches.jsonl against the match filters, then exit")
+	codesCSV := fs.String("codes-csv", "", "load the billing codes to match from this CSV file instead of the built-in list")
+	excludeCodes := fs.String("exclude-codes", "", "drop matches whose billing_code is listed (comma-separated, or @file with one per line), e.g. a few noisy codes of a large -codes-csv list")
+	codesColumn := fs.String("codes-column", "billing_code", "column of -codes-csv holding the codes, by header name or 1-based number")
+	tinAllow := fs.String("tin-allow", "", "only write CSV rows whose provider group TIN is listed (comma-separated, or @file with one per line)")
+	npiFile := fs.String("npi-file", "", "only keep provider groups with an NPI listed in this file (one per line), and the CSV or Parquet rows and records left with one")
+	tinDeny := fs.String("tin-deny", "", "drop CSV rows whose provider group TIN is listed (comma-separated, or @file with one per line)")
+	dropEmpty := fs.Bool("drop-empty-columns", false, "after writing matches.csv, remove the service_code_N and provider_reference_N columns that are empty in every row (an extra pass over the CSV)")
+	columnsManifest := fs.Bool("columns-manifest", false, "also write "+columnsManifestFile+" describing each matches.csv column")
+	fileRetries := fs.Int("file-retries", 0, "retry files that fail with transient read errors (I/O errors, dropped connections, timeouts) this many times, with exponential backoff; missing files, corrupt gzip and malformed JSON are not retried")
+	diffAgainst := fs.String("diff-against", "", "only write matches whose identity is not already in this previous matches file")
+	diffKeys := fs.String("diff-keys", "", "comma-separated top-level fields that identify a record for -diff-against (default: the whole record)")
+	quiet := fs.Bool("quiet", false, "suppress the terminal progress display")
+	retryQuarantined := fs.Bool("retry-quarantined", false, "process files listed in "+quarantineLog+" again")
+	inputGlob := fs.String("input-glob", "", "process files matching this pattern instead of the .gz files in ../scraper/downloads; ** matches any number of directories (e.g. data/**/*.gz)")
+	schemaPath := fs.String("schema", "", "validate each matched record against this JSON Schema file; failures go to "+schemaFailuresFile+" instead of the matches")
+	mergeOut := fs.String("merge", "", "merge the CSV files given as arguments (e.g. matches.csv from several shards) into this file under the union of their columns, then exit")
+	serveAddr := fs.String("serve", "", "instead of processing files, serve POST /match and POST /format on this address (e.g. :8080)")
+	serveMaxBody := fs.Int64("serve-max-body", defaultMaxRequestBodySize, "with -serve, reject request bodies longer than this many bytes, and /format documents that decompress to more, with 413")
+	validServiceCodes := fs.String("valid-service-codes", "", "file of valid service codes, one per line; other service_code values are written as N/A in the CSV and left out in Parquet")
+	resume := fs.Bool("resume", false, "continue an interrupted matches.csv extraction from "+extractCheckpointFile+", appending to matches.csv; with no new files to process, goes straight to the extraction")
+	strict := fs.Bool("strict", false, "stop at the first file that fails and exit non-zero without updating "+processedFilesLog+" or "+quarantineLog+" (matches already written stay in matches.jsonl)")
+	sampleRate := fs.Float64("sample-rate", 1, "keep each matching record with this probability (e.g. 0.01 for a 1% sample spread over the whole input); 1 keeps every match")
+	seed := fs.Uint64("seed", 0, "random seed for -sample-rate, to reproduce a sample with the same input and -workers 1 (0 = pick one and log it)")
+	streamCSV := fs.Bool("stream-csv", false, "write matches.csv while matches are read, with every service code and provider reference column up to the limits, instead of loading every record to size the columns (pair with -drop-empty-columns to trim them)")
+	rowHash := fs.Bool("row-hash", false, "append a "+rowHashColumn+" column to matches.csv holding the SHA-256 of each row's other field values")
+	teeDecompressed := fs.String("tee-decompressed", "", "also save each input's decompressed JSON in this directory (e.g. ../decompress/output) while matching it, instead of a separate decompress pass")
+	preflight := fs.Bool("preflight", false, "check the inputs, that the first file decompresses and starts like JSON records, the logs and the output paths, print a readiness report and exit without processing")
+	writeBOM := fs.Bool("csv-bom", false, "start matches.csv with a UTF-8 byte order mark so Excel reads accented names correctly")
+	compressOutput := fs.Bool("compress-output", false, "write matches gzipped to matches.jsonl.gz instead of matches.jsonl; each run appends a gzip member and the -format output is read from it")
+	columnList := fs.String("columns", "", "comma-separated matches.csv columns to write, in this order, e.g. billing_code,name,negotiated_rate,service_code_1; service_code and provider_reference stand for all of their numbered columns (default: all)")
+	withDescription := fs.Bool("with-description", false, "add a description column to matches.csv")
+	percentageColumn := fs.Bool("percentage-column", false, "add a negotiated_percentage column to matches.csv after negotiated_rate, holding the rate of prices whose negotiated_type is percentage in place of negotiated_rate")
+	includeColumns := fs.String("include-columns", "", "comma-separated matches.csv columns to write, or @file with one per line; service_code and provider_reference stand for all of their numbered columns (default: all)")
+	excludeColumns := fs.String("exclude-columns", "", "comma-separated matches.csv columns to leave out, or @file with one per line; service_code and provider_reference stand for all of their numbered columns")
+	extractPointer := fs.String("extract-pointer", "", "write only the part of each match this RFC 6901 JSON pointer refers to (e.g. /negotiated_rates), with its billing_code; matches it does not resolve in are written whole")
+	bufferSize := fs.Int("buffer-size", matcher.DefaultBufferSize, "size in bytes of the buffers each input is read through and matches are written through; larger buffers can help on fast disks")
+	intraFileWorkers := fs.Int("intra-file-workers", 0, "match the records of each array file on this many goroutines while one decodes; helps when a few huge files dominate, and matches keep their order (0 = off)")
+	maxRuntime := fs.Duration("max-runtime", 0, "stop processing after this long (e.g. 2h), leaving unfinished files for the next run; files in progress are abandoned without writing their matches (0 = no deadline)")
+	truncate := fs.Bool("truncate", false, "start a clean run: overwrite matches.jsonl (or the partition files written) and reprocess every file, ignoring "+processedFilesLog)
+	workers := fs.Int("workers", 0, "number of files processed concurrently (0 = one per CPU)")
+	format := fs.String("format", formatCSV, "final output: jsonl (matches.jsonl only), json (pretty array, streamed), csv (buffered in memory) or parquet (in-network only, buffered per row group)")
+	fs.Parse(args)
+	started := time.Now()
+
+	if err := logger.Init(logConfig); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	if *codesCSV != "" {
+		codes, err := loadCodesCSV(*codesCSV, *codesColumn)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -codes-csv: %v\n", err)
+			os.Exit(2)
+		}
+		targetCodes = codes
+		slog.Info("loaded billing codes", "file", *codesCSV, "column", *codesColumn, "count", len(codes))
+	}
+	excludedCodes, err := parseListFlag(*excludeCodes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -exclude-codes: %v\n", err)
+		os.Exit(2)
+	}
+	pointer, err := matcher.ParseJSONPointer(*extractPointer)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -extract-pointer: %v\n", err)
+		os.Exit(2)
+	}
+	if excludedCodes != nil {
+		slog.Info("excluding billing codes", "count", len(excludedCodes))
+	}
+
+	if *dedupBloom {
+		if *dedupExpected < 1 {
+			fmt.Fprintf(os.Stderr, "Error: -dedup-expected must be at least 1\n")
+			os.Exit(2)
+		}
+		if *dedupFPRate <= 0 || *dedupFPRate >= 1 {
+			fmt.Fprintf(os.Stderr, "Error: -dedup-fp-rate must be between 0 and 1\n")
+			os.Exit(2)
+		}
+		*dedupeRows = true
+	}
+
+	extractOpts := ExtractOptions{
+		AuditSchema:      *auditSchema,
+		DedupeRows:       *dedupeRows,
+		DedupeBloom:      *dedupBloom,
+		DedupeExpected:   *dedupExpected,
+		DedupeFPRate:     *dedupFPRate,
+		ColumnsManifest:  *columnsManifest,
+		RowHash:          *rowHash,
+		StreamCSV:        *streamCSV,
+		CSVBOM:           *writeBOM,
+		Resume:           *resume,
+		WithDescription:  *withDescription,
+		PercentageColumn: *percentageColumn,
+	}
+	if extractOpts.TINAllow, err = parseListFlag(*tinAllow); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -tin-allow: %v\n", err)
+		os.Exit(2)
+	}
+	if extractOpts.TINDeny, err = parseListFlag(*tinDeny); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -tin-deny: %v\n", err)
+		os.Exit(2)
+	}
+	if extractOpts.Columns, err = parseColumnList(*columnList); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -columns: %v\n", err)
+		os.Exit(2)
+	}
+	if slices.Contains(extractOpts.Columns, "description") {
+		extractOpts.WithDescription = true
+	}
+	if slices.Contains(extractOpts.Columns, "negotiated_percentage") {
+		extractOpts.PercentageColumn = true
+	}
+	if extractOpts.IncludeColumns, err = parseListFlag(*includeColumns); err == nil {
+		err = checkColumnNames(extractOpts.IncludeColumns)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -include-columns: %v\n", err)
+		os.Exit(2)
+	}
+	if extractOpts.ExcludeColumns, err = parseListFlag(*excludeColumns); err == nil {
+		err = checkColumnNames(extractOpts.ExcludeColumns)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -exclude-columns: %v\n", err)
+		os.Exit(2)
+	}
+	if *npiFile != "" {
+		if extractOpts.NPIs, err = loadNPIs(*npiFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -npi-file: %v\n", err)
+			os.Exit(2)
+		}
+		slog.Info("loaded NPI list", "file", *npiFile, "count", len(extractOpts.NPIs))
+	}
+	if *validServiceCodes != "" {
+		if extractOpts.ValidServiceCodes, err = loadServiceCodes(*validServiceCodes); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -valid-service-codes: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if *asOf != "" {
+		t, err := time.Parse("2006-01-02", *asOf)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -as-of %q: want YYYY-MM-DD\n", *asOf)
+			os.Exit(2)
+		}
+		extractOpts.AsOf = t
+	} else if *notExpired {
+		now := time.Now()
+		extractOpts.AsOf = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	if *mode != "in-network" && *mode != "allowed-amount" {
+		fmt.Fprintf(os.Stderr, "Error: unknown -mode %q (want in-network or allowed-amount)\n", *mode)
+		os.Exit(2)
+	}
+
+	if *maxRecordBytes < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -max-record-bytes must not be negative\n")
+		os.Exit(2)
+	}
+	if *serveMaxBody <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: -serve-max-body must be positive\n")
+		os.Exit(2)
+	}
+	if *extractPointer != "" && *format != formatJSONL && *format != formatJSON {
+		fmt.Fprintf(os.Stderr, "Error: -extract-pointer requires -format jsonl or json, as the other formats need whole records\n")
+		os.Exit(2)
+	}
+	if *bufferSize < matcher.MinBufferSize {
+		fmt.Fprintf(os.Stderr, "Error: -buffer-size must be at least %d\n", matcher.MinBufferSize)
+		os.Exit(2)
+	}
+	if *intraFileWorkers < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -intra-file-workers must not be negative\n")
+		os.Exit(2)
+	}
+	if *maxRuntime < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -max-runtime must not be negative\n")
+		os.Exit(2)
+	}
+	if *workers < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -workers must be at least 1 (or 0 for one per CPU)\n")
+		os.Exit(2)
+	}
+
+	if !validFormat(*format) {
+		fmt.Fprintf(os.Stderr, "Error: unknown -format %q (want jsonl, json, csv or parquet)\n", *format)
+		os.Exit(2)
+	}
+	if *format == formatParquet && *mode == "allowed-amount" {
+		fmt.Fprintf(os.Stderr, "Error: -format parquet supports only -mode in-network\n")
+		os.Exit(2)
+	}
+	if *dedupeRows && *format != formatCSV && *format != formatParquet {
+		fmt.Fprintf(os.Stderr, "Error: -dedupe-rows requires -format csv or parquet\n")
+		os.Exit(2)
+	}
+	if *columnsManifest && *format != formatCSV {
+		fmt.Fprintf(os.Stderr, "Error: -columns-manifest requires -format csv\n")
+		os.Exit(2)
+	}
+	if *npiFile != "" && (*mode != "in-network" || (*format != formatCSV && *format != formatParquet)) {
+		fmt.Fprintf(os.Stderr, "Error: -npi-file requires -mode in-network and -format csv or parquet\n")
+		os.Exit(2)
+	}
+	if *dropEmpty && *format != formatCSV {
+		fmt.Fprintf(os.Stderr, "Error: -drop-empty-columns requires -format csv\n")
+		os.Exit(2)
+	}
+	if *writeBOM && *format != formatCSV {
+		fmt.Fprintf(os.Stderr, "Error: -csv-bom requires -format csv\n")
+		os.Exit(2)
+	}
+	if *rowHash && (*mode != "in-network" || *format != formatCSV) {
+		fmt.Fprintf(os.Stderr, "Error: -row-hash requires -mode in-network and -format csv\n")
+		os.Exit(2)
+	}
+	if *streamCSV && (*mode != "in-network" || *format != formatCSV) {
+		fmt.Fprintf(os.Stderr, "Error: -stream-csv requires -mode in-network and -format csv\n")
+		os.Exit(2)
+	}
+	if *percentageColumn && (*mode != "in-network" || *format != formatCSV) {
+		fmt.Fprintf(os.Stderr, "Error: -percentage-column requires -mode in-network and -format csv\n")
+		os.Exit(2)
+	}
+	if (*withDescription || *includeColumns != "" || *excludeColumns != "" || *columnList != "") && (*mode != "in-network" || *format != formatCSV) {
+		fmt.Fprintf(os.Stderr, "Error: -with-description, -columns, -include-columns and -exclude-columns require -mode in-network and -format csv\n")
+		os.Exit(2)
+	}
+	if *columnList != "" && (*includeColumns != "" || *excludeColumns != "") {
+		fmt.Fprintf(os.Stderr, "Error: -columns lists every column written, so it cannot be combined with -include-columns or -exclude-columns\n")
+		os.Exit(2)
+	}
+	if *resume && (*mode != "in-network" || *format != formatCSV) {
+		fmt.Fprintf(os.Stderr, "Error: -resume requires -mode in-network and -format csv\n")
+		os.Exit(2)
+	}
+	if *resume && (*truncate || *partitionByCode || *countOnly || *listCodes || *listCodesByType) {
+		fmt.Fprintf(os.Stderr, "Error: -resume continues an extraction, so it cannot be combined with -truncate, -partition-by-code, -count-only or -list-codes\n")
+		os.Exit(2)
+	}
+
+	// Output file using JSON Lines format
+	outputFile := "matches.jsonl"
+	if *compressOutput {
+		outputFile = "matches.jsonl.gz"
+	}
+	if *compressOutput && *partitionByCode {
+		fmt.Fprintf(os.Stderr, "Error: -compress-output cannot be combined with -partition-by-code\n")
+		os.Exit(2)
+	}
+
+	if *truncate && *diffAgainst != "" && filepath.Clean(*diffAgainst) == outputFile {
+		fmt.Fprintf(os.Stderr, "Error: -truncate would empty %s before -diff-against reads it\n", outputFile)
+		os.Exit(2)
+	}
+
+	if *countOnly && (*partitionByCode || *truncate) {
+		fmt.Fprintf(os.Stderr, "Error: -count-only writes no matches, so it cannot be combined with -partition-by-code or -truncate\n")
+		os.Exit(2)
+	}
+	if *listCodesByType {
+		*listCodes = true
+	}
+	if *listCodes && (*countOnly || *partitionByCode || *truncate) {
+		fmt.Fprintf(os.Stderr, "Error: -list-codes writes no matches, so it cannot be combined with -count-only, -partition-by-code or -truncate\n")
+		os.Exit(2)
+	}
+	if *sampleRate <= 0 || *sampleRate > 1 {
+		fmt.Fprintf(os.Stderr, "Error: -sample-rate must be greater than 0 and at most 1\n")
+		os.Exit(2)
+	}
+	// Neither tallying mode produces matches, so neither touches the logs
+	tallyOnly := *countOnly || *listCodes
+
+	if *mergeOut != "" {
+		if fs.NArg() == 0 {
+			fmt.Fprintf(os.Stderr, "Error: -merge needs the CSV files to merge as arguments\n")
+			os.Exit(2)
+		}
+		for _, input := range fs.Args() {
+			if filepath.Clean(input) == filepath.Clean(*mergeOut) {
+				fmt.Fprintf(os.Stderr, "Error: -merge output %s is also an input\n", *mergeOut)
+				os.Exit(2)
+			}
+		}
+		if err := mergeCSVs(*mergeOut, fs.Args()); err != nil {
+			slog.Error("could not merge CSV files", "output", *mergeOut, "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *serveAddr != "" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		server := &matchServer{
+			match:          buildMatchPredicate(*codeType, *negotiatedType, *billingClass),
+			skipBadRecords: *skipBadRecords,
+			maxRecordBytes: *maxRecordBytes,
+			maxBodySize:    *serveMaxBody,
+		}
+		if err := serve(ctx, *serveAddr, server); err != nil {
+			slog.Error("server failed", "addr", *serveAddr, "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *inputGlob != "" && *manifest != "" {
+		fmt.Fprintf(os.Stderr, "Error: -input-glob and -manifest are mutually exclusive\n")
+		os.Exit(2)
+	}
+
+	if *verify {
+		report, err := verifyMatches(outputFile, buildMatchPredicate(*codeType, *negotiatedType, *billingClass))
+		if err != nil {
+			slog.Error("could not verify matches", "file", outputFile, "error", err)
+			os.Exit(1)
+		}
+		slog.Info("verification complete", "file", outputFile, "records", report.Records, "mismatches", report.Mismatches, "parse_errors", report.ParseErrors)
+		if report.Mismatches > 0 || report.ParseErrors > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Process gzip files directly from scraper downloads (preferred)
+	gzipDirPath := "../scraper/downloads"
+
+	// Remote inputs are fetched with the scraper's retry rules
+	opts := workerOptions{
+		extractPointer:   pointer,
+		bufferSize:       *bufferSize,
+		intraFileWorkers: *intraFileWorkers,
+		jsonLines:        *jsonLines,
+		skipBadRecords:   *skipBadRecords,
+		maxRecordBytes:   *maxRecordBytes,
+		excludeCodes:     excludedCodes,
+		fileRetries:      *fileRetries,
+		spoolMatches:     *maxRuntime > 0 || *limit > 0,
+		teeDir:           *teeDecompressed,
+
+		fetchTimeout: *fetchTimeout,
+		retry:        downloader.DefaultRetryConfig,
+	}
+
+	if *preflight {
+		ready := runPreflight(os.Stdout, preflightConfig{
+			gzipDir:   gzipDirPath,
+			inputGlob: *inputGlob,
+			manifest:  *manifest,
+			output:    outputFile,
+			teeDir:    *teeDecompressed,
+			opts:      opts,
+		})
+		if !ready {
+			os.Exit(1)
+		}
+		return
+	}
+
+	slog.Info("starting optimized streaming JSON parser")
+
+	// Process both gzip files directly from scraper and decompressed JSON files
+	var filesToProcess []string
+	processedFiles, err := loadProcessedFiles()
+	if err != nil {
+		panic(err)
+	}
+	slog.Info("loaded processed files log", "count", len(processedFiles), "log", processedFilesLog)
+	if *truncate {
+		// Truncating the output while trusting the log would leave an empty
+		// file and nothing to process, so a clean run starts a new log as well
+		processedFiles = make(map[string]string)
+		slog.Info("truncating output and reprocessing every file", "output", outputFile)
+	}
+	if tallyOnly {
+		// Tallying does not produce matches.jsonl, so it must neither skip
+		// files already matched nor mark the files it reads as processed
+		processedFiles = make(map[string]string)
+	}
+
+	quarantine, err := loadQuarantine()
+	if err != nil {
+		slog.Error("could not load quarantine log", "log", quarantineLog, "error", err)
+		os.Exit(1)
+	}
+	slog.Info("loaded quarantine log", "count", len(quarantine), "log", quarantineLog)
+
+	isProcessed := processedChecker(processedFiles, *rehash)
+	inputSource := gzipDirPath
+	var pending, skipped []plannedFile
+	switch {
+	case *manifest != "":
+		inputSource = *manifest
+		pending, skipped, err = loadManifest(*manifest, isProcessed)
+	case *inputGlob != "":
+		inputSource = *inputGlob
+		pending, skipped, err = scanGlob(*inputGlob, isProcessed)
+	default:
+		pending, skipped, err = scanGzipDir(gzipDirPath, isProcessed)
+	}
+	var quarantined []plannedFile
+	if !*retryQuarantined {
+		pending, quarantined = filterQuarantined(pending, quarantine)
+	}
+	if err == nil {
+		for _, file := range pending {
+			filesToProcess = append(filesToProcess, file.Path)
+		}
+		slog.Info("found new gzip files to process", "count", len(filesToProcess), "quarantined", len(quarantined), "source", inputSource)
+	} else {
+		slog.Warn("could not access input files", "source", inputSource, "error", err)
+	}
+
+	if *dryRun {
+		printPlan(os.Stdout, pending, skipped, quarantined)
+		return
+	}
+
+	// Also process any decompressed JSON files as fallback (COMMENTED OUT)
+	// initialFileCount := len(filesToProcess)
+	// jsonDirPath := "../decompress/output"
+	// if jsonFiles, err := os.ReadDir(jsonDirPath); err == nil {
+	// 	for _, file := range jsonFiles {
+	// 		fileName := file.Name()
+	// 		if !file.IsDir() && strings.HasSuffix(strings.ToLower(fileName), ".json") {
+	// 			if !processedFiles[fileName] {
+	// 				filesToProcess = append(filesToProcess, filepath.Join(jsonDirPath, fileName))
+	// 			}
+	// 		}
+	// 	}
+	// 	additionalFiles := len(filesToProcess) - initialFileCount
+	// 	fmt.Printf("Found %d additional JSON files to process\n", additionalFiles)
+	// } else {
+	// 	fmt.Printf("Could not access JSON directory %s: %v\n", jsonDirPath, err)
+	// }
+
+	if len(filesToProcess) == 0 && !*resume {
+		slog.Info("no new files to process")
+		if !tallyOnly && countLegacyKeys(processedFiles)+countLegacyKeys(quarantine) > 0 {
+			// Persist the migration, or the basename entries would match again next run
+			saveLogs(processedFiles, quarantine)
+		}
+		return
+	}
+
+	// --- Concurrency Setup ---
+	// Every input is gunzipped while it is matched, so a worker spends much of
+	// its time in decompression and one per CPU keeps them all busy.
+	numWorkers := *workers
+	if numWorkers == 0 {
+		numWorkers = runtime.NumCPU()
+	}
+	slog.Info("processing files", "files", len(filesToProcess), "workers", numWorkers)
+
+	jobs := make(chan string, len(filesToProcess))
+	results := make(chan result, len(filesToProcess))
+	var writerMutex = &sync.Mutex{}
+
+	// Output is appended to unless -truncate asks for a clean run
+	openFlag := os.O_APPEND
+	if *truncate {
+		openFlag = os.O_TRUNC
+	}
+
+	var writer outputWriter
+	var partitions *partitionWriter
+	var counts *countWriter
+	var compressed *compressedOutput
+	switch {
+	case *listCodes:
+		// Nothing matches while listing codes, so nothing is written
+		writer = bufio.NewWriter(io.Discard)
+	case *countOnly:
+		counts = newCountWriter()
+		writer = counts
+	case *partitionByCode:
+		// Partition files are opened lazily as codes are matched
+		partitions = newPartitionWriter(strings.TrimSuffix(outputFile, ".jsonl"), openFlag)
+		writer = partitions
+	case *compressOutput:
+		if openFlag == os.O_APPEND {
+			if err := endTruncatedGzip(outputFile); err != nil {
+				slog.Error("could not check the end of the output file", "file", outputFile, "error", err)
+				os.Exit(1)
+			}
+		}
+		out, err := os.OpenFile(outputFile, openFlag|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			panic(err)
+		}
+		// Closed once every worker is done, before the output is read back
+		compressed = newCompressedOutput(out, *bufferSize)
+		writer = compressed
+	default:
+		if openFlag == os.O_APPEND {
+			if err := endUnterminatedLine(outputFile); err != nil {
+				slog.Warn("could not check the end of the output file", "file", outputFile, "error", err)
+			}
+		}
+
+		// Open the output file. It will be created if it doesn't exist.
+		out, err := os.OpenFile(outputFile, openFlag|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			panic(err)
+		}
+		defer out.Close()
+
+		// Create a buffered writer for better performance
+		bufferedWriter := bufio.NewWriterSize(out, *bufferSize)
+		defer bufferedWriter.Flush()
+		writer = bufferedWriter
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if *maxRuntime > 0 {
+		// The budget counts from the start of the run, file discovery included
+		var cancelDeadline context.CancelFunc
+		ctx, cancelDeadline = context.WithDeadline(ctx, started.Add(*maxRuntime))
+		defer cancelDeadline()
+		slog.Info("limiting run time", "max_runtime", *maxRuntime)
+	}
+	if *limit > 0 {
+		opts.limit = &limitWriter{w: writer, limit: *limit, cancel: cancel}
+		writer = opts.limit
+		slog.Info("limiting matches", "limit", *limit)
+	}
+	var schemaCheck *schemaWriter
+	if *schemaPath != "" {
+		// Outside the limit, so only valid records count towards it
+		schemaCheck, err = newSchemaWriter(writer, *schemaPath, openFlag)
+		if err != nil {
+			slog.Error("could not set up schema validation", "schema", *schemaPath, "error", err)
+			os.Exit(1)
+		}
+		writer = schemaCheck
+		// Invalid matches never reach the limit, so a spool does not count them
+		opts.limitCounts = schemaCheck.accepts
+		slog.Info("validating matches against schema", "schema", *schemaPath, "failures", schemaFailuresFile)
+	}
+
+	// Start workers.
+	metrics := newRunMetrics(numWorkers)
+	match := buildMatchPredicate(*codeType, *negotiatedType, *billingClass)
+	var histogram *codeHistogram
+	if *listCodes {
+		histogram = newCodeHistogram(*listCodesByType)
+		// Codes are tallied as records are decoded; nothing matches
+		opts.visit = histogram.visit
+		match = func(map[string]interface{}) bool { return false }
+	}
+	var diff *recordDiff
+	if *diffAgainst != "" {
+		var keys []string
+		for _, key := range strings.Split(*diffKeys, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				keys = append(keys, key)
+			}
+		}
+		diff, err = loadRecordDiff(*diffAgainst, keys)
+		if err != nil {
+			slog.Error("could not load previous matches", "file", *diffAgainst, "error", err)
+			os.Exit(1)
+		}
+		slog.Info("loaded previous matches", "file", *diffAgainst, "records", len(diff.seen))
+		opts.keep = diff.keep
+	}
+	var sampler *recordSampler
+	if *sampleRate < 1 {
+		if *seed == 0 {
+			*seed = rand.Uint64()
+		}
+		sampler = newRecordSampler(*sampleRate, *seed)
+		opts.keep = sampler.keep
+		if diff != nil {
+			// Sampled after -diff-against, so the sample is of new records
+			opts.keep = func(match map[string]interface{}) bool {
+				return diff.keep(match) && sampler.keep(match)
+			}
+		}
+		slog.Info("sampling matches", "rate", *sampleRate, "seed", *seed)
+	}
+
+	opts.match = match
+	if opts.teeDir != "" {
+		opts.teeNames = resolveTeeNames(filesToProcess)
+	}
+	for w := 1; w <= numWorkers; w++ {
+		go worker(ctx, w, jobs, results, writer, writerMutex, opts)
+	}
+
+	// Send jobs to the workers.
+	for _, filePath := range filesToProcess {
+		jobs <- filePath
+	}
+	close(jobs)
+
+	// --- Collect Results ---
+	totalNewRecords := 0
+	totalNestedRecords := 0 // matches found by the recursive fallback
+	totalSkippedRecords := 0
+	totalOversizedRecords := 0
+	totalExcludedRecords := 0
+	filesProcessed := 0
+	filesCutOff := 0
+
+	var progress *logger.Progress
+	fileSizes := make(map[string]int64, len(pending))
+	for _, file := range pending {
+		fileSizes[fileKey(file.Path)] = file.Size
+	}
+	if !*quiet {
+		progress = logger.StartProgress(os.Stderr, "Progress", len(filesToProcess), totalSize(pending))
+	}
+
+	lastCheckpoint := time.Now()
+	var strictFailure *result
+	for i := 0; i < len(filesToProcess); i++ {
+		res := <-results
+		if progress != nil {
+			progress.Add(1, fileSizes[res.fileName])
+		}
+		if strictFailure != nil {
+			// Drain the cancelled workers so none is still writing, but
+			// record nothing after the failure
+			continue
+		}
+		if res.cutOff {
+			// Neither processed nor quarantined, so the next run picks it up again
+			filesCutOff++
+			if res.duration > 0 {
+				// Started before the cancellation. A spooled file, as under
+				// -limit and -max-runtime, wrote none of its matches and
+				// reports none; any other wrote those found before the cut.
+				metrics.add(res)
+				totalNewRecords += res.stats.Matches
+				totalNestedRecords += res.stats.NestedMatches
+			}
+			continue
+		}
+		filesProcessed++
+		metrics.add(res)
+		if res.err != nil {
+			slog.Error("error processing file", "index", filesProcessed, "total", len(filesToProcess), "file", res.fileName, "error", res.err)
+			if *strict {
+				strictFailure = &res
+				cancel()
+				continue
+			}
+			// Quarantine the file so it isn't retried on every run
+			quarantine[res.fileName] = quarantineEntry{
+				File:          res.fileName,
+				Reason:        res.err.Error(),
+				QuarantinedAt: time.Now(),
+			}
+		} else {
+			delete(quarantine, res.fileName)
+			if res.stats.SkippedBOM {
+				slog.Warn("skipped UTF-8 byte order mark at start of file", "file", res.fileName)
+			}
+			if res.stats.MalformedLines > 0 {
+				slog.Warn("skipped malformed lines", "file", res.fileName, "lines", res.stats.MalformedLines)
+			}
+			if res.stats.OversizedRecords > 0 {
+				slog.Warn("skipped oversized records", "file", res.fileName, "records", res.stats.OversizedRecords, "max_record_bytes", *maxRecordBytes)
+				totalOversizedRecords += res.stats.OversizedRecords
+			}
+			totalExcludedRecords += res.stats.ExcludedRecords
+			if res.stats.UnresolvedPointers > 0 {
+				slog.Warn("extract pointer did not resolve, wrote whole matches", "file", res.fileName, "records", res.stats.UnresolvedPointers, "pointer", *extractPointer)
+			}
+			if res.stats.SkippedRecords > 0 {
+				slog.Warn("skipped bad records", "file", res.fileName, "records", res.stats.SkippedRecords)
+				totalSkippedRecords += res.stats.SkippedRecords
+			}
+			if res.stats.Matches > 0 {
+				slog.Info("processed file", "index", filesProcessed, "total", len(filesToProcess), "file", res.fileName, "records", res.stats.Matches, "nested", res.stats.NestedMatches)
+				totalNewRecords += res.stats.Matches
+				totalNestedRecords += res.stats.NestedMatches
+			}
+			// Mark file as processed in memory
+			processedFiles[res.fileName] = res.hash
+		}
+
+		// Workers flush their matches before reporting a result, so every
+		// file in the log has its matches on disk. In strict mode the log is
+		// only saved once every file has succeeded.
+		if !tallyOnly && !*strict && time.Since(lastCheckpoint) >= processedLogCheckpoint {
+			if err := saveProcessedFiles(processedFiles); err != nil {
+				slog.Warn("could not checkpoint processed files log", "log", processedFilesLog, "error", err)
+			}
+			lastCheckpoint = time.Now()
+		}
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		slog.Warn("max runtime reached; unfinished files are left for the next run", "max_runtime", *maxRuntime, "files_processed", filesProcessed, "files_remaining", filesCutOff)
+	} else if opts.limit != nil && filesCutOff > 0 {
+		slog.Warn("match limit reached; unfinished files are left for the next run", "limit", *limit, "written", opts.limit.written, "files_processed", filesProcessed, "files_remaining", filesCutOff)
+	}
+
+	if schemaCheck != nil {
+		if err := schemaCheck.Close(); err != nil {
+			slog.Error("could not close schema failures file", "file", schemaFailuresFile, "error", err)
+		}
+		slog.Info("validated matches against schema", "schema", *schemaPath, "valid", schemaCheck.valid, "invalid", schemaCheck.invalid, "failures", schemaFailuresFile)
+	}
+
+	if partitions != nil {
+		if err := partitions.Close(); err != nil {
+			slog.Error("could not close partition files", "error", err)
+		}
+		partitions.logCounts()
+	}
+	if compressed != nil {
+		if err := compressed.Close(); err != nil {
+			slog.Error("could not close compressed output", "file", outputFile, "error", err)
+		}
+	}
+
+	if progress != nil {
+		progress.Stop()
+	}
+
+	if diff != nil {
+		slog.Info("compared matches with previous output", "file", *diffAgainst, "new", diff.newRecords.Load(), "already_seen", diff.seenRecords.Load())
+	}
+	if sampler != nil {
+		slog.Info("sampled matches", "sampled", sampler.sampled.Load(), "matched", sampler.matched.Load(), "rate", *sampleRate, "seed", *seed)
+	}
+
+	metrics.finish()
+	metrics.log()
+	if *metricsFile != "" {
+		if err := metrics.write(*metricsFile); err != nil {
+			slog.Warn("could not write metrics", "file", *metricsFile, "error", err)
+		}
+	}
+
+	if strictFailure != nil {
+		slog.Error("stopping: a file failed in -strict mode; "+processedFilesLog+" and "+quarantineLog+" were not updated",
+			"file", strictFailure.fileName,
+			"error", strictFailure.err,
+			"files_succeeded", filesProcessed-1,
+			"files_not_processed", len(filesToProcess)-filesProcessed,
+			"new_records", totalNewRecords,
+		)
+		os.Exit(1)
+	}
+
+	if histogram != nil {
+		if err := histogram.write(codeHistogramFile); err != nil {
+			slog.Error("could not write code histogram", "file", codeHistogramFile, "error", err)
+			os.Exit(1)
+		}
+		records, distinct := histogram.total()
+		slog.Info("listing codes complete", "output", codeHistogramFile, "records", records, "distinct", distinct, "files_processed", filesProcessed, "files_cut_off", filesCutOff)
+		return
+	}
+
+	if counts != nil {
+		if err := counts.write(countsFile); err != nil {
+			slog.Error("could not write match counts", "file", countsFile, "error", err)
+			os.Exit(1)
+		}
+		counts.logCounts()
+		slog.Info("counting complete", "output", countsFile, "files_processed", filesProcessed, "files_cut_off", filesCutOff)
+		return
+	}
+
+	// Save the processed files log once at the end
+	saveLogs(processedFiles, quarantine)
+
+	slog.Info("processing complete",
+		"new_records", totalNewRecords,
+		"direct_matches", totalNewRecords-totalNestedRecords,
+		"nested_matches", totalNestedRecords,
+		"skipped_records", totalSkippedRecords,
+		"oversized_records", totalOversizedRecords,
+		"excluded_records", totalExcludedRecords,
+		"files_cut_off", filesCutOff,
+		"files_processed", filesProcessed,
+		"files_in_log", len(processedFiles),
+		"files_quarantined", len(quarantine),
+	)
+
+	if *partitionByCode {
+		slog.Info("skipping "+*format+" output for partitioned matches", "input", outputFile)
+		return
+	}
+
+	// Convert the .jsonl file to the requested format
+	switch {
+	case *format == formatJSONL:
+		slog.Info("matches written as JSON Lines", "output", outputFile)
+	case *format == formatJSON:
+		ExtractToJSON(outputFile)
+	case *format == formatParquet:
+		WriteParquet(outputFile, extractOpts)
+	case *mode == "allowed-amount":
+		slog.Info("generating CSV output", "mode", *mode)
+		ExtractAllowedAmountsToCSV(outputFile, *writeBOM)
+	default:
+		slog.Info("generating CSV output", "mode", *mode)
+		ExtractToCSV(outputFile, extractOpts)
+	}
+
+	if *dropEmpty && *format == formatCSV {
+		header, err := dropEmptyColumns("matches.csv")
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			slog.Warn("could not drop empty columns", "file", "matches.csv", "error", err)
+		case *columnsManifest:
+			// The manifest was written for the full header
+			if err := writeColumnsManifest(header); err != nil {
+				slog.Warn("could not write column manifest", "file", columnsManifestFile, "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package pipeline
+
+import (
+	"math"
+	"math/bits"
+)
+
+// bloomFilter is a fixed-size set of 64-bit hashes that may report false
+// positives but never false negatives
+type bloomFilter struct {
+	bits   []uint64
+	m      uint64 // number of bits
+	k      int    // hash functions per item
+	items  int    // items added
+	sizeMB float64
+}
+
+// newBloomFilter sizes a filter for expected items at the given false-positive rate
+func newBloomFilter(expected int, fpRate float64) *bloomFilter {
+	n := float64(expected)
+	m := uint64(math.Ceil(-n * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := int(math.Round(float64(m) / n * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	words := (m + 63) / 64
+	return &bloomFilter{
+		bits:   make([]uint64, words),
+		m:      m,
+		k:      k,
+		sizeMB: float64(words*8) / (1024 * 1024),
+	}
+}
+
+// add records h, reporting whether it was (probably) present already.
+// The k bit positions come from double hashing h with a remixed copy of itself.
+func (b *bloomFilter) add(h uint64) bool {
+	h2 := bits.RotateLeft64(h*0x9E3779B97F4A7C15, 31) | 1
+	present := true
+	for i := 0; i < b.k; i++ {
+		pos := (h + uint64(i)*h2) % b.m
+		word, mask := pos/64, uint64(1)<<(pos%64)
+		if b.bits[word]&mask == 0 {
+			present = false
+			b.bits[word] |= mask
+		}
+	}
+	if !present {
+		b.items++
+	}
+	return present
+}
+
+// falsePositiveRate estimates the chance that a new item is reported as
+// present, given the number of items added so far
+func (b *bloomFilter) falsePositiveRate() float64 {
+	return math.Pow(1-math.Exp(-float64(b.k)*float64(b.items)/float64(b.m)), float64(b.k))
+}
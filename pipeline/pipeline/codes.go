@@ -0,0 +1,69 @@
+package pipeline
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// loadCodesCSV reads billing codes from one column of a CSV file with a header
+// row. column is either a header name or a 1-based column number.
+func loadCodesCSV(path, column string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1 // spreadsheets often leave trailing cells off short rows
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %v", err)
+	}
+
+	index := -1
+	for i, name := range header {
+		if strings.EqualFold(strings.TrimSpace(name), column) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		n, err := strconv.Atoi(column)
+		if err != nil || n < 1 || n > len(header) {
+			return nil, fmt.Errorf("column %q not found in the header of %s", column, path)
+		}
+		index = n - 1
+	}
+
+	codes := make(map[string]bool)
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		if index >= len(row) {
+			continue
+		}
+		if code := strings.TrimSpace(row[index]); code != "" {
+			codes[code] = true
+		}
+	}
+
+	if len(codes) == 0 {
+		return nil, fmt.Errorf("no codes found in column %q of %s", column, path)
+	}
+	return codes, nil
+}
@@ -0,0 +1,154 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// columnsManifestFile describes the columns of matches.csv
+const columnsManifestFile = "columns.json"
+
+// columnInfo describes one CSV column in columns.json
+type columnInfo struct {
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+	Type  string `json:"type"` // string, number or integer
+	Kind  string `json:"kind"` // field, count, summary, dynamic or checksum
+}
+
+// fixedColumnTypes holds the type and kind of every non-numbered column
+var fixedColumnTypes = map[string][2]string{
+	"billing_code":              {"string", "field"},
+	"billing_code_type":         {"string", "field"},
+	"billing_code_type_version": {"string", "field"},
+	"description":               {"string", "field"},
+	"name":                      {"string", "field"},
+	"negotiated_rates_count":    {"integer", "count"},
+	"negotiation_arrangement":   {"string", "field"},
+	"negotiated_prices_count":   {"integer", "count"},
+	"billing_class":             {"string", "field"},
+	"expiration_date":           {"string", "field"},
+	"negotiated_rate":           {"number", "field"},
+	"negotiated_percentage":     {"number", "field"},
+	"negotiated_type":           {"string", "field"},
+	"provider_references_count": {"integer", "count"},
+	"provider_groups_count":     {"integer", "count"},
+	"total_npis_count":          {"integer", "count"},
+	"total_tins_count":          {"integer", "count"},
+	"first_group_npi_count":     {"integer", "summary"},
+	"first_group_tin_type":      {"string", "summary"},
+	"first_group_tin_value":     {"string", "summary"},
+	rowHashColumn:               {"string", "checksum"},
+}
+
+// numberedColumnGroups are the prefixes of the numbered columns. Each also
+// names its whole group in -include-columns and -exclude-columns.
+var numberedColumnGroups = []string{"service_code", "provider_reference"}
+
+// columnGroup returns the group of a numbered column such as service_code_3,
+// or "" for any other column
+func columnGroup(name string) string {
+	for _, group := range numberedColumnGroups {
+		if n, ok := strings.CutPrefix(name, group+"_"); ok {
+			if _, err := strconv.Atoi(n); err == nil {
+				return group
+			}
+		}
+	}
+	return ""
+}
+
+// columnSelected reports whether -include-columns and -exclude-columns keep
+// the column name
+func columnSelected(name string, opts ExtractOptions) bool {
+	listed := func(list map[string]bool) bool {
+		return list[name] || list[columnGroup(name)]
+	}
+	if opts.IncludeColumns != nil && !listed(opts.IncludeColumns) {
+		return false
+	}
+	return !listed(opts.ExcludeColumns)
+}
+
+// checkColumnNames returns an error for a name in an -include-columns or
+// -exclude-columns list that is not a matches.csv column or column group
+func checkColumnNames(names map[string]bool) error {
+	for name := range names {
+		if name == rowHashColumn {
+			return fmt.Errorf("%s is added by -row-hash, not selected", rowHashColumn)
+		}
+		if _, ok := fixedColumnTypes[name]; ok || columnGroup(name) != "" {
+			continue
+		}
+		if slices.Contains(numberedColumnGroups, name) {
+			continue
+		}
+		return fmt.Errorf("unknown column %q", name)
+	}
+	return nil
+}
+
+// parseColumnList parses a -columns value, comma-separated column names in
+// the order they are written, checking each is known and listed once
+func parseColumnList(value string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var columns []string
+	listed := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if listed[name] {
+			return nil, fmt.Errorf("column %q is listed twice", name)
+		}
+		listed[name] = true
+		columns = append(columns, name)
+	}
+	if err := checkColumnNames(listed); err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no columns listed")
+	}
+	return columns, nil
+}
+
+// describeColumns derives columns.json entries from the header actually
+// written, so the manifest cannot drift from the CSV
+func describeColumns(header []string) []columnInfo {
+	columns := make([]columnInfo, len(header))
+	for i, name := range header {
+		info := columnInfo{Index: i, Name: name, Type: "string", Kind: "field"}
+		switch {
+		case strings.HasPrefix(name, "service_code_"):
+			info.Kind = "dynamic"
+		case strings.HasPrefix(name, "provider_reference_"):
+			info.Type, info.Kind = "number", "dynamic"
+		default:
+			if t, ok := fixedColumnTypes[name]; ok {
+				info.Type, info.Kind = t[0], t[1]
+			}
+		}
+		columns[i] = info
+	}
+	return columns
+}
+
+// writeColumnsManifest writes columns.json for the given CSV header
+func writeColumnsManifest(header []string) error {
+	data, err := json.MarshalIndent(struct {
+		File    string       `json:"file"`
+		Columns []columnInfo `json:"columns"`
+	}{File: "matches.csv", Columns: describeColumns(header)}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(columnsManifestFile, data, 0644)
+}
@@ -0,0 +1,114 @@
+package pipeline
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// dropEmptyColumns rewrites the CSV at path without the dynamic
+// service_code_N and provider_reference_N columns that are empty in every
+// row. The first streaming pass finds which dynamic columns are ever used and
+// the second copies the rows, so the file is never held in memory. It returns
+// the header that was kept.
+func dropEmptyColumns(path string) ([]string, error) {
+	header, used, bom, err := scanUsedColumns(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keep []int
+	var kept []string
+	for i, column := range describeColumns(header) {
+		if column.Kind != "dynamic" || used[i] {
+			keep = append(keep, i)
+			kept = append(kept, header[i])
+		}
+	}
+	dropped := len(header) - len(kept)
+	if dropped == 0 {
+		slog.Info("no empty columns to drop", "file", path, "columns", len(header))
+		return header, nil
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	// The byte order mark, if any, is kept in front of the rewritten header
+	input, _ := skipCSVBOM(in)
+	reader := csv.NewReader(input)
+	reader.ReuseRecord = true
+	err = writeFileAtomic(path, func(w io.Writer) error {
+		if bom {
+			if _, err := w.Write(csvBOM); err != nil {
+				return err
+			}
+		}
+		writer := csv.NewWriter(w)
+		row := make([]string, len(keep))
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			for j, i := range keep {
+				row[j] = record[i]
+			}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("dropped empty columns", "file", path, "dropped", dropped, "columns", len(kept))
+	return kept, nil
+}
+
+// scanUsedColumns reads the CSV at path and reports its header, which
+// columns hold a value in at least one row and whether it starts with a byte
+// order mark
+func scanUsedColumns(path string) ([]string, []bool, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer file.Close()
+
+	input, bom := skipCSVBOM(file)
+	reader := csv.NewReader(input)
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to read header of %s: %v", path, err)
+	}
+	header = append([]string(nil), header...) // ReuseRecord shares the slice
+
+	used := make([]bool, len(header))
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return header, used, bom, nil
+		}
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		for i, value := range record {
+			if value != "" {
+				used[i] = true
+			}
+		}
+	}
+}
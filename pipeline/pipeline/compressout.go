@@ -0,0 +1,134 @@
+package pipeline
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// compressedOutput gzips matches into matches.jsonl.gz for -compress-output.
+// Each run appends a new gzip member; readers see the members as one stream.
+// Flush ends the current deflate block, so matches a worker has flushed can be
+// read back even if the run is interrupted before Close writes the trailer.
+type compressedOutput struct {
+	file *os.File
+	gz   *gzip.Writer
+	buf  *bufio.Writer
+}
+
+func newCompressedOutput(file *os.File, bufferSize int) *compressedOutput {
+	gz := gzip.NewWriter(file)
+	return &compressedOutput{
+		file: file,
+		gz:   gz,
+		buf:  bufio.NewWriterSize(gz, bufferSize),
+	}
+}
+
+func (c *compressedOutput) Write(p []byte) (int, error) {
+	return c.buf.Write(p)
+}
+
+func (c *compressedOutput) Flush() error {
+	if err := c.buf.Flush(); err != nil {
+		return err
+	}
+	return c.gz.Flush()
+}
+
+// Close writes the gzip trailer and closes the file. It must be called
+// exactly once, after the last Flush.
+func (c *compressedOutput) Close() error {
+	err := c.buf.Flush()
+	if closeErr := c.gz.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := c.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// openMatches opens a matches file for reading, decompressing it when its
+// name ends in .gz
+func openMatches(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return file, nil
+	}
+	gz, err := gzip.NewReader(file)
+	if err == io.EOF {
+		// An empty file holds no matches
+		return file, nil
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &gzipFile{Reader: gz, file: file}, nil
+}
+
+// gzipFile closes both the decompressor and the file under it
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g *gzipFile) Close() error {
+	err := g.Reader.Close()
+	if closeErr := g.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// endTruncatedGzip is endUnterminatedLine for a compressed output. An
+// interrupted run leaves its gzip member without a trailer, and a member
+// appended after that could not be read, so the file is recompressed from its
+// readable complete lines. Only the truncated line is lost.
+func endTruncatedGzip(path string) error {
+	input, err := openMatches(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	_, err = io.Copy(io.Discard, input)
+	input.Close()
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+
+	slog.Warn("recompressing output left incomplete by an interrupted run", "file", path)
+	input, err = openMatches(path)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	return writeFileAtomic(path, func(w io.Writer) error {
+		gz := gzip.NewWriter(w)
+		lines := bufio.NewReaderSize(input, 64*1024)
+		for {
+			line, err := lines.ReadBytes('\n')
+			if err != nil {
+				// Drop the cut-off last line along with the missing trailer
+				if err != io.EOF && !errors.Is(err, io.ErrUnexpectedEOF) {
+					return err
+				}
+				break
+			}
+			if _, err := gz.Write(line); err != nil {
+				return err
+			}
+		}
+		return gz.Close()
+	})
+}
@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+)
+
+// countsFile is where -count-only writes its tallies
+const countsFile = "counts.json"
+
+// countWriter tallies match records per billing code instead of writing them.
+// The matcher hands it each match through WriteRecord; Write takes the encoded
+// records of a spool or a -limit or -schema writer in between. Like
+// partitionWriter it relies on the worker's writer mutex and on the matcher
+// writing one record per Write.
+type countWriter struct {
+	counts map[string]int
+	total  int
+}
+
+func newCountWriter() *countWriter {
+	return &countWriter{counts: make(map[string]int)}
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	var record struct {
+		BillingCode string `json:"billing_code"`
+	}
+	if err := json.Unmarshal(p, &record); err != nil {
+		return 0, fmt.Errorf("failed to read billing_code for counting: %v", err)
+	}
+	cw.add(record.BillingCode)
+	return len(p), nil
+}
+
+// WriteRecord counts a match without it being encoded
+func (cw *countWriter) WriteRecord(record map[string]interface{}) error {
+	code, _ := record["billing_code"].(string)
+	cw.add(code)
+	return nil
+}
+
+func (cw *countWriter) add(code string) {
+	cw.counts[code]++
+	cw.total++
+}
+
+func (cw *countWriter) Flush() error {
+	return nil
+}
+
+// matchCounts is the counts.json document
+type matchCounts struct {
+	Total        int            `json:"total"`
+	BillingCodes map[string]int `json:"billing_codes"`
+}
+
+// write saves the tallies to path
+func (cw *countWriter) write(path string) error {
+	data, err := json.MarshalIndent(matchCounts{Total: cw.total, BillingCodes: cw.counts}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// logCounts reports the matches per billing code, most matched first, and the total
+func (cw *countWriter) logCounts() {
+	codes := make([]string, 0, len(cw.counts))
+	for code := range cw.counts {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if cw.counts[codes[i]] != cw.counts[codes[j]] {
+			return cw.counts[codes[i]] > cw.counts[codes[j]]
+		}
+		return codes[i] < codes[j]
+	})
+
+	for _, code := range codes {
+		slog.Info("match count", "billing_code", code, "matches", cw.counts[code])
+	}
+	slog.Info("match count total", "matches", cw.total, "billing_codes", len(cw.counts))
+}
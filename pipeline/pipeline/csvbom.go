@@ -0,0 +1,23 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// csvBOM is the UTF-8 byte order mark -csv-bom writes before the header, so
+// Excel reads matches.csv as UTF-8
+var csvBOM = []byte{0xEF, 0xBB, 0xBF}
+
+// skipCSVBOM returns r past a leading byte order mark, reporting whether
+// there was one, so the first header name does not start with it
+func skipCSVBOM(r io.Reader) (io.Reader, bool) {
+	reader := bufio.NewReader(r)
+	prefix, _ := reader.Peek(len(csvBOM))
+	if !bytes.Equal(prefix, csvBOM) {
+		return reader, false
+	}
+	reader.Discard(len(csvBOM))
+	return reader, true
+}
@@ -0,0 +1,90 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sync/atomic"
+)
+
+// recordIdentity hashes the canonical JSON of a record's identity fields, or
+// of the whole record when keys is empty. encoding/json sorts map keys, so
+// equal records always hash the same.
+func recordIdentity(record map[string]interface{}, keys []string) (uint64, error) {
+	var value interface{} = record
+	if len(keys) > 0 {
+		fields := make(map[string]interface{}, len(keys))
+		for _, key := range keys {
+			fields[key] = record[key]
+		}
+		value = fields
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return 0, err
+	}
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64(), nil
+}
+
+// recordDiff filters matches down to records absent from a previous output
+type recordDiff struct {
+	keys []string
+	seen map[uint64]struct{} // read-only once loaded, so safe across workers
+
+	newRecords  atomic.Int64
+	seenRecords atomic.Int64
+}
+
+// loadRecordDiff reads the identities of every record in a previous JSON Lines output
+func loadRecordDiff(path string, keys []string) (*recordDiff, error) {
+	file, err := openMatches(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	d := &recordDiff{keys: keys, seen: make(map[uint64]struct{})}
+
+	lines := newJSONLReader(file, path)
+	for {
+		line, err := lines.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var record map[string]interface{}
+		if err := json.Unmarshal(line, &record); err != nil {
+			lines.skip(err.Error())
+			continue
+		}
+		id, err := recordIdentity(record, keys)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lines.line, err)
+		}
+		d.seen[id] = struct{}{}
+	}
+	lines.logUnreadable()
+
+	return d, nil
+}
+
+// keep reports whether a match is absent from the previous output. It is the
+// matcher's Keep hook, so each match is looked up and counted exactly once.
+func (d *recordDiff) keep(match map[string]interface{}) bool {
+	id, err := recordIdentity(match, d.keys)
+	if err == nil {
+		if _, ok := d.seen[id]; ok {
+			d.seenRecords.Add(1)
+			return false
+		}
+	}
+	d.newRecords.Add(1)
+	return true
+}
@@ -0,0 +1,60 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"search/matcher"
+)
+
+func TestRecordDiffCountsEachMatchOnce(t *testing.T) {
+	previous := filepath.Join(t.TempDir(), "previous.jsonl")
+	if err := os.WriteFile(previous, []byte(`{"billing_code":"99283","i":1}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	seen := `{"billing_code":"99283","i":1}`
+	unseen := `{"billing_code":"99283","i":2}`
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "object stream", input: seen + "\n" + unseen},
+		{name: "array", input: "[" + seen + "," + unseen + "]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, err := loadRecordDiff(previous, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := workerOptions{
+				match:      matcher.BillingCodePredicate(map[string]bool{"99283": true}),
+				keep:       diff.keep,
+				bufferSize: matcher.DefaultBufferSize,
+			}
+			var out bytes.Buffer
+			var bytesRead int64
+			stats, _, err := processFile(context.Background(), writeGzipFile(t, "in.json.gz", tt.input), &out, opts, &bytesRead)
+			if err != nil {
+				t.Fatalf("processFile: %v", err)
+			}
+			if got := diff.seenRecords.Load(); got != 1 {
+				t.Errorf("seenRecords = %d, want 1", got)
+			}
+			if got := diff.newRecords.Load(); got != 1 {
+				t.Errorf("newRecords = %d, want 1", got)
+			}
+			if stats.Matches != 1 || stats.NestedMatches != 0 {
+				t.Errorf("Matches = %d, NestedMatches = %d, want 1 and 0", stats.Matches, stats.NestedMatches)
+			}
+			if got := strings.TrimSpace(out.String()); got != unseen {
+				t.Errorf("output = %s, want %s", got, unseen)
+			}
+		})
+	}
+}
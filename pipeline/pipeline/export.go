@@ -0,0 +1,516 @@
+package pipeline
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit provider references to a reasonable number (e.g., 50 instead of 1798)
+const (
+	maxProviderRefColumns = 50
+	maxServiceCodeColumns = 100
+)
+
+// csvLayout is how many service code and provider reference columns the CSV has
+type csvLayout struct {
+	maxServiceCodes int
+	maxProviderRefs int
+}
+
+// fixedCSVLayout is the layout of a streamed export, which cannot size its
+// columns from records it has not read yet: every column up to the limits
+var fixedCSVLayout = csvLayout{maxServiceCodes: maxServiceCodeColumns, maxProviderRefs: maxProviderRefColumns}
+
+// sizeCSVLayout finds reasonable maximums for records, limiting excessive columns
+func sizeCSVLayout(records []ICD10Record) csvLayout {
+	maxServiceCodes := 0
+	maxProviderRefs := 0
+	maxProviderGroups := 0
+
+	for _, record := range records {
+		for _, rate := range record.NegotiatedRates {
+			for _, price := range rate.NegotiatedPrices {
+				if len(price.ServiceCode) > maxServiceCodes {
+					maxServiceCodes = len(price.ServiceCode)
+				}
+			}
+			if len(rate.ProviderReference) > maxProviderRefs {
+				maxProviderRefs = len(rate.ProviderReference)
+			}
+			if len(rate.ProviderGroups) > maxProviderGroups {
+				maxProviderGroups = len(rate.ProviderGroups)
+			}
+		}
+	}
+
+	// Apply reasonable limits
+	if maxServiceCodes > maxServiceCodeColumns {
+		slog.Info("limiting service code columns", "limit", maxServiceCodeColumns, "found", maxServiceCodes)
+		maxServiceCodes = maxServiceCodeColumns
+	}
+	if maxProviderRefs > maxProviderRefColumns {
+		slog.Info("limiting provider reference columns", "limit", maxProviderRefColumns, "found", maxProviderRefs)
+		maxProviderRefs = maxProviderRefColumns
+	}
+
+	slog.Info("computed column widths",
+		"max_service_codes", maxServiceCodes,
+		"max_provider_refs", maxProviderRefs,
+		"max_provider_groups", maxProviderGroups,
+	)
+	return csvLayout{maxServiceCodes: maxServiceCodes, maxProviderRefs: maxProviderRefs}
+}
+
+// columns returns the CSV header for this layout
+func (l csvLayout) columns(opts ExtractOptions) []string {
+	csvColumns, _ := l.selectedColumns(opts)
+
+	// The fingerprint covers every column before it
+	if opts.RowHash {
+		csvColumns = append(csvColumns, rowHashColumn)
+	}
+	return csvColumns
+}
+
+// selectedColumns returns the data columns written, as chosen by -columns or
+// by -include-columns and -exclude-columns, with the index of each in
+// allColumns: -1 for a numbered column past this layout's, which is written
+// empty. The indexes are nil when every column is written in order.
+func (l csvLayout) selectedColumns(opts ExtractOptions) ([]string, []int) {
+	allColumns := l.allColumns(opts)
+
+	if opts.Columns != nil {
+		index := make(map[string]int, len(allColumns))
+		for i, column := range allColumns {
+			index[column] = i
+		}
+		var names []string
+		var indexes []int
+		for _, name := range opts.Columns {
+			if slices.Contains(numberedColumnGroups, name) {
+				// A group name stands for its numbered columns in this layout
+				for i, column := range allColumns {
+					if columnGroup(column) == name {
+						names = append(names, column)
+						indexes = append(indexes, i)
+					}
+				}
+				continue
+			}
+			i, ok := index[name]
+			if !ok {
+				i = -1
+			}
+			names = append(names, name)
+			indexes = append(indexes, i)
+		}
+		return names, indexes
+	}
+
+	if opts.IncludeColumns == nil && opts.ExcludeColumns == nil {
+		return allColumns, nil
+	}
+	names := make([]string, 0, len(allColumns))
+	indexes := []int{}
+	for i, column := range allColumns {
+		if columnSelected(column, opts) {
+			names = append(names, column)
+			indexes = append(indexes, i)
+		}
+	}
+	return names, indexes
+}
+
+// allColumns returns every data column for this layout, before
+// -include-columns and -exclude-columns select among them
+func (l csvLayout) allColumns(opts ExtractOptions) []string {
+	// Define optimized CSV columns
+	csvColumns := []string{
+		"billing_code",
+		"billing_code_type",
+		"billing_code_type_version",
+	}
+	if opts.WithDescription {
+		csvColumns = append(csvColumns, "description")
+	}
+	csvColumns = append(csvColumns,
+		"name",
+		"negotiated_rates_count",
+		"negotiation_arrangement",
+		"negotiated_prices_count",
+		"billing_class",
+		"expiration_date",
+		"negotiated_rate",
+	)
+	if opts.PercentageColumn {
+		csvColumns = append(csvColumns, "negotiated_percentage") // negotiated_rate of a percentage price, kept apart from dollar amounts
+	}
+	csvColumns = append(csvColumns,
+		"negotiated_type",
+		"provider_references_count", // Count of provider references
+		"provider_groups_count",     // Count of provider groups
+		"total_npis_count",          // Total number of NPIs across all groups
+		"total_tins_count",          // Total number of TINs across all groups
+	)
+
+	// Add limited service code columns
+	for i := 0; i < l.maxServiceCodes; i++ {
+		csvColumns = append(csvColumns, fmt.Sprintf("service_code_%d", i+1))
+	}
+
+	// Add limited provider reference columns
+	for i := 0; i < l.maxProviderRefs; i++ {
+		csvColumns = append(csvColumns, fmt.Sprintf("provider_reference_%d", i+1))
+	}
+
+	// Add summary columns for first provider group (instead of all individual NPIs/TINs)
+	csvColumns = append(csvColumns, "first_group_npi_count")
+	csvColumns = append(csvColumns, "first_group_tin_type")
+	csvColumns = append(csvColumns, "first_group_tin_value")
+	return csvColumns
+}
+
+// csvOutput is where exportCSV writes, chosen once the columns are known
+type csvOutput struct {
+	w io.Writer
+	// resumed means an earlier run already wrote the header and the rows of
+	// the first records records, which are replayed without being written
+	resumed bool
+	records int
+	// checkpoint, when set, is called every extractCheckpointInterval with
+	// the records and rows written so far, after they are flushed to w
+	checkpoint func(records, rows int)
+}
+
+// ExportCSV writes the CSV rows of records to w, applying the row filters of
+// opts. Unless opts.StreamCSV is set, every record is read before anything is
+// written, to size the service code and provider reference columns; with no
+// records nothing is written. If ExportCSV fails, the rest of records is
+// drained so the sender is not blocked.
+func ExportCSV(w io.Writer, records <-chan ICD10Record, opts ExtractOptions) error {
+	_, err := exportCSV(records, opts, func([]string) (csvOutput, error) {
+		return csvOutput{w: w}, nil
+	})
+	return err
+}
+
+// exportCSV is ExportCSV writing to the output open returns for the columns.
+// It returns the number of rows, and skips open when there are no records to
+// size the columns from.
+func exportCSV(records <-chan ICD10Record, opts ExtractOptions, open func(columns []string) (csvOutput, error)) (int, error) {
+	defer func() {
+		for range records {
+		}
+	}()
+
+	var npis *npiFilter
+	if opts.NPIs != nil {
+		npis = &npiFilter{npis: opts.NPIs}
+	}
+	npiRecordsFiltered := 0
+	next := func() (ICD10Record, bool) {
+		for record := range records {
+			if npis != nil && !npis.keepRecord(&record) {
+				npiRecordsFiltered++
+				continue
+			}
+			return record, true
+		}
+		return ICD10Record{}, false
+	}
+
+	// Two passes: read every record to size the columns, then write them
+	var buffered []ICD10Record
+	layout := fixedCSVLayout
+	if !opts.StreamCSV {
+		for record, ok := next(); ok; record, ok = next() {
+			buffered = append(buffered, record)
+		}
+		if npis != nil {
+			npis.logSummary(npiRecordsFiltered)
+		}
+		if len(buffered) == 0 {
+			slog.Info("no records to process")
+			return 0, nil
+		}
+		layout = sizeCSVLayout(buffered)
+		next = func() (ICD10Record, bool) {
+			if len(buffered) == 0 {
+				return ICD10Record{}, false
+			}
+			record := buffered[0]
+			buffered = buffered[1:]
+			return record, true
+		}
+	}
+
+	csvColumns := layout.columns(opts)
+	output, err := open(csvColumns)
+	if err != nil {
+		return 0, err
+	}
+
+	if opts.CSVBOM && !output.resumed {
+		// Written to w itself, ahead of anything the csv.Writer buffers
+		if _, err := output.w.Write(csvBOM); err != nil {
+			return 0, err
+		}
+	}
+
+	writer := csv.NewWriter(output.w)
+
+	// Write header
+	if !output.resumed {
+		if err := writer.Write(csvColumns); err != nil {
+			return 0, err
+		}
+	}
+
+	// Process each record
+	rows := newCSVRows(layout, opts)
+	rowCount := 0
+	lastCheckpoint := time.Now()
+	for i := 0; ; i++ {
+		record, ok := next()
+		if !ok {
+			break
+		}
+
+		// Records already written are replayed without writing, so the
+		// deduper and counters end up as if the run had not stopped
+		replaying := output.resumed && i < output.records
+
+		for _, row := range rows.build(record) {
+			if !replaying {
+				if err := writer.Write(row); err != nil {
+					return rowCount, err
+				}
+			}
+			rowCount++
+		}
+
+		if (i+1)%10 == 0 {
+			slog.Debug("extraction progress", "processed", i+1)
+		}
+
+		if output.checkpoint != nil && !replaying && time.Since(lastCheckpoint) >= extractCheckpointInterval {
+			writer.Flush()
+			if err := writer.Error(); err != nil {
+				return rowCount, err
+			}
+			output.checkpoint(i+1, rowCount)
+			lastCheckpoint = time.Now()
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return rowCount, err
+	}
+
+	if opts.StreamCSV && npis != nil {
+		npis.logSummary(npiRecordsFiltered)
+	}
+	rows.logSummary(opts)
+	return rowCount, nil
+}
+
+// csvRows turns records into CSV rows, applying the row filters of the options
+type csvRows struct {
+	layout       csvLayout
+	columns      int // in a full row
+	description  bool
+	percentage   bool  // split percentage prices into negotiated_percentage
+	selected     []int // indexes of the columns written in a full row, -1 for an empty one; nil writes all
+	rowHash      bool
+	expiry       *expiryFilter
+	tins         *tinFilter
+	dedupe       *rowDeduper
+	serviceCodes *serviceCodeFilter
+}
+
+func newCSVRows(layout csvLayout, opts ExtractOptions) *csvRows {
+	rows := &csvRows{
+		layout:      layout,
+		columns:     len(layout.allColumns(opts)),
+		description: opts.WithDescription,
+		percentage:  opts.PercentageColumn,
+		rowHash:     opts.RowHash,
+		expiry:      &expiryFilter{asOf: opts.AsOf},
+		dedupe:      newRowDeduper(opts),
+	}
+	_, rows.selected = layout.selectedColumns(opts)
+	if opts.TINAllow != nil || opts.TINDeny != nil {
+		rows.tins = &tinFilter{allow: opts.TINAllow, deny: opts.TINDeny}
+	}
+	if opts.ValidServiceCodes != nil {
+		rows.serviceCodes = &serviceCodeFilter{valid: opts.ValidServiceCodes}
+	}
+	return rows
+}
+
+// negotiatedTypePercentage is the negotiated_type of a price whose
+// negotiated_rate is a percent of billed charges, not a dollar amount
+const negotiatedTypePercentage = "percentage"
+
+// rateColumns returns the negotiated_rate and negotiated_percentage values of
+// price. With split, only one is set, so percentages are never averaged with
+// dollars; without it, every rate goes in negotiated_rate.
+func rateColumns(price NegotiatedPrice, split bool) (rate, percentage string) {
+	value := fmt.Sprintf("%.2f", price.NegotiatedRate)
+	if split && strings.EqualFold(price.NegotiatedType, negotiatedTypePercentage) {
+		return "", value
+	}
+	return value, ""
+}
+
+// build returns the rows of one record that pass the filters
+func (r *csvRows) build(record ICD10Record) [][]string {
+	maxServiceCodes := r.layout.maxServiceCodes
+	maxProviderRefs := r.layout.maxProviderRefs
+
+	var rows [][]string
+	// For each negotiated rate, create a row
+	for _, rate := range record.NegotiatedRates {
+		// For each negotiated price, create a row
+		for _, price := range rate.NegotiatedPrices {
+			if !r.expiry.keep(price.ExpirationDate) {
+				continue
+			}
+
+			// Rows summarise the first provider group, so filter on its TIN
+			if r.tins != nil {
+				var tin string
+				if len(rate.ProviderGroups) > 0 {
+					tin = rate.ProviderGroups[0].TIN.Value
+				}
+				if !r.tins.keep(tin) {
+					continue
+				}
+			}
+
+			row := make([]string, 0, r.columns+1) // with room for the row hash
+
+			// Fill basic fields
+			row = append(row,
+				handleNullValues(record.BillingCode),
+				handleNullValues(record.BillingCodeType),
+				record.BillingCodeTypeVersion,
+			)
+			if r.description {
+				row = append(row, record.Description)
+			}
+			negotiatedRate, negotiatedPercentage := rateColumns(price, r.percentage)
+			row = append(row,
+				record.Name,
+				strconv.Itoa(len(record.NegotiatedRates)),
+				record.NegotiationArrangment,
+				strconv.Itoa(len(rate.NegotiatedPrices)),
+				price.BillingClass,
+				price.ExpirationDate,
+				negotiatedRate,
+			)
+			if r.percentage {
+				row = append(row, negotiatedPercentage)
+			}
+			row = append(row, price.NegotiatedType)
+
+			// Add provider and group counts (validation of counting logic)
+			row = append(row,
+				strconv.Itoa(len(rate.ProviderReference)), // provider_references_count
+				strconv.Itoa(len(rate.ProviderGroups)),    // provider_groups_count
+			)
+
+			// Calculate total NPIs and TINs across all groups
+			totalNPIs := 0
+			totalTINs := 0
+			for _, group := range rate.ProviderGroups {
+				totalNPIs += len(group.NPI)
+				totalTINs += 1 // Each group has exactly one TIN
+			}
+			row = append(row,
+				strconv.Itoa(totalNPIs), // total_npis_count
+				strconv.Itoa(totalTINs), // total_tins_count
+			)
+
+			// Fill service code columns
+			for j, serviceCode := range price.ServiceCode {
+				if j < maxServiceCodes {
+					if r.serviceCodes != nil {
+						serviceCode = r.serviceCodes.clean(serviceCode)
+					}
+					row = append(row, handleNullValues(serviceCode))
+				}
+			}
+			// Fill remaining service code columns with empty strings
+			for j := len(price.ServiceCode); j < maxServiceCodes; j++ {
+				row = append(row, "")
+			}
+
+			// Fill provider reference columns
+			for j, providerRef := range rate.ProviderReference {
+				if j < maxProviderRefs {
+					row = append(row, strconv.FormatFloat(providerRef, 'f', -1, 64))
+				}
+			}
+			// Fill remaining provider reference columns with empty strings
+			for j := len(rate.ProviderReference); j < maxProviderRefs; j++ {
+				row = append(row, "")
+			}
+
+			// Fill first provider group details (instead of all individual NPIs)
+			if len(rate.ProviderGroups) > 0 {
+				firstGroup := rate.ProviderGroups[0]
+				row = append(row,
+					strconv.Itoa(len(firstGroup.NPI)),      // first_group_npi_count
+					handleNullValues(firstGroup.TIN.Type),  // first_group_tin_type
+					handleNullValues(firstGroup.TIN.Value), // first_group_tin_value
+				)
+			} else {
+				row = append(row, "0", "", "")
+			}
+
+			if r.selected != nil {
+				full := row
+				row = make([]string, len(r.selected), len(r.selected)+1)
+				for j, column := range r.selected {
+					if column >= 0 {
+						row[j] = full[column]
+					}
+				}
+			}
+
+			if r.dedupe != nil && r.dedupe.duplicate(row) {
+				continue
+			}
+
+			if r.rowHash {
+				row = append(row, rowSHA256(row))
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// logSummary reports what the filters dropped or changed
+func (r *csvRows) logSummary(opts ExtractOptions) {
+	if !opts.AsOf.IsZero() {
+		slog.Info("dropped expired rows", "rows", r.expiry.dropped, "as_of", opts.AsOf.Format("2006-01-02"))
+	}
+	if r.tins != nil {
+		slog.Info("filtered rows by TIN", "rows", r.tins.filtered)
+	}
+	if r.dedupe != nil {
+		r.dedupe.logSummary()
+	}
+	if r.serviceCodes != nil {
+		slog.Info("blanked invalid service codes", "codes", r.serviceCodes.invalid)
+	}
+}
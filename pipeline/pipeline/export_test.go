@@ -0,0 +1,70 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+)
+
+func TestExportCSVPercentageColumn(t *testing.T) {
+	record := ICD10Record{
+		BillingCode: "99283",
+		NegotiatedRates: []NegotiatedRate{{
+			NegotiatedPrices: []NegotiatedPrice{
+				{NegotiatedRate: 120.5, NegotiatedType: "negotiated"},
+				{NegotiatedRate: 65, NegotiatedType: "percentage"},
+			},
+		}},
+	}
+
+	tests := []struct {
+		name       string
+		percentage bool
+		want       [][2]string // negotiated_rate and negotiated_percentage of each row
+	}{
+		{name: "default", want: [][2]string{{"120.50", ""}, {"65.00", ""}}},
+		{name: "percentage column", percentage: true, want: [][2]string{{"120.50", ""}, {"", "65.00"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := make(chan ICD10Record, 1)
+			records <- record
+			close(records)
+
+			var out bytes.Buffer
+			if err := ExportCSV(&out, records, ExtractOptions{PercentageColumn: tt.percentage}); err != nil {
+				t.Fatal(err)
+			}
+			rows, err := csv.NewReader(&out).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			column := make(map[string]int)
+			for i, name := range rows[0] {
+				column[name] = i
+			}
+			percentage, ok := column["negotiated_percentage"]
+			if ok != tt.percentage {
+				t.Fatalf("negotiated_percentage in header = %v, want %v", ok, tt.percentage)
+			}
+			if len(rows)-1 != len(tt.want) {
+				t.Fatalf("got %d rows, want %d", len(rows)-1, len(tt.want))
+			}
+			for i, want := range tt.want {
+				row := rows[i+1]
+				got := [2]string{row[column["negotiated_rate"]], ""}
+				if ok {
+					got[1] = row[percentage]
+				}
+				if got != want {
+					t.Errorf("row %d: rate, percentage = %q, want %q", i, got, want)
+				}
+				if row[column["negotiated_type"]] != record.NegotiatedRates[0].NegotiatedPrices[i].NegotiatedType {
+					t.Errorf("row %d: negotiated_type = %q", i, row[column["negotiated_type"]])
+				}
+			}
+		})
+	}
+}
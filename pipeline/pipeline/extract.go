@@ -0,0 +1,341 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Define the schema structure based on the actual JSON structure
+type NegotiatedPrice struct {
+	BillingClass   string   `json:"billing_class"`
+	ExpirationDate string   `json:"expiration_date"`
+	NegotiatedRate float64  `json:"negotiated_rate"`
+	NegotiatedType string   `json:"negotiated_type"`
+	ServiceCode    []string `json:"service_code"`
+}
+
+type NegotiatedRate struct {
+	NegotiatedPrices  []NegotiatedPrice `json:"negotiated_prices"`
+	ProviderReference []float64         `json:"provider_references"`
+	ProviderGroups    []ProviderGroup   `json:"provider_groups"`
+}
+
+type ProviderGroup struct {
+	NPI []NPI `json:"npi"`
+	TIN TIN   `json:"tin"`
+}
+
+type TIN struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type ICD10Record struct {
+	BillingCode            string           `json:"billing_code"`
+	BillingCodeType        string           `json:"billing_code_type"`
+	BillingCodeTypeVersion string           `json:"billing_code_type_version"`
+	Description            string           `json:"description"`
+	Name                   string           `json:"name"`
+	NegotiatedRates        []NegotiatedRate `json:"negotiated_rates"`
+	NegotiationArrangment  string           `json:"negotiation_arrangement"`
+}
+
+// handleNullValues replaces empty or null-like strings with "N/A" for cleaner CSV output.
+func handleNullValues(value string) string {
+	if value == "" || value == "<nil>" || value == "null" {
+		return "N/A"
+	}
+	return value
+}
+
+// ExtractOptions controls which negotiated prices ExtractToCSV writes.
+type ExtractOptions struct {
+	// AsOf drops prices whose expiration_date is before this date. Zero keeps everything.
+	AsOf time.Time
+	// AuditSchema logs fields in the input that ICD10Record does not model.
+	AuditSchema bool
+	// DedupeRows skips rows identical to one already written.
+	DedupeRows bool
+	// DedupeBloom makes DedupeRows approximate, using a Bloom filter sized for
+	// DedupeExpected rows at DedupeFPRate instead of an exact set.
+	DedupeBloom    bool
+	DedupeExpected int
+	DedupeFPRate   float64
+	// TINAllow and TINDeny keep or drop rows by the first provider group's
+	// TIN value. Nil means no filtering.
+	TINAllow map[string]bool
+	TINDeny  map[string]bool
+	// ColumnsManifest writes columns.json describing the CSV columns.
+	ColumnsManifest bool
+	// ValidServiceCodes blanks service codes not in the set. Nil passes every code.
+	ValidServiceCodes map[string]bool
+	// NPIs keeps only provider groups with a listed NPI, dropping rates and
+	// records left without groups. Nil means no filtering.
+	NPIs map[NPI]bool
+	// RowHash appends a row_sha256 column fingerprinting the other fields.
+	RowHash bool
+	// CSVBOM writes a UTF-8 byte order mark before the header, for Excel.
+	CSVBOM bool
+	// Resume continues an interrupted extraction from extract-checkpoint.json,
+	// appending to matches.csv, when the checkpoint matches this one.
+	Resume bool
+	// StreamCSV writes rows as records are read, with a column for every
+	// service code and provider reference up to the limits, instead of
+	// holding every record in memory to size the columns first.
+	StreamCSV bool
+	// WithDescription adds a description column after billing_code_type_version.
+	WithDescription bool
+	// PercentageColumn adds a negotiated_percentage column after
+	// negotiated_rate, holding the rate of percentage prices in place of
+	// negotiated_rate, so they are never averaged with dollar amounts.
+	PercentageColumn bool
+	// IncludeColumns keeps only the listed CSV columns and ExcludeColumns drops
+	// the listed ones, keeping the column order. service_code and
+	// provider_reference stand for all of their numbered columns. Nil means
+	// no selection.
+	IncludeColumns map[string]bool
+	ExcludeColumns map[string]bool
+	// Columns, when set, lists exactly the CSV columns to write and their
+	// order, instead of IncludeColumns and ExcludeColumns. service_code and
+	// provider_reference expand to all of their numbered columns; a numbered
+	// column past the widest record is written empty.
+	Columns []string
+}
+
+// rowDeduper remembers a 64-bit FNV hash of every row written. Memory grows with
+// the number of distinct rows, about 8 bytes plus map overhead per row, unless
+// a Bloom filter replaces the exact set: then memory is fixed, at the cost of
+// occasionally dropping a row that only collides with earlier ones.
+type rowDeduper struct {
+	seen    map[uint64]struct{}
+	bloom   *bloomFilter
+	removed int
+}
+
+// newRowDeduper returns the deduper selected by opts, or nil when DedupeRows is off
+func newRowDeduper(opts ExtractOptions) *rowDeduper {
+	if !opts.DedupeRows {
+		return nil
+	}
+	if opts.DedupeBloom {
+		bloom := newBloomFilter(opts.DedupeExpected, opts.DedupeFPRate)
+		slog.Info("deduplicating rows with a Bloom filter", "expected_rows", opts.DedupeExpected, "fp_rate", opts.DedupeFPRate, "hashes", bloom.k, "size_mb", fmt.Sprintf("%.1f", bloom.sizeMB))
+		return &rowDeduper{bloom: bloom}
+	}
+	return &rowDeduper{seen: make(map[uint64]struct{})}
+}
+
+// logSummary reports how many rows were removed and, for a Bloom filter, the
+// estimated false-positive rate reached with the rows actually seen
+func (d *rowDeduper) logSummary() {
+	if d.bloom == nil {
+		slog.Info("removed duplicate rows", "rows", d.removed)
+		return
+	}
+	slog.Info("removed duplicate rows", "rows", d.removed, "distinct_rows", d.bloom.items, "estimated_fp_rate", fmt.Sprintf("%.2g", d.bloom.falsePositiveRate()))
+}
+
+// duplicate reports whether an identical row was seen before, recording it if not
+func (d *rowDeduper) duplicate(row []string) bool {
+	h := fnv.New64a()
+	hashFields(h, row)
+	sum := h.Sum64()
+
+	if d.bloom != nil {
+		if d.bloom.add(sum) {
+			d.removed++
+			return true
+		}
+		return false
+	}
+	if _, ok := d.seen[sum]; ok {
+		d.removed++
+		return true
+	}
+	d.seen[sum] = struct{}{}
+	return false
+}
+
+// hashFields writes the fields to h, each followed by a NUL separator so
+// ["ab","c"] and ["a","bc"] differ. Field values are hashed rather than their
+// CSV encoding, so the hash does not depend on quoting.
+func hashFields(h hash.Hash, fields []string) {
+	for _, field := range fields {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+}
+
+// rowHashColumn is the column -row-hash appends
+const rowHashColumn = "row_sha256"
+
+// rowSHA256 is the hex SHA-256 of the fields, the row_sha256 value
+func rowSHA256(fields []string) string {
+	h := sha256.New()
+	hashFields(h, fields)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// expiryFilter decides whether a price is still effective on asOf.
+type expiryFilter struct {
+	asOf    time.Time
+	dropped int
+	warned  bool
+}
+
+// keep reports whether a price with the given expiration_date should be written.
+// Empty and unparseable dates are kept; the first unparseable one is logged.
+func (f *expiryFilter) keep(expirationDate string) bool {
+	if f.asOf.IsZero() || expirationDate == "" {
+		return true
+	}
+
+	expires, err := time.Parse("2006-01-02", expirationDate)
+	if err != nil {
+		if !f.warned {
+			slog.Warn("keeping prices with unparseable expiration_date", "value", expirationDate)
+			f.warned = true
+		}
+		return true
+	}
+
+	if expires.Before(f.asOf) {
+		f.dropped++
+		return false
+	}
+	return true
+}
+
+// ExtractToCSV reads a .jsonl file containing ICD10 records, flattens them, and writes them to a CSV file.
+// This optimized version limits excessive columns and adds proper summary statistics.
+func ExtractToCSV(input string, opts ExtractOptions) {
+	slog.Info("starting CSV extraction", "input", input)
+
+	// Read the JSONL file with matching objects.
+	jsonlFile, err := openMatches(input)
+	if err != nil {
+		if os.IsNotExist(err) {
+			slog.Warn("matches not found, skipping CSV extraction", "input", input)
+			return
+		}
+		panic(err)
+	}
+	defer jsonlFile.Close()
+	inputInfo, err := os.Stat(input)
+	if err != nil {
+		panic(err)
+	}
+
+	// Read the file line by line, skipping lines that are not records
+	records := make(chan ICD10Record)
+	go func() {
+		defer close(records)
+		lines := newJSONLReader(jsonlFile, input)
+
+		var auditor *schemaAuditor
+		if opts.AuditSchema {
+			auditor = newSchemaAuditor(ICD10Record{})
+		}
+
+		count := 0
+		for {
+			raw, err := lines.next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				panic(err)
+			}
+			var record ICD10Record
+			if err := json.Unmarshal(raw, &record); err != nil {
+				lines.skip(err.Error())
+				continue
+			}
+			if auditor != nil {
+				auditor.audit(raw)
+			}
+			records <- record
+			count++
+		}
+
+		lines.logUnreadable()
+		slog.Info("loaded records", "count", count, "input", input)
+		if auditor != nil {
+			slog.Info("schema audit complete", "unknown_fields", auditor.unknown, "missing_fields", auditor.missing)
+		}
+	}()
+
+	var csvFile *os.File
+	defer func() {
+		if csvFile != nil {
+			csvFile.Close()
+		}
+	}()
+	rowCount, err := exportCSV(records, opts, func(csvColumns []string) (csvOutput, error) {
+		// Records are written in file order, so a checkpoint of how many were
+		// written and where the CSV ended lets an interrupted run be resumed
+		checkpoint := newExtractCheckpoint(inputInfo, opts, csvColumns)
+		var resumeFrom *extractCheckpoint
+		if opts.Resume {
+			resumeFrom = resumePoint(checkpoint, "matches.csv")
+		}
+
+		// Create CSV output file, or cut it back to the checkpoint to resume
+		var err error
+		output := csvOutput{}
+		if resumeFrom != nil {
+			csvFile, err = os.OpenFile("matches.csv", os.O_WRONLY, 0644)
+			if err == nil {
+				err = csvFile.Truncate(resumeFrom.Offset)
+			}
+			if err == nil {
+				_, err = csvFile.Seek(resumeFrom.Offset, io.SeekStart)
+			}
+			output.resumed = true
+			output.records = resumeFrom.Records
+			slog.Info("resuming extraction", "records_done", resumeFrom.Records, "rows_done", resumeFrom.Rows, "offset", resumeFrom.Offset)
+		} else {
+			csvFile, err = os.Create("matches.csv")
+		}
+		if err != nil {
+			return output, err
+		}
+		output.w = csvFile
+		output.checkpoint = func(records, rows int) {
+			offset, err := csvFile.Seek(0, io.SeekCurrent)
+			if err != nil {
+				panic(err)
+			}
+			checkpoint.Records, checkpoint.Rows, checkpoint.Offset = records, rows, offset
+			if err := checkpoint.save(); err != nil {
+				slog.Warn("could not save extraction checkpoint", "file", extractCheckpointFile, "error", err)
+			}
+		}
+
+		if opts.ColumnsManifest {
+			if err := writeColumnsManifest(csvColumns); err != nil {
+				slog.Warn("could not write column manifest", "file", columnsManifestFile, "error", err)
+			} else {
+				slog.Info("wrote column manifest", "file", columnsManifestFile, "columns", len(csvColumns))
+			}
+		}
+		return output, nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	if csvFile == nil {
+		// No records, so no output
+		return
+	}
+	clearExtractCheckpoint()
+	slog.Info("extracted rows", "rows", rowCount, "output", "matches.csv")
+}
@@ -0,0 +1,139 @@
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"scraper/downloader"
+	"search/matcher"
+)
+
+// transientErrors are the I/O failures a later attempt may not hit: a
+// network mount or remote input dropping out or timing out
+var transientErrors = []error{
+	syscall.EIO,
+	syscall.ESTALE,
+	syscall.ETIMEDOUT,
+	syscall.ECONNRESET,
+	syscall.ECONNABORTED,
+	syscall.EAGAIN,
+	io.ErrUnexpectedEOF,
+	os.ErrDeadlineExceeded,
+}
+
+// isTransientFileError reports whether a failed file is worth another
+// attempt. Only errors recognised as transient are; everything else, such as
+// a missing or unreadable file, a corrupt gzip stream or malformed JSON, is
+// permanent.
+func isTransientFileError(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, transient := range transientErrors {
+		if errors.Is(err, transient) {
+			return true
+		}
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// processFileWithRetries runs processFile up to opts.fileRetries extra times on
+// transient errors. Each attempt writes to a temporary spool that is only
+// copied to writer once the attempt succeeds, so a failed attempt leaves no
+// partial matches behind. With opts.spoolMatches a single attempt is spooled
+// the same way.
+func processFileWithRetries(ctx context.Context, filePath string, writer outputWriter, opts workerOptions, bytesRead *int64) (matcher.Stats, string, error) {
+	if opts.fileRetries <= 0 && !opts.spoolMatches {
+		return processFile(ctx, filePath, writer, opts, bytesRead)
+	}
+
+	retry := downloader.DefaultRetryConfig
+	retry.MaxRetries = opts.fileRetries
+
+	var stats matcher.Stats
+	var hash string
+	var err error
+	for attempt := 0; attempt <= retry.MaxRetries; attempt++ {
+		if attempt > 0 {
+			delay := downloader.CalculateBackoffDelay(attempt-1, retry)
+			slog.Warn("retrying file", "file", filePath, "attempt", attempt+1, "delay", delay.Round(time.Millisecond), "error", err)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return stats, "", err
+			}
+		}
+
+		stats, hash, err = processFileSpooled(ctx, filePath, writer, opts, bytesRead)
+		if err == nil || !isTransientFileError(err) || ctx.Err() != nil {
+			break
+		}
+	}
+	return stats, hash, err
+}
+
+// processFileSpooled processes a file into a temporary spool and, on success,
+// replays the spooled records to writer one Write per record. Under -limit the
+// spool only takes the matches the run has left, counting only those that
+// opts.limitCounts lets through to the limit, as -schema does; a file with
+// more is stopped there and the run cancelled, so none of its matches are
+// written and the next run processes it whole.
+func processFileSpooled(ctx context.Context, filePath string, writer outputWriter, opts workerOptions, bytesRead *int64) (matcher.Stats, string, error) {
+	spool, err := os.CreateTemp("", "pipeline-spool-*.jsonl")
+	if err != nil {
+		return matcher.Stats{}, "", fmt.Errorf("failed to create spool file: %v", err)
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	spoolWriter := bufio.NewWriterSize(spool, 64*1024)
+	var out outputWriter = spoolWriter
+	var spoolLimit *limitWriter
+	if opts.limit != nil {
+		// The run is only cancelled once a match is refused, so a file
+		// ending exactly at the limit still completes
+		spoolLimit = &limitWriter{w: spoolWriter, limit: opts.limit.remaining(), cancel: func() {}, counts: opts.limitCounts}
+		out = spoolLimit
+	}
+	stats, hash, err := processFile(ctx, filePath, out, opts, bytesRead)
+	if spoolLimit != nil && spoolLimit.overflowed {
+		opts.limit.cancel()
+	}
+	if err != nil {
+		// None of the attempt's matches reach writer
+		return matcher.Stats{}, hash, err
+	}
+	if err := spoolWriter.Flush(); err != nil {
+		return stats, hash, fmt.Errorf("failed to write spool file: %v", err)
+	}
+
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return stats, hash, fmt.Errorf("failed to read spool file: %v", err)
+	}
+	reader := bufio.NewReaderSize(spool, 64*1024)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if _, err := writer.Write(line); err != nil {
+				return stats, hash, fmt.Errorf("failed to write match: %v", err)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return stats, hash, fmt.Errorf("failed to read spool file: %v", readErr)
+		}
+	}
+
+	return stats, hash, nil
+}
@@ -0,0 +1,71 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"search/matcher"
+)
+
+func TestIsTransientFileError(t *testing.T) {
+	// processFileError returns the error processFile fails with on path
+	processFileError := func(t *testing.T, path string) error {
+		t.Helper()
+		var bytesRead int64
+		opts := workerOptions{match: matcher.BillingCodePredicate(nil), bufferSize: matcher.DefaultBufferSize}
+		_, _, err := processFile(context.Background(), path, io.Discard, opts, &bytesRead)
+		if err == nil {
+			t.Fatalf("processFile(%s) succeeded", path)
+		}
+		return err
+	}
+	notGzip := filepath.Join(t.TempDir(), "in.json.gz")
+	if err := os.WriteFile(notGzip, []byte("this is not a gzip stream"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		err       func(t *testing.T) error
+		transient bool
+	}{
+		{name: "missing file", err: func(t *testing.T) error {
+			return processFileError(t, filepath.Join(t.TempDir(), "missing.json.gz"))
+		}},
+		{name: "corrupt gzip header", err: func(t *testing.T) error { return processFileError(t, notGzip) }},
+		{name: "malformed JSON", err: func(t *testing.T) error {
+			return processFileError(t, writeGzipFile(t, "in.json.gz", `[{"billing_code":}]`))
+		}},
+		{name: "truncated stream", err: func(t *testing.T) error {
+			return processFileError(t, writeGzipFile(t, "in.json.gz", `[{"billing_code":"1"`))
+		}, transient: true},
+		{name: "match limit", err: func(*testing.T) error { return fmt.Errorf("failed to write match: %v", errMatchLimit) }},
+		{name: "permission denied", err: func(*testing.T) error {
+			return fmt.Errorf("failed to open: %w", &os.PathError{Op: "open", Path: "x", Err: syscall.EACCES})
+		}},
+		{name: "I/O error", err: func(*testing.T) error {
+			return fmt.Errorf("failed to decode record: %w", &os.PathError{Op: "read", Path: "x", Err: syscall.EIO})
+		}, transient: true},
+		{name: "connection reset", err: func(*testing.T) error {
+			return fmt.Errorf("failed to decode record: %w", &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)})
+		}, transient: true},
+		{name: "timeout", err: func(*testing.T) error {
+			return fmt.Errorf("failed to fetch: %w", context.DeadlineExceeded)
+		}, transient: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.err(t)
+			if got := isTransientFileError(err); got != tt.transient {
+				t.Errorf("isTransientFileError(%v) = %v, want %v", err, got, tt.transient)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// Output formats for -format. jsonl keeps matches.jsonl as the final artifact;
+// json streams it into a pretty-printed array one record at a time; csv loads
+// every record into memory to size its columns; parquet streams records in but
+// buffers each row group in memory until it is flushed.
+const (
+	formatJSONL   = "jsonl"
+	formatJSON    = "json"
+	formatCSV     = "csv"
+	formatParquet = "parquet"
+)
+
+// validFormat reports whether format is one of the -format values
+func validFormat(format string) bool {
+	switch format {
+	case formatJSONL, formatJSON, formatCSV, formatParquet:
+		return true
+	}
+	return false
+}
+
+// ExtractToJSON rewrites input, matches.jsonl or matches.jsonl.gz, as a pretty-printed JSON array in matches.json
+func ExtractToJSON(input string) {
+	slog.Info("starting JSON extraction", "input", input)
+
+	jsonlFile, err := openMatches(input)
+	if err != nil {
+		if os.IsNotExist(err) {
+			slog.Warn("matches not found, skipping JSON extraction", "input", input)
+			return
+		}
+		panic(err)
+	}
+	defer jsonlFile.Close()
+
+	jsonFile, err := os.Create("matches.json")
+	if err != nil {
+		panic(err)
+	}
+	defer jsonFile.Close()
+
+	writer := bufio.NewWriter(jsonFile)
+	defer writer.Flush()
+
+	lines := newJSONLReader(jsonlFile, input)
+	var indented bytes.Buffer
+	count := 0
+
+	fmt.Fprint(writer, "[")
+	for {
+		raw, err := lines.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			panic(err)
+		}
+
+		indented.Reset()
+		if err := json.Indent(&indented, raw, "  ", "  "); err != nil {
+			panic(err)
+		}
+		if count > 0 {
+			fmt.Fprint(writer, ",")
+		}
+		fmt.Fprint(writer, "\n  ")
+		writer.Write(indented.Bytes())
+		count++
+	}
+	if count > 0 {
+		fmt.Fprint(writer, "\n")
+	}
+	fmt.Fprintln(writer, "]")
+
+	lines.logUnreadable()
+	slog.Info("extracted records", "records", count, "output", "matches.json")
+}
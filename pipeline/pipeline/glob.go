@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// globRoot returns the leading directories of pattern that contain no glob
+// metacharacters, which is where scanGlob starts walking
+func globRoot(pattern string) string {
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+	var root []string
+	for _, segment := range segments[:len(segments)-1] {
+		if strings.ContainsAny(segment, `*?[\`) {
+			break
+		}
+		root = append(root, segment)
+	}
+	if len(root) == 0 {
+		return "."
+	}
+	if joined := strings.Join(root, "/"); joined != "" {
+		return filepath.FromSlash(joined)
+	}
+	return "/" // pattern was absolute with a glob right after the leading slash
+}
+
+// matchGlob reports whether name matches pattern. Segments are matched with
+// path.Match, and a "**" segment matches any number of directories, including none.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// scanGlob walks the directories under pattern's root and plans every regular
+// file matching it, splitting them like scanGzipDir
+func scanGlob(pattern string, isProcessed func(plannedFile) bool) ([]plannedFile, []plannedFile, error) {
+	if _, err := path.Match(strings.ReplaceAll(filepath.ToSlash(pattern), "**", "*"), ""); err != nil {
+		return nil, nil, err
+	}
+	slashPattern := path.Clean(filepath.ToSlash(pattern))
+
+	var pending, skipped []plannedFile
+	err := filepath.WalkDir(globRoot(pattern), func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() || !matchGlob(slashPattern, filepath.ToSlash(filePath)) {
+			return nil
+		}
+
+		file := plannedFile{Path: filePath}
+		if info, err := entry.Info(); err == nil {
+			file.Size = info.Size()
+			file.ModTime = info.ModTime()
+		}
+
+		if isProcessed(file) {
+			skipped = append(skipped, file)
+		} else {
+			pending = append(pending, file)
+		}
+		return nil
+	})
+
+	return pending, skipped, err
+}
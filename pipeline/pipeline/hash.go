@@ -0,0 +1,183 @@
+package pipeline
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"search/matcher"
+)
+
+// hashFile computes the SHA-256 of a file's contents
+func hashFile(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// processedChecker returns a function reporting whether a file is already in the
+// processed-files log with unchanged contents. Only files modified after the log
+// was last written are re-hashed, unless rehash forces hashing every logged file.
+// A manifest-supplied expected hash is compared with the log instead of hashing.
+func processedChecker(processedFiles map[string]string, rehash bool) func(plannedFile) bool {
+	var logModTime time.Time
+	if info, err := os.Stat(processedFilesLog); err == nil {
+		logModTime = info.ModTime()
+	}
+
+	return func(file plannedFile) bool {
+		key := fileKey(file.Path)
+		storedHash, ok := processedFiles[key]
+		if !ok {
+			// Logs written before keys were paths hold basenames; one of those
+			// matches any file with that name and is re-keyed by its path
+			if storedHash, ok = processedFiles[legacyKey(file.Path)]; !ok {
+				return false
+			}
+			processedFiles[key] = storedHash
+		}
+		if file.ExpectedHash != "" && storedHash != "" && !rehash {
+			return file.ExpectedHash == storedHash
+		}
+		if !rehash && !file.ModTime.After(logModTime) {
+			return true
+		}
+
+		currentHash, err := hashFile(file.Path)
+		if err != nil {
+			slog.Warn("could not hash file, reprocessing it", "file", file.Path, "error", err)
+			return false
+		}
+		if storedHash == "" {
+			// Entry migrated from the name-only log: keep trusting the name
+			// as before and backfill the hash for future comparisons
+			processedFiles[key] = currentHash
+			return true
+		}
+		if currentHash != storedHash {
+			slog.Info("file contents changed since last run, reprocessing", "file", file.Path)
+			return false
+		}
+		return true
+	}
+}
+
+// processFile streams a gzip file through the matcher, hashing the raw bytes as
+// they are read so the content hash costs no extra pass over the file
+func processFile(ctx context.Context, filePath string, writer io.Writer, opts workerOptions, bytesRead *int64) (matcher.Stats, string, error) {
+	var file io.ReadCloser
+	var err error
+	if isURL(filePath) {
+		// The deadline covers the whole fetch, including streaming the body
+		ctx, cancel := context.WithTimeout(ctx, opts.fetchTimeout)
+		defer cancel()
+		file, err = openRemote(ctx, filePath, opts.retry)
+	} else {
+		file, err = os.Open(filePath)
+	}
+	if err != nil {
+		return matcher.Stats{}, "", fmt.Errorf("failed to create gzip processor: failed to open gzip file: %w", err)
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	// Reads fail once the run is cancelled, so a file in progress stops too
+	tee := io.TeeReader(&countingReader{r: contextReader{ctx, file}, n: bytesRead}, hasher)
+
+	var processor *matcher.StreamingGzipProcessor
+	var decompressed io.Reader
+	var teeOut *decompressedTee
+	if opts.teeDir != "" {
+		// Decompress here rather than in the matcher, so the decompressed
+		// bytes can be saved in the same pass
+		teeOut, err = createDecompressedTee(opts.teeDir, filePath, opts.teeNames)
+		if err != nil {
+			return matcher.Stats{}, "", err
+		}
+		defer teeOut.abort()
+
+		gzipReader, err := gzip.NewReader(tee)
+		if err != nil {
+			return matcher.Stats{}, "", fmt.Errorf("failed to create gzip processor: failed to create gzip reader: %w", err)
+		}
+		defer gzipReader.Close()
+		decompressed = io.TeeReader(gzipReader, teeOut)
+		processor = matcher.NewStreamingProcessorSize(decompressed, opts.match, opts.bufferSize)
+	} else {
+		processor, err = matcher.NewStreamingGzipProcessorSize(tee, opts.match, opts.bufferSize)
+		if err != nil {
+			return matcher.Stats{}, "", fmt.Errorf("failed to create gzip processor: %w", err)
+		}
+	}
+	processor.SkipBadRecords = opts.skipBadRecords
+	processor.MaxRecordBytes = opts.maxRecordBytes
+	processor.ExcludeCodes = opts.excludeCodes
+	processor.Extract = opts.extractPointer
+	processor.Workers = opts.intraFileWorkers
+	processor.Visit = opts.visit
+	processor.Keep = opts.keep
+
+	var stats matcher.Stats
+	if opts.jsonLines || isJSONLinesFile(filePath) {
+		stats, err = processor.ProcessJSONLines(writer)
+	} else {
+		stats, err = processor.ProcessMatches(writer)
+	}
+	if err != nil {
+		return stats, "", err
+	}
+
+	// The decoder may stop before the end of the file; save and hash the remainder
+	if decompressed != nil {
+		if _, err := io.Copy(io.Discard, decompressed); err != nil {
+			return stats, "", fmt.Errorf("failed to decompress file: %w", err)
+		}
+		if err := teeOut.commit(); err != nil {
+			return stats, "", err
+		}
+	}
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return stats, "", fmt.Errorf("failed to hash file: %w", err)
+	}
+
+	return stats, hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// countingReader adds the number of bytes read to n
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	*cr.n += int64(n)
+	return n, err
+}
+
+// contextReader fails reads with the context's error once it is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
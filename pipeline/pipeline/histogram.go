@@ -0,0 +1,106 @@
+package pipeline
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// codeHistogramFile is where -list-codes writes its tallies
+const codeHistogramFile = "code-histogram.csv"
+
+// codeKey identifies a histogram row; codeType is empty unless tallying by type
+type codeKey struct {
+	code     string
+	codeType string
+}
+
+// codeHistogram tallies the billing codes present in the input
+type codeHistogram struct {
+	mu     sync.Mutex
+	byType bool
+	counts map[codeKey]int
+}
+
+func newCodeHistogram(byType bool) *codeHistogram {
+	return &codeHistogram{byType: byType, counts: make(map[codeKey]int)}
+}
+
+// visit counts every object with a string billing_code in a decoded record,
+// the record itself and nested ones such as bundled codes alike. It is the
+// matcher's Visit hook, so each record is walked exactly once whatever the
+// input's structure.
+func (h *codeHistogram) visit(record map[string]interface{}) {
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if code, ok := v["billing_code"].(string); ok {
+				key := codeKey{code: code}
+				if h.byType {
+					key.codeType, _ = v["billing_code_type"].(string)
+				}
+				h.mu.Lock()
+				h.counts[key]++
+				h.mu.Unlock()
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(record)
+}
+
+// write saves the histogram as CSV, most frequent codes first
+func (h *codeHistogram) write(path string) error {
+	keys := make([]codeKey, 0, len(h.counts))
+	for key := range h.counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if h.counts[keys[i]] != h.counts[keys[j]] {
+			return h.counts[keys[i]] > h.counts[keys[j]]
+		}
+		if keys[i].code != keys[j].code {
+			return keys[i].code < keys[j].code
+		}
+		return keys[i].codeType < keys[j].codeType
+	})
+
+	header := []string{"billing_code", "count"}
+	if h.byType {
+		header = []string{"billing_code", "billing_code_type", "count"}
+	}
+	return writeFileAtomic(path, func(w io.Writer) error {
+		writer := csv.NewWriter(w)
+		if err := writer.Write(header); err != nil {
+			return err
+		}
+		for _, key := range keys {
+			row := []string{key.code, strconv.Itoa(h.counts[key])}
+			if h.byType {
+				row = []string{key.code, key.codeType, strconv.Itoa(h.counts[key])}
+			}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+}
+
+// total returns the number of records counted and distinct keys
+func (h *codeHistogram) total() (records, distinct int) {
+	for _, n := range h.counts {
+		records += n
+	}
+	return records, len(h.counts)
+}
@@ -0,0 +1,71 @@
+package pipeline
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"search/matcher"
+)
+
+// writeGzipFile writes data gzipped to name in a temporary directory
+func writeGzipFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := gzip.NewWriter(file)
+	if _, err := zw.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCodeHistogramCounts(t *testing.T) {
+	// Each input holds 99283 twice, once at the top level and once nested as
+	// a bundled code, and 99284 once
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "object stream", input: `{"billing_code":"99283","bundled_codes":[{"billing_code":"99284"}]} {"billing_code":"1","bundled_codes":[{"billing_code":"99283"}]}`},
+		{name: "array", input: `[{"billing_code":"99283","bundled_codes":[{"billing_code":"99284"}]},{"billing_code":"1","bundled_codes":[{"billing_code":"99283"}]}]`},
+		{name: "single object", input: `{"in_network":[{"billing_code":"99283"},{"billing_code":"99284"},{"billing_code":"1","bundled_codes":[{"billing_code":"99283"}]}]}`},
+	}
+	want := map[codeKey]int{{code: "99283"}: 2, {code: "99284"}: 1, {code: "1"}: 1}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newCodeHistogram(false)
+			opts := workerOptions{
+				match:      func(map[string]interface{}) bool { return false },
+				visit:      h.visit,
+				bufferSize: matcher.DefaultBufferSize,
+			}
+			var bytesRead int64
+			path := writeGzipFile(t, "in.json.gz", tt.input)
+			if _, _, err := processFile(context.Background(), path, io.Discard, opts, &bytesRead); err != nil {
+				t.Fatalf("processFile: %v", err)
+			}
+			if len(h.counts) != len(want) {
+				t.Errorf("counts = %v, want %v", h.counts, want)
+			}
+			for key, n := range want {
+				if h.counts[key] != n {
+					t.Errorf("count of %s = %d, want %d", key.code, h.counts[key], n)
+				}
+			}
+		})
+	}
+}
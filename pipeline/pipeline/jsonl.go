@@ -0,0 +1,88 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// jsonlReader reads a JSON Lines file such as matches.jsonl one line at a
+// time. A line that is not valid JSON, like the truncated tail an interrupted
+// run leaves before the next run appends to the file, is skipped and counted
+// instead of ending the read.
+type jsonlReader struct {
+	reader     *bufio.Reader
+	path       string
+	line       int
+	unreadable int
+}
+
+func newJSONLReader(r io.Reader, path string) *jsonlReader {
+	return &jsonlReader{reader: bufio.NewReaderSize(r, 64*1024), path: path}
+}
+
+// next returns the next valid JSON line, or io.EOF after the last one
+func (jr *jsonlReader) next() (json.RawMessage, error) {
+	for {
+		line, err := jr.reader.ReadBytes('\n')
+		if len(line) > 0 {
+			jr.line++
+			line = bytes.TrimSpace(line)
+			if len(line) > 0 {
+				if json.Valid(line) {
+					return line, nil
+				}
+				jr.skip("invalid JSON")
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// skip counts the current line as unreadable. Callers use it for lines that
+// are valid JSON but do not decode into the record type.
+func (jr *jsonlReader) skip(reason string) {
+	jr.unreadable++
+	slog.Warn("skipping unreadable line", "file", jr.path, "line", jr.line, "reason", reason)
+}
+
+// logUnreadable reports how many lines were skipped, if any
+func (jr *jsonlReader) logUnreadable() {
+	if jr.unreadable > 0 {
+		slog.Warn("skipped unreadable lines", "file", jr.path, "lines", jr.unreadable)
+	}
+}
+
+// endUnterminatedLine appends a newline to path if its last line was cut off,
+// so records appended after an interrupted run start on a line of their own
+// and only the truncated line is lost
+func endUnterminatedLine(path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, info.Size()-1); err != nil {
+		return err
+	}
+	if last[0] == '\n' {
+		return nil
+	}
+	slog.Warn("ended an incomplete last line, probably left by an interrupted run", "file", path)
+	_, err = file.WriteAt([]byte{'\n'}, info.Size())
+	return err
+}
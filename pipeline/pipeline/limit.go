@@ -0,0 +1,53 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+)
+
+// errMatchLimit is returned for writes past the -limit match count
+var errMatchLimit = errors.New("match limit reached")
+
+// limitWriter passes at most limit records through to w and cancels the run
+// once the limit is reached. Like the writer it wraps, it relies on the
+// worker's writer mutex and on the matcher writing one record per Write.
+type limitWriter struct {
+	w          outputWriter
+	limit      int
+	written    int
+	cancel     context.CancelFunc
+	overflowed bool // a record past the limit was refused
+	// counts reports whether a record counts towards the limit; the others
+	// pass through uncounted (nil = every record counts)
+	counts func(p []byte) bool
+}
+
+func (lw *limitWriter) Write(p []byte) (int, error) {
+	if lw.counts != nil && !lw.counts(p) {
+		return lw.w.Write(p)
+	}
+	if lw.written >= lw.limit {
+		lw.overflowed = true
+		return 0, errMatchLimit
+	}
+
+	n, err := lw.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	lw.written++
+	if lw.written >= lw.limit {
+		lw.cancel()
+	}
+	return n, nil
+}
+
+func (lw *limitWriter) Flush() error {
+	return lw.w.Flush()
+}
+
+// remaining is how many more records the limit lets through
+func (lw *limitWriter) remaining() int {
+	return max(lw.limit-lw.written, 0)
+}
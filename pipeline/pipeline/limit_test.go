@@ -0,0 +1,238 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"search/matcher"
+)
+
+// recordOutput is an outputWriter that checks every Write carries exactly one
+// JSON record, as limitWriter and schemaWriter assume, and keeps them
+type recordOutput struct {
+	t       *testing.T
+	records []string
+}
+
+func (ro *recordOutput) Write(p []byte) (int, error) {
+	line := string(p)
+	if strings.Count(line, "\n") != 1 || !strings.HasSuffix(line, "\n") || !json.Valid(p) {
+		ro.t.Errorf("Write of %q is not one JSON record", p)
+	}
+	ro.records = append(ro.records, strings.TrimSpace(line))
+	return len(p), nil
+}
+
+func (ro *recordOutput) Flush() error {
+	return nil
+}
+
+// limitTestFile writes an array of n matches, each tagged with name and its
+// index, and valid under limitTestSchema unless its index is in invalid
+func limitTestFile(t *testing.T, dir, name string, n int, invalid ...int) string {
+	t.Helper()
+	records := make([]string, n)
+	for i := range records {
+		ok := "true"
+		for _, bad := range invalid {
+			if i == bad {
+				ok = "false"
+			}
+		}
+		records[i] = fmt.Sprintf(`{"billing_code":"99283","file":%q,"i":%d,"ok":%s}`, name, i, ok)
+	}
+	path := writeGzipFile(t, name+".json.gz", "["+strings.Join(records, ",")+"]")
+	moved := filepath.Join(dir, name+".json.gz")
+	if err := os.Rename(path, moved); err != nil {
+		t.Fatal(err)
+	}
+	return moved
+}
+
+const limitTestSchema = `{"properties":{"ok":{"const":true}}}`
+
+func TestCutOffLeavesNoMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		sizes    map[string]int // matches in files a and b, processed in that order
+		invalid  []int          // indexes of file a's records that fail the schema
+		limit    int
+		schema   bool
+		cancelAt int // cancel the run, as -max-runtime would, at this record of file b (0 = never)
+		written  map[string]int
+		cutOff   map[string]bool
+	}{
+		{
+			name:    "under the limit",
+			sizes:   map[string]int{"a": 3, "b": 4},
+			limit:   10,
+			written: map[string]int{"a": 3, "b": 4},
+		},
+		{
+			name:    "limit at the end of a file",
+			sizes:   map[string]int{"a": 3, "b": 4},
+			limit:   3,
+			written: map[string]int{"a": 3},
+			cutOff:  map[string]bool{"b": true},
+		},
+		{
+			name:    "limit inside a file",
+			sizes:   map[string]int{"a": 3, "b": 4},
+			limit:   5,
+			written: map[string]int{"a": 3},
+			cutOff:  map[string]bool{"b": true},
+		},
+		{
+			name:    "limit inside the first file",
+			sizes:   map[string]int{"a": 3, "b": 4},
+			limit:   2,
+			written: map[string]int{},
+			cutOff:  map[string]bool{"a": true, "b": true},
+		},
+		{
+			name:    "invalid records do not count",
+			sizes:   map[string]int{"a": 5, "b": 1},
+			invalid: []int{1, 3},
+			limit:   3,
+			schema:  true,
+			written: map[string]int{"a": 3},
+			cutOff:  map[string]bool{"b": true},
+		},
+		{
+			name:     "max runtime inside a file",
+			sizes:    map[string]int{"a": 3, "b": 20000},
+			cancelAt: 10,
+			written:  map[string]int{"a": 3},
+			cutOff:   map[string]bool{"b": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Chdir(dir) // for the schema failures file
+			files := []string{
+				limitTestFile(t, dir, "a", tt.sizes["a"], tt.invalid...),
+				limitTestFile(t, dir, "b", tt.sizes["b"]),
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			out := &recordOutput{t: t}
+			var writer outputWriter = out
+			opts := workerOptions{
+				bufferSize:   matcher.MinBufferSize,
+				spoolMatches: true,
+			}
+			billingCode := matcher.BillingCodePredicate(map[string]bool{"99283": true})
+			opts.match = func(record map[string]interface{}) bool {
+				if tt.cancelAt > 0 && record["file"] == "b" && record["i"] == float64(tt.cancelAt) {
+					cancel()
+				}
+				return billingCode(record)
+			}
+			if tt.limit > 0 {
+				opts.limit = &limitWriter{w: writer, limit: tt.limit, cancel: cancel}
+				writer = opts.limit
+			}
+			if tt.schema {
+				schemaPath := filepath.Join(dir, "schema.json")
+				if err := os.WriteFile(schemaPath, []byte(limitTestSchema), 0644); err != nil {
+					t.Fatal(err)
+				}
+				schemaCheck, err := newSchemaWriter(writer, schemaPath, os.O_TRUNC)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer schemaCheck.Close()
+				opts.limitCounts = schemaCheck.accepts
+				writer = schemaCheck
+			}
+
+			jobs := make(chan string, len(files))
+			results := make(chan result, len(files))
+			for _, file := range files {
+				jobs <- file
+			}
+			close(jobs)
+			go worker(ctx, 1, jobs, results, writer, &sync.Mutex{}, opts)
+
+			reported := 0
+			for range files {
+				res := <-results
+				name := strings.TrimSuffix(filepath.Base(res.fileName), ".json.gz")
+				if res.cutOff != tt.cutOff[name] {
+					t.Errorf("file %s: cutOff = %v (error %v), want %v", name, res.cutOff, res.err, tt.cutOff[name])
+				}
+				if res.cutOff && res.stats.Matches != 0 {
+					t.Errorf("file %s: cut off but reports %d matches", name, res.stats.Matches)
+				}
+				if !res.cutOff && res.err != nil {
+					t.Errorf("file %s: %v", name, res.err)
+				}
+				reported += res.stats.Matches
+			}
+
+			written := make(map[string]int)
+			for _, line := range out.records {
+				var record struct {
+					File string `json:"file"`
+				}
+				if err := json.Unmarshal([]byte(line), &record); err != nil {
+					t.Fatal(err)
+				}
+				written[record.File]++
+			}
+			if fmt.Sprint(written) != fmt.Sprint(tt.written) {
+				t.Errorf("written = %v, want %v", written, tt.written)
+			}
+			// Valid records alone were written, but every match found is reported
+			if wantReported := len(out.records) + len(tt.invalid); reported != wantReported {
+				t.Errorf("results report %d matches, want %d", reported, wantReported)
+			}
+			if opts.limit != nil && opts.limit.written != len(out.records) {
+				t.Errorf("limit counted %d records, wrote %d", opts.limit.written, len(out.records))
+			}
+		})
+	}
+}
+
+func TestMatcherWritesOneRecordPerWrite(t *testing.T) {
+	records := strings.Join(billingCodeRecords(100), ",")
+	tests := []struct {
+		name             string
+		file             string
+		input            string
+		intraFileWorkers int
+	}{
+		{name: "array", file: "in.json.gz", input: "[" + records + "]"},
+		{name: "array on workers", file: "in.json.gz", input: "[" + records + "]", intraFileWorkers: 4},
+		{name: "object stream", file: "in.json.gz", input: strings.ReplaceAll(records, "},{", "}\n{")},
+		{name: "json lines", file: "in.jsonl.gz", input: strings.ReplaceAll(records, "},{", "}\n{")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &recordOutput{t: t}
+			opts := workerOptions{
+				match:            matcher.BillingCodePredicate(map[string]bool{"99283": true}),
+				bufferSize:       matcher.MinBufferSize,
+				intraFileWorkers: tt.intraFileWorkers,
+			}
+			var bytesRead int64
+			stats, _, err := processFile(context.Background(), writeGzipFile(t, tt.file, tt.input), out, opts, &bytesRead)
+			if err != nil {
+				t.Fatalf("processFile: %v", err)
+			}
+			if stats.Matches != 100 || len(out.records) != 100 {
+				t.Errorf("Matches = %d, Writes = %d, want 100 of each", stats.Matches, len(out.records))
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// manifestEntry is one line of a -manifest file
+type manifestEntry struct {
+	Path         string `json:"path"`
+	ExpectedHash string `json:"expected_hash"`
+}
+
+// loadManifest reads an NDJSON manifest of input files and splits them the same
+// way scanGzipDir does. Paths are used as given, relative to the working directory,
+// and may also be http(s) URLs that workers stream directly.
+func loadManifest(manifestPath string, isProcessed func(plannedFile) bool) ([]plannedFile, []plannedFile, error) {
+	file, err := os.Open(manifestPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	var pending, skipped []plannedFile
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var entry manifestEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, nil, fmt.Errorf("manifest line %d: %v", lineNum, err)
+		}
+		if entry.Path == "" {
+			return nil, nil, fmt.Errorf("manifest line %d: missing path", lineNum)
+		}
+
+		planned := plannedFile{Path: entry.Path, ExpectedHash: strings.ToLower(entry.ExpectedHash)}
+		// Remote inputs have nothing to stat and are skipped by name once processed
+		if !isURL(entry.Path) {
+			if info, err := os.Stat(entry.Path); err == nil {
+				planned.Size = info.Size()
+				planned.ModTime = info.ModTime()
+			}
+		}
+
+		if isProcessed(planned) {
+			skipped = append(skipped, planned)
+		} else {
+			pending = append(pending, planned)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return pending, skipped, nil
+}
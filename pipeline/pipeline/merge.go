@@ -0,0 +1,148 @@
+package pipeline
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// mergeColumns returns the union of the CSV headers. Each column missing from
+// the union is inserted after the column preceding it in its own header, so
+// service_code_3 from a wider shard lands after service_code_2 rather than at
+// the end.
+func mergeColumns(headers [][]string) []string {
+	var union []string
+	for _, header := range headers {
+		prev := -1
+		for _, column := range header {
+			idx := -1
+			for i, existing := range union {
+				if existing == column {
+					idx = i
+					break
+				}
+			}
+			if idx < 0 {
+				idx = prev + 1
+				union = append(union, "")
+				copy(union[idx+1:], union[idx:])
+				union[idx] = column
+			}
+			prev = idx
+		}
+	}
+	return union
+}
+
+// readCSVHeader returns the first row of a CSV file
+func readCSVHeader(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	input, _ := skipCSVBOM(file)
+	header, err := csv.NewReader(input).Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header of %s: %v", path, err)
+	}
+	return header, nil
+}
+
+// mergeCSVs writes the rows of every input CSV to outPath under the union of
+// their headers, leaving columns an input lacks empty. Only the headers are
+// read up front; rows are streamed one at a time.
+func mergeCSVs(outPath string, inputs []string) error {
+	headers := make([][]string, len(inputs))
+	for i, input := range inputs {
+		header, err := readCSVHeader(input)
+		if err != nil {
+			return err
+		}
+		headers[i] = header
+	}
+	columns := mergeColumns(headers)
+	position := make(map[string]int, len(columns))
+	for i, column := range columns {
+		position[column] = i
+	}
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	writer := csv.NewWriter(out)
+	if err := writer.Write(columns); err != nil {
+		return err
+	}
+
+	totalRows := 0
+	row := make([]string, len(columns))
+	for i, input := range inputs {
+		// Map each input column to its place in the union
+		targets := make([]int, len(headers[i]))
+		for j, column := range headers[i] {
+			targets[j] = position[column]
+		}
+
+		rows, err := copyAlignedRows(writer, input, targets, row)
+		if err != nil {
+			return err
+		}
+		slog.Info("merged CSV", "file", input, "rows", rows, "columns", len(headers[i]))
+		totalRows += rows
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	slog.Info("merge complete", "output", outPath, "files", len(inputs), "rows", totalRows, "columns", len(columns))
+	return out.Close()
+}
+
+// copyAlignedRows writes every data row of input, moving field j to
+// row[targets[j]] and blanking the rest of row
+func copyAlignedRows(writer *csv.Writer, input string, targets []int, row []string) (int, error) {
+	file, err := os.Open(input)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.ReuseRecord = true
+	if _, err := reader.Read(); err != nil { // header
+		return 0, fmt.Errorf("failed to read header of %s: %v", input, err)
+	}
+
+	rows := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return rows, fmt.Errorf("failed to read %s: %v", input, err)
+		}
+
+		for k := range row {
+			row[k] = ""
+		}
+		for j, value := range record {
+			row[targets[j]] = value
+		}
+		if err := writer.Write(row); err != nil {
+			return rows, err
+		}
+		rows++
+	}
+}
@@ -0,0 +1,142 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+)
+
+// slowestFilesReported is how many of the slowest files are kept in the metrics
+const slowestFilesReported = 10
+
+// fileMetrics is the throughput of a single processed file
+type fileMetrics struct {
+	File           string  `json:"file"`
+	Worker         int     `json:"worker"`
+	Seconds        float64 `json:"seconds"`
+	BytesRead      int64   `json:"bytes_read"`
+	RecordsScanned int     `json:"records_scanned"`
+	Matches        int     `json:"matches"`
+	NestedMatches  int     `json:"nested_matches"`
+	Failed         bool    `json:"failed,omitempty"`
+}
+
+// workerMetrics is how busy a worker was during the run
+type workerMetrics struct {
+	Worker      int     `json:"worker"`
+	Files       int     `json:"files"`
+	BusySeconds float64 `json:"busy_seconds"`
+	Utilization float64 `json:"utilization"`
+}
+
+// runMetrics aggregates throughput for a whole pipeline run
+type runMetrics struct {
+	start time.Time
+	files []fileMetrics
+	busy  map[int]time.Duration
+	count map[int]int
+
+	Workers          int             `json:"workers"`
+	ElapsedSeconds   float64         `json:"elapsed_seconds"`
+	FilesProcessed   int             `json:"files_processed"`
+	BytesRead        int64           `json:"bytes_read"`
+	RecordsScanned   int             `json:"records_scanned"`
+	Matches          int             `json:"matches"`
+	NestedMatches    int             `json:"nested_matches"`
+	RecordsPerSecond float64         `json:"records_per_second"`
+	MBPerSecond      float64         `json:"mb_per_second"`
+	PerWorker        []workerMetrics `json:"per_worker"`
+	SlowestFiles     []fileMetrics   `json:"slowest_files"`
+}
+
+func newRunMetrics(workers int) *runMetrics {
+	return &runMetrics{
+		start:   time.Now(),
+		busy:    make(map[int]time.Duration),
+		count:   make(map[int]int),
+		Workers: workers,
+	}
+}
+
+// add records the outcome of one file
+func (m *runMetrics) add(res result) {
+	m.files = append(m.files, fileMetrics{
+		File:           res.fileName,
+		Worker:         res.workerID,
+		Seconds:        res.duration.Seconds(),
+		BytesRead:      res.bytesRead,
+		RecordsScanned: res.stats.RecordsScanned,
+		Matches:        res.stats.Matches,
+		NestedMatches:  res.stats.NestedMatches,
+		Failed:         res.err != nil,
+	})
+	m.busy[res.workerID] += res.duration
+	m.count[res.workerID]++
+
+	m.FilesProcessed++
+	m.BytesRead += res.bytesRead
+	m.RecordsScanned += res.stats.RecordsScanned
+	m.Matches += res.stats.Matches
+	m.NestedMatches += res.stats.NestedMatches
+}
+
+// finish computes the rates, utilization and slowest files once all results are in
+func (m *runMetrics) finish() {
+	elapsed := time.Since(m.start)
+	m.ElapsedSeconds = elapsed.Seconds()
+	if m.ElapsedSeconds > 0 {
+		m.RecordsPerSecond = float64(m.RecordsScanned) / m.ElapsedSeconds
+		m.MBPerSecond = float64(m.BytesRead) / (1024 * 1024) / m.ElapsedSeconds
+	}
+
+	m.PerWorker = m.PerWorker[:0]
+	for id := 1; id <= m.Workers; id++ {
+		wm := workerMetrics{
+			Worker:      id,
+			Files:       m.count[id],
+			BusySeconds: m.busy[id].Seconds(),
+		}
+		if elapsed > 0 {
+			wm.Utilization = float64(m.busy[id]) / float64(elapsed)
+		}
+		m.PerWorker = append(m.PerWorker, wm)
+	}
+
+	slowest := append([]fileMetrics(nil), m.files...)
+	sort.Slice(slowest, func(i, j int) bool { return slowest[i].Seconds > slowest[j].Seconds })
+	if len(slowest) > slowestFilesReported {
+		slowest = slowest[:slowestFilesReported]
+	}
+	m.SlowestFiles = slowest
+}
+
+// log prints the run throughput summary
+func (m *runMetrics) log() {
+	slog.Info("throughput",
+		"elapsed", time.Duration(m.ElapsedSeconds*float64(time.Second)).Round(time.Millisecond),
+		"records_scanned", m.RecordsScanned,
+		"records_per_sec", fmt.Sprintf("%.0f", m.RecordsPerSecond),
+		"mb_per_sec", fmt.Sprintf("%.2f", m.MBPerSecond),
+	)
+	for _, wm := range m.PerWorker {
+		slog.Info("worker utilization", "worker", wm.Worker, "files", wm.Files, "utilization", fmt.Sprintf("%.1f%%", wm.Utilization*100))
+	}
+	for _, fm := range m.SlowestFiles {
+		slog.Debug("slow file", "file", fm.File, "seconds", fm.Seconds, "bytes_read", fm.BytesRead)
+	}
+}
+
+// write saves the metrics as JSON
+func (m *runMetrics) write(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(m)
+}
@@ -0,0 +1,128 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// NPI is a National Provider Identifier. Publishers write NPIs as JSON
+// numbers or as strings; both decode to the exact digits, where a float64
+// would round long values and reject strings.
+type NPI string
+
+func (n *NPI) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*n = ""
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*n = NPI(strings.TrimSpace(s))
+		return nil
+	}
+
+	literal := string(data)
+	if !strings.ContainsAny(literal, ".eE") {
+		*n = NPI(literal)
+		return nil
+	}
+	// Written as 1234567893.0 or 1.234567893e9: keep the integer value
+	value, ok := new(big.Float).SetString(literal)
+	if !ok {
+		return fmt.Errorf("invalid NPI %s", literal)
+	}
+	integer, _ := value.Int(nil)
+	*n = NPI(integer.String())
+	return nil
+}
+
+// loadNPIs reads NPIs, one per line, from path. Blank lines and lines
+// starting with # are ignored.
+func loadNPIs(path string) (map[NPI]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	npis := make(map[NPI]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		npi := strings.TrimSpace(scanner.Text())
+		if npi == "" || strings.HasPrefix(npi, "#") {
+			continue
+		}
+		npis[NPI(npi)] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(npis) == 0 {
+		return nil, fmt.Errorf("no NPIs found in %s", path)
+	}
+	return npis, nil
+}
+
+// npiFilter keeps only the provider groups with a listed NPI, and the rates
+// and records left with at least one such group
+type npiFilter struct {
+	npis           map[NPI]bool
+	groupsKept     int
+	groupsFiltered int
+	rowsFiltered   int
+}
+
+// keepRecord removes the unlisted provider groups from record, then the rates
+// without groups left, and reports whether any rate remains. Rates that only
+// use provider_references have no NPIs to check and are removed.
+func (f *npiFilter) keepRecord(record *ICD10Record) bool {
+	rates := record.NegotiatedRates[:0]
+	for _, rate := range record.NegotiatedRates {
+		groups := rate.ProviderGroups[:0]
+		for _, group := range rate.ProviderGroups {
+			if f.hasListedNPI(group) {
+				groups = append(groups, group)
+			}
+		}
+		f.groupsKept += len(groups)
+		f.groupsFiltered += len(rate.ProviderGroups) - len(groups)
+		rate.ProviderGroups = groups
+
+		if len(groups) == 0 {
+			f.rowsFiltered += len(rate.NegotiatedPrices)
+			continue
+		}
+		rates = append(rates, rate)
+	}
+	record.NegotiatedRates = rates
+	return len(rates) > 0
+}
+
+func (f *npiFilter) hasListedNPI(group ProviderGroup) bool {
+	for _, npi := range group.NPI {
+		if f.npis[npi] {
+			return true
+		}
+	}
+	return false
+}
+
+// logSummary reports how many provider groups, rows and records were kept or filtered
+func (f *npiFilter) logSummary(recordsFiltered int) {
+	slog.Info("filtered provider groups by NPI",
+		"groups_kept", f.groupsKept,
+		"groups_filtered", f.groupsFiltered,
+		"rows_filtered", f.rowsFiltered,
+		"records_filtered", recordsFiltered,
+	)
+}
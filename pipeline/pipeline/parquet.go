@@ -0,0 +1,243 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetRow is one negotiated price of an ICD10Record, with the same columns
+// as a matches.csv row. service_code and provider_references are list columns
+// holding every value, where the CSV spreads them over a capped number of
+// service_code_N and provider_reference_N columns.
+type parquetRow struct {
+	BillingCode            string    `parquet:"billing_code"`
+	BillingCodeType        string    `parquet:"billing_code_type"`
+	BillingCodeTypeVersion string    `parquet:"billing_code_type_version"`
+	Name                   string    `parquet:"name"`
+	Description            string    `parquet:"description"`
+	NegotiatedRatesCount   int32     `parquet:"negotiated_rates_count"`
+	NegotiationArrangement string    `parquet:"negotiation_arrangement"`
+	NegotiatedPricesCount  int32     `parquet:"negotiated_prices_count"`
+	BillingClass           string    `parquet:"billing_class"`
+	ExpirationDate         string    `parquet:"expiration_date"`
+	NegotiatedRate         float64   `parquet:"negotiated_rate"`
+	NegotiatedType         string    `parquet:"negotiated_type"`
+	ServiceCodes           []string  `parquet:"service_code,list"`
+	ProviderReferences     []float64 `parquet:"provider_references,list"`
+	ProviderReferenceCount int32     `parquet:"provider_references_count"`
+	ProviderGroupsCount    int32     `parquet:"provider_groups_count"`
+	TotalNPIsCount         int64     `parquet:"total_npis_count"`
+	TotalTINsCount         int32     `parquet:"total_tins_count"`
+	FirstGroupNPICount     int32     `parquet:"first_group_npi_count"`
+	FirstGroupTINType      string    `parquet:"first_group_tin_type"`
+	FirstGroupTINValue     string    `parquet:"first_group_tin_value"`
+}
+
+// dedupeFields lists the row's values for -dedupe-rows, one field each and
+// every list preceded by its length, so distinct rows never share a key
+func (r parquetRow) dedupeFields() []string {
+	formatFloat := func(f float64) string { return strconv.FormatFloat(f, 'g', -1, 64) }
+	fields := []string{
+		r.BillingCode,
+		r.BillingCodeType,
+		r.BillingCodeTypeVersion,
+		r.Name,
+		r.Description,
+		strconv.Itoa(int(r.NegotiatedRatesCount)),
+		r.NegotiationArrangement,
+		strconv.Itoa(int(r.NegotiatedPricesCount)),
+		r.BillingClass,
+		r.ExpirationDate,
+		formatFloat(r.NegotiatedRate),
+		r.NegotiatedType,
+		strconv.Itoa(len(r.ServiceCodes)),
+	}
+	fields = append(fields, r.ServiceCodes...)
+	fields = append(fields, strconv.Itoa(len(r.ProviderReferences)))
+	for _, ref := range r.ProviderReferences {
+		fields = append(fields, formatFloat(ref))
+	}
+	return append(fields,
+		strconv.Itoa(int(r.ProviderReferenceCount)),
+		strconv.Itoa(int(r.ProviderGroupsCount)),
+		strconv.FormatInt(r.TotalNPIsCount, 10),
+		strconv.Itoa(int(r.TotalTINsCount)),
+		strconv.Itoa(int(r.FirstGroupNPICount)),
+		r.FirstGroupTINType,
+		r.FirstGroupTINValue,
+	)
+}
+
+// parquetBatchSize is how many rows are handed to the writer at once, and
+// parquetRowGroupSize how many it buffers before writing out a row group
+const (
+	parquetBatchSize    = 1000
+	parquetRowGroupSize = 100000
+)
+
+// WriteParquet reads ICD10 records from input and writes one row per
+// negotiated price to matches.parquet, applying the same -as-of, TIN and
+// -dedupe-rows filters as ExtractToCSV. Invalid service codes are left out of
+// the service_code list. Unlike the CSV path it needs no first
+// pass to size columns, so records are streamed and only the current row group
+// is held in memory.
+func WriteParquet(input string, opts ExtractOptions) {
+	slog.Info("starting Parquet extraction", "input", input)
+
+	jsonlFile, err := openMatches(input)
+	if err != nil {
+		if os.IsNotExist(err) {
+			slog.Warn("matches not found, skipping Parquet extraction", "input", input)
+			return
+		}
+		panic(err)
+	}
+	defer jsonlFile.Close()
+
+	parquetFile, err := os.Create("matches.parquet")
+	if err != nil {
+		panic(err)
+	}
+	defer parquetFile.Close()
+
+	writer := parquet.NewGenericWriter[parquetRow](parquetFile, parquet.MaxRowsPerRowGroup(parquetRowGroupSize))
+
+	expiry := &expiryFilter{asOf: opts.AsOf}
+	var tins *tinFilter
+	if opts.TINAllow != nil || opts.TINDeny != nil {
+		tins = &tinFilter{allow: opts.TINAllow, deny: opts.TINDeny}
+	}
+	dedupe := newRowDeduper(opts)
+	var serviceCodes *serviceCodeFilter
+	if opts.ValidServiceCodes != nil {
+		serviceCodes = &serviceCodeFilter{valid: opts.ValidServiceCodes}
+	}
+
+	var npis *npiFilter
+	if opts.NPIs != nil {
+		npis = &npiFilter{npis: opts.NPIs}
+	}
+	npiRecordsFiltered := 0
+
+	batch := make([]parquetRow, 0, parquetBatchSize)
+	flush := func() {
+		if _, err := writer.Write(batch); err != nil {
+			panic(err)
+		}
+		batch = batch[:0]
+	}
+
+	recordCount := 0
+	rowCount := 0
+	lines := newJSONLReader(jsonlFile, input)
+	for {
+		raw, err := lines.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			panic(err)
+		}
+		var record ICD10Record
+		if err := json.Unmarshal(raw, &record); err != nil {
+			lines.skip(err.Error())
+			continue
+		}
+		recordCount++
+		if npis != nil && !npis.keepRecord(&record) {
+			npiRecordsFiltered++
+			continue
+		}
+
+		for _, rate := range record.NegotiatedRates {
+			var firstGroup ProviderGroup
+			if len(rate.ProviderGroups) > 0 {
+				firstGroup = rate.ProviderGroups[0]
+			}
+			totalNPIs := 0
+			for _, group := range rate.ProviderGroups {
+				totalNPIs += len(group.NPI)
+			}
+
+			for _, price := range rate.NegotiatedPrices {
+				if !expiry.keep(price.ExpirationDate) {
+					continue
+				}
+				if tins != nil && !tins.keep(firstGroup.TIN.Value) {
+					continue
+				}
+
+				codes := price.ServiceCode
+				if serviceCodes != nil {
+					codes = nil
+					for _, code := range price.ServiceCode {
+						if code = serviceCodes.clean(code); code != "" {
+							codes = append(codes, code)
+						}
+					}
+				}
+
+				row := parquetRow{
+					BillingCode:            record.BillingCode,
+					BillingCodeType:        record.BillingCodeType,
+					BillingCodeTypeVersion: record.BillingCodeTypeVersion,
+					Name:                   record.Name,
+					Description:            record.Description,
+					NegotiatedRatesCount:   int32(len(record.NegotiatedRates)),
+					NegotiationArrangement: record.NegotiationArrangment,
+					NegotiatedPricesCount:  int32(len(rate.NegotiatedPrices)),
+					BillingClass:           price.BillingClass,
+					ExpirationDate:         price.ExpirationDate,
+					NegotiatedRate:         price.NegotiatedRate,
+					NegotiatedType:         price.NegotiatedType,
+					ServiceCodes:           codes,
+					ProviderReferences:     rate.ProviderReference,
+					ProviderReferenceCount: int32(len(rate.ProviderReference)),
+					ProviderGroupsCount:    int32(len(rate.ProviderGroups)),
+					TotalNPIsCount:         int64(totalNPIs),
+					TotalTINsCount:         int32(len(rate.ProviderGroups)), // each group has exactly one TIN
+					FirstGroupNPICount:     int32(len(firstGroup.NPI)),
+					FirstGroupTINType:      firstGroup.TIN.Type,
+					FirstGroupTINValue:     firstGroup.TIN.Value,
+				}
+				if dedupe != nil && dedupe.duplicate(row.dedupeFields()) {
+					continue
+				}
+
+				batch = append(batch, row)
+				rowCount++
+				if len(batch) == parquetBatchSize {
+					flush()
+				}
+			}
+		}
+	}
+	flush()
+
+	if err := writer.Close(); err != nil {
+		panic(err)
+	}
+
+	lines.logUnreadable()
+	if !opts.AsOf.IsZero() {
+		slog.Info("dropped expired rows", "rows", expiry.dropped, "as_of", opts.AsOf.Format("2006-01-02"))
+	}
+	if tins != nil {
+		slog.Info("filtered rows by TIN", "rows", tins.filtered)
+	}
+	if dedupe != nil {
+		dedupe.logSummary()
+	}
+	if serviceCodes != nil {
+		slog.Info("dropped invalid service codes", "codes", serviceCodes.invalid)
+	}
+	if npis != nil {
+		npis.logSummary(npiRecordsFiltered)
+	}
+	slog.Info("extracted rows", "records", recordCount, "rows", rowCount, "output", "matches.parquet")
+}
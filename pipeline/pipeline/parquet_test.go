@@ -0,0 +1,30 @@
+package pipeline
+
+import "testing"
+
+func TestParquetRowDedupeFields(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b parquetRow
+	}{
+		{name: "space moved between strings", a: parquetRow{Name: "a b", Description: "c"}, b: parquetRow{Name: "a", Description: "b c"}},
+		{name: "list elements joined", a: parquetRow{ServiceCodes: []string{"11 12"}}, b: parquetRow{ServiceCodes: []string{"11", "12"}}},
+		{name: "element moved between lists", a: parquetRow{ServiceCodes: []string{"11"}}, b: parquetRow{ProviderReferences: []float64{11}}},
+		{name: "references", a: parquetRow{ProviderReferences: []float64{1, 23}}, b: parquetRow{ProviderReferences: []float64{12, 3}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dedupe := &rowDeduper{seen: make(map[uint64]struct{})}
+			if dedupe.duplicate(tt.a.dedupeFields()) {
+				t.Fatal("first row reported as a duplicate")
+			}
+			if dedupe.duplicate(tt.b.dedupeFields()) {
+				t.Error("distinct row reported as a duplicate")
+			}
+			if !dedupe.duplicate(tt.a.dedupeFields()) {
+				t.Error("repeated row not reported as a duplicate")
+			}
+		})
+	}
+}
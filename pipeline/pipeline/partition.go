@@ -0,0 +1,126 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+)
+
+// outputWriter is where workers send encoded match records.
+// *bufio.Writer and *partitionWriter both satisfy it.
+type outputWriter interface {
+	Write(p []byte) (int, error)
+	Flush() error
+}
+
+// partitionWriter routes each encoded record to matches-<billing_code>.jsonl.
+// The matcher's json.Encoder issues exactly one Write per record, so every
+// Write call carries one complete JSON line.
+type partitionWriter struct {
+	prefix  string
+	flag    int // os.O_APPEND or os.O_TRUNC, applied when a partition is opened
+	files   map[string]*os.File
+	writers map[string]*bufio.Writer
+	counts  map[string]int
+}
+
+func newPartitionWriter(prefix string, flag int) *partitionWriter {
+	return &partitionWriter{
+		prefix:  prefix,
+		flag:    flag,
+		files:   make(map[string]*os.File),
+		writers: make(map[string]*bufio.Writer),
+		counts:  make(map[string]int),
+	}
+}
+
+// partitionFileName returns the output file for a billing code, replacing
+// characters that are unsafe in file names. A code that had to be changed
+// gets a hash of the original appended, so that codes such as A/1 and A_1
+// never share a file.
+func (pw *partitionWriter) partitionFileName(code string) string {
+	safe := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, code)
+	if safe == "" {
+		safe = "unknown"
+	}
+	if safe != code {
+		hash := fnv.New32a()
+		hash.Write([]byte(code))
+		safe = fmt.Sprintf("%s-%08x", safe, hash.Sum32())
+	}
+	return fmt.Sprintf("%s-%s.jsonl", pw.prefix, safe)
+}
+
+func (pw *partitionWriter) Write(p []byte) (int, error) {
+	var record struct {
+		BillingCode string `json:"billing_code"`
+	}
+	if err := json.Unmarshal(p, &record); err != nil {
+		return 0, fmt.Errorf("failed to read billing_code for partitioning: %v", err)
+	}
+
+	w, ok := pw.writers[record.BillingCode]
+	if !ok {
+		// Open each partition lazily, on its first record
+		name := pw.partitionFileName(record.BillingCode)
+		f, err := os.OpenFile(name, pw.flag|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open partition file: %v", err)
+		}
+		pw.files[record.BillingCode] = f
+		w = bufio.NewWriterSize(f, 64*1024)
+		pw.writers[record.BillingCode] = w
+	}
+
+	n, err := w.Write(p)
+	if err == nil {
+		pw.counts[record.BillingCode]++
+	}
+	return n, err
+}
+
+// Flush flushes every open partition
+func (pw *partitionWriter) Flush() error {
+	var firstErr error
+	for _, w := range pw.writers {
+		if err := w.Flush(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Close flushes and closes every open partition
+func (pw *partitionWriter) Close() error {
+	firstErr := pw.Flush()
+	for _, f := range pw.files {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// logCounts reports how many records were written to each partition
+func (pw *partitionWriter) logCounts() {
+	codes := make([]string, 0, len(pw.counts))
+	for code := range pw.counts {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		slog.Info("partition summary", "billing_code", code, "records", pw.counts[code], "file", pw.partitionFileName(code))
+	}
+}
@@ -0,0 +1,126 @@
+package pipeline
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// plannedFile is a gzip input discovered by scanGzipDir or listed in a manifest
+type plannedFile struct {
+	Path         string
+	Size         int64
+	ModTime      time.Time
+	ExpectedHash string // SHA-256 supplied by a manifest, if any
+}
+
+// scanGzipDir lists the .gz files in dir, splitting them into files still to
+// process and files isProcessed reports as already done
+func scanGzipDir(dir string, isProcessed func(plannedFile) bool) ([]plannedFile, []plannedFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var pending, skipped []plannedFile
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(strings.ToLower(fileName), ".gz") {
+			continue
+		}
+
+		file := plannedFile{Path: filepath.Join(dir, fileName)}
+		if info, err := entry.Info(); err == nil {
+			file.Size = info.Size()
+			file.ModTime = info.ModTime()
+		}
+
+		if isProcessed(file) {
+			skipped = append(skipped, file)
+		} else {
+			pending = append(pending, file)
+		}
+	}
+
+	return pending, skipped, nil
+}
+
+// fileKey is the name under which a file is recorded in the processed-files and
+// quarantine logs: its cleaned path with forward slashes, or the URL itself.
+// Keys always contain a slash, which tells them apart from the basename-only
+// keys older logs used.
+func fileKey(filePath string) string {
+	if isURL(filePath) {
+		return filePath
+	}
+	key := filepath.ToSlash(filepath.Clean(filePath))
+	if !strings.Contains(key, "/") {
+		key = "./" + key
+	}
+	return key
+}
+
+// legacyKey returns the basename-only key an older log may hold for filePath
+func legacyKey(filePath string) string {
+	return filepath.Base(filePath)
+}
+
+// isLegacyKey reports whether key was written by a log that keyed files by basename
+func isLegacyKey(key string) bool {
+	return !strings.Contains(key, "/")
+}
+
+// countLegacyKeys counts the basename-only entries in a log
+func countLegacyKeys[V any](entries map[string]V) int {
+	count := 0
+	for key := range entries {
+		if isLegacyKey(key) {
+			count++
+		}
+	}
+	return count
+}
+
+// dropLegacyKeys removes basename-only entries once they have had a run to be
+// matched, and re-keyed, by path. It returns how many were removed.
+func dropLegacyKeys[V any](entries map[string]V) int {
+	dropped := 0
+	for key := range entries {
+		if isLegacyKey(key) {
+			delete(entries, key)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// totalSize sums the sizes of the given files
+func totalSize(files []plannedFile) int64 {
+	var total int64
+	for _, file := range files {
+		total += file.Size
+	}
+	return total
+}
+
+// printPlan writes the dry-run listing of files to process and skip
+func printPlan(w io.Writer, pending, skipped, quarantined []plannedFile) {
+	fmt.Fprintf(w, "Dry run - matches.jsonl and %s will not be modified\n", processedFilesLog)
+	fmt.Fprintf(w, "Would process: %d files (%.2f MB)\n", len(pending), float64(totalSize(pending))/(1024*1024))
+	for _, file := range pending {
+		fmt.Fprintf(w, "  + %s (%d bytes)\n", file.Path, file.Size)
+	}
+
+	fmt.Fprintf(w, "Would skip (already processed): %d files (%.2f MB)\n", len(skipped), float64(totalSize(skipped))/(1024*1024))
+	for _, file := range skipped {
+		fmt.Fprintf(w, "  - %s (%d bytes)\n", file.Path, file.Size)
+	}
+
+	fmt.Fprintf(w, "Would skip (quarantined): %d files (%.2f MB)\n", len(quarantined), float64(totalSize(quarantined))/(1024*1024))
+	for _, file := range quarantined {
+		fmt.Fprintf(w, "  ! %s (%d bytes)\n", file.Path, file.Size)
+	}
+}
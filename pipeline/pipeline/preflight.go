@@ -0,0 +1,236 @@
+package pipeline
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// preflightConfig is what -preflight checks: the inputs a run would read and
+// the files and directories it would write
+type preflightConfig struct {
+	gzipDir   string
+	inputGlob string
+	manifest  string
+	output    string // matches.jsonl
+	teeDir    string // -tee-decompressed directory, if any
+	opts      workerOptions
+}
+
+// preflightCheck is one line of the readiness report
+type preflightCheck struct {
+	name   string
+	detail string
+	err    error
+}
+
+// runPreflight checks that a run could start and writes a readiness report to
+// w without processing any data. It reports whether every check passed.
+func runPreflight(w io.Writer, config preflightConfig) bool {
+	var checks []preflightCheck
+
+	inputs, source, err := preflightInputs(config)
+	switch {
+	case err != nil:
+		checks = append(checks, preflightCheck{name: "input files", err: fmt.Errorf("%s: %v", source, err)})
+	case len(inputs) == 0:
+		checks = append(checks, preflightCheck{name: "input files", err: fmt.Errorf("no .gz files in %s", source)})
+	default:
+		checks = append(checks, preflightCheck{name: "input files", detail: fmt.Sprintf("%d files (%.2f MB) in %s", len(inputs), float64(totalSize(inputs))/(1024*1024), source)})
+		checks = append(checks, trialMatch(inputs[0].Path, config.opts))
+	}
+
+	if processed, err := loadProcessedFiles(); err != nil {
+		checks = append(checks, preflightCheck{name: "processed files log", err: err})
+	} else {
+		checks = append(checks, preflightCheck{name: "processed files log", detail: fmt.Sprintf("%s, %d entries", processedFilesLog, len(processed))})
+	}
+	if quarantine, err := loadQuarantine(); err != nil {
+		checks = append(checks, preflightCheck{name: "quarantine log", err: err})
+	} else {
+		checks = append(checks, preflightCheck{name: "quarantine log", detail: fmt.Sprintf("%s, %d entries", quarantineLog, len(quarantine))})
+	}
+
+	checks = append(checks, checkWritable("output directory", "."))
+	checks = append(checks, checkAppendable(config.output))
+	if config.teeDir != "" {
+		checks = append(checks, checkWritable("decompressed output directory", config.teeDir))
+	}
+
+	ready := true
+	fmt.Fprintf(w, "Preflight - no files will be processed\n")
+	for _, check := range checks {
+		if check.err != nil {
+			ready = false
+			fmt.Fprintf(w, "  FAIL %s: %v\n", check.name, check.err)
+		} else {
+			fmt.Fprintf(w, "  ok   %s: %s\n", check.name, check.detail)
+		}
+	}
+	if ready {
+		fmt.Fprintf(w, "Ready\n")
+	} else {
+		fmt.Fprintf(w, "Not ready\n")
+	}
+	return ready
+}
+
+// preflightInputs lists every input of the configured source, whether
+// already processed or not
+func preflightInputs(config preflightConfig) ([]plannedFile, string, error) {
+	everything := func(plannedFile) bool { return false }
+	switch {
+	case config.manifest != "":
+		inputs, _, err := loadManifest(config.manifest, everything)
+		return inputs, config.manifest, err
+	case config.inputGlob != "":
+		inputs, _, err := scanGlob(config.inputGlob, everything)
+		return inputs, config.inputGlob, err
+	default:
+		inputs, _, err := scanGzipDir(config.gzipDir, everything)
+		return inputs, config.gzipDir, err
+	}
+}
+
+// preflightSampleBytes caps the decompressed bytes trialMatch reads
+const preflightSampleBytes = 1 << 20 // 1MB
+
+// trialMatch decompresses the start of filePath and checks that it opens like
+// the matcher's input: a top-level array whose first element is an object, or
+// an object (a stream of them for JSON Lines) with its first key. Only the
+// first tokens are read, never a whole record, since the usual MRF is a single
+// object that holds the entire file; at most preflightSampleBytes are
+// decompressed however large the file is.
+func trialMatch(filePath string, opts workerOptions) preflightCheck {
+	check := preflightCheck{name: "sample input"}
+
+	var file io.ReadCloser
+	var err error
+	if isURL(filePath) {
+		ctx, cancel := context.WithTimeout(context.Background(), opts.fetchTimeout)
+		defer cancel()
+		file, err = openRemote(ctx, filePath, opts.retry)
+	} else {
+		file, err = os.Open(filePath)
+	}
+	if err != nil {
+		check.err = fmt.Errorf("%s: %v", filePath, err)
+		return check
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		check.err = fmt.Errorf("%s: failed to create gzip reader: %v", filePath, err)
+		return check
+	}
+	defer gzipReader.Close()
+
+	// The matcher skips a leading byte order mark the same way
+	sample := &io.LimitedReader{R: gzipReader, N: preflightSampleBytes}
+	input, _ := skipCSVBOM(sample)
+	decoder := json.NewDecoder(input)
+	jsonLines := opts.jsonLines || isJSONLinesFile(filePath)
+
+	first, err := decoder.Token()
+	if err == io.EOF && sample.N > 0 {
+		check.detail = fmt.Sprintf("%s decompressed, but holds no records", filePath)
+		return check
+	}
+	if err != nil {
+		check.err = fmt.Errorf("%s: %v", filePath, sampleError(err, sample))
+		return check
+	}
+	if delim, ok := first.(json.Delim); !ok || delim != '{' && (delim != '[' || jsonLines) {
+		check.err = fmt.Errorf("%s: unexpected JSON structure: starts with %v", filePath, first)
+		return check
+	}
+
+	second, err := decoder.Token()
+	if err != nil {
+		check.err = fmt.Errorf("%s: %v", filePath, sampleError(err, sample))
+		return check
+	}
+	switch second {
+	case json.Delim(']'), json.Delim('}'):
+		check.detail = fmt.Sprintf("%s decompressed, but holds no records", filePath)
+	case json.Delim('{'):
+		check.detail = fmt.Sprintf("%s decompressed; an array of records", filePath)
+	default:
+		if key, ok := second.(string); ok && first == json.Delim('{') {
+			check.detail = fmt.Sprintf("%s decompressed; an object starting with %q", filePath, key)
+		} else if opts.skipBadRecords {
+			check.detail = fmt.Sprintf("%s decompressed; an array whose first record is not an object and will be skipped", filePath)
+		} else {
+			check.err = fmt.Errorf("%s: first record is not an object: %v", filePath, second)
+		}
+	}
+	return check
+}
+
+// sampleError explains an error caused by the sample reaching its size cap
+func sampleError(err error, sample *io.LimitedReader) error {
+	if sample.N == 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+		return fmt.Errorf("no JSON structure in the first %d decompressed bytes", preflightSampleBytes)
+	}
+	return err
+}
+
+// checkWritable creates and removes a file in dir or, if dir does not exist
+// yet, in its closest existing parent, where a run would create it
+func checkWritable(name, dir string) preflightCheck {
+	check := preflightCheck{name: name}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		check.err = err
+		return check
+	}
+
+	existing := abs
+	for {
+		if _, err := os.Stat(existing); err == nil || !os.IsNotExist(err) {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		existing = parent
+	}
+
+	file, err := os.CreateTemp(existing, ".preflight-*")
+	if err != nil {
+		check.err = err
+		return check
+	}
+	file.Close()
+	os.Remove(file.Name())
+
+	if existing == abs {
+		check.detail = abs + " is writable"
+	} else {
+		check.detail = abs + " can be created"
+	}
+	return check
+}
+
+// checkAppendable opens an existing output for appending, as a run would
+func checkAppendable(path string) preflightCheck {
+	check := preflightCheck{name: "matches output"}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if os.IsNotExist(err) {
+		check.detail = path + " will be created"
+		return check
+	}
+	if err != nil {
+		check.err = err
+		return check
+	}
+	file.Close()
+	check.detail = path + " can be appended to"
+	return check
+}
@@ -0,0 +1,48 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTrialMatch(t *testing.T) {
+	// A single MRF object far larger than the sample
+	hugeMRF := `{"reporting_entity_name":"x","in_network":[` + strings.Repeat(`{"billing_code":"1"},`, 200000) + `{"billing_code":"2"}]}`
+	tests := []struct {
+		name    string
+		file    string
+		input   string
+		detail  string
+		wantErr string
+	}{
+		{name: "huge object", file: "in.json.gz", input: hugeMRF, detail: `an object starting with "reporting_entity_name"`},
+		{name: "array", file: "in.json.gz", input: `[{"billing_code":"1"}]`, detail: "an array of records"},
+		{name: "empty array", file: "in.json.gz", input: `[]`, detail: "holds no records"},
+		{name: "empty file", file: "in.json.gz", input: "", detail: "holds no records"},
+		{name: "byte order mark", file: "in.json.gz", input: "\xEF\xBB\xBF{\"a\":1}", detail: `an object starting with "a"`},
+		{name: "json lines", file: "in.jsonl.gz", input: "{\"a\":1}\n{\"a\":2}\n", detail: `an object starting with "a"`},
+		{name: "json lines array", file: "in.jsonl.gz", input: `[{"a":1}]`, wantErr: "unexpected JSON structure"},
+		{name: "scalar", file: "in.json.gz", input: `42`, wantErr: "unexpected JSON structure"},
+		{name: "array of scalars", file: "in.json.gz", input: `[1,2]`, wantErr: "not an object"},
+		{name: "syntax error", file: "in.json.gz", input: `{]`, wantErr: "invalid character"},
+		{name: "whitespace past the sample", file: "in.json.gz", input: strings.Repeat(" ", 2*preflightSampleBytes) + `{}`, wantErr: "no JSON structure"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := trialMatch(writeGzipFile(t, tt.file, tt.input), workerOptions{})
+			if tt.wantErr != "" {
+				if check.err == nil || !strings.Contains(check.err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", check.err, tt.wantErr)
+				}
+				return
+			}
+			if check.err != nil {
+				t.Fatalf("error = %v", check.err)
+			}
+			if !strings.Contains(check.detail, tt.detail) {
+				t.Errorf("detail = %q, want one containing %q", check.detail, tt.detail)
+			}
+		})
+	}
+}
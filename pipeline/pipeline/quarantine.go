@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// quarantineLog is the file that tracks files that failed processing
+const quarantineLog = "quarantine.json"
+
+// quarantineEntry records why a file was quarantined
+type quarantineEntry struct {
+	File          string    `json:"file"`
+	Reason        string    `json:"reason"`
+	QuarantinedAt time.Time `json:"quarantined_at"`
+}
+
+// loadQuarantine loads the quarantined files from the log, keyed by file name
+func loadQuarantine() (map[string]quarantineEntry, error) {
+	entries := make(map[string]quarantineEntry)
+	file, err := os.Open(quarantineLog)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return entries, nil // No log yet
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	// Check if file is empty
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fileInfo.Size() == 0 {
+		return entries, nil // Empty log, treat as nothing quarantined
+	}
+
+	var entryList []quarantineEntry
+	if err := json.NewDecoder(file).Decode(&entryList); err != nil {
+		if err == io.EOF {
+			return entries, nil
+		}
+		return nil, err
+	}
+	for _, entry := range entryList {
+		entries[entry.File] = entry
+	}
+	return entries, nil
+}
+
+// saveQuarantine saves the quarantined files to the log
+func saveQuarantine(entries map[string]quarantineEntry) error {
+	entryList := make([]quarantineEntry, 0, len(entries))
+	for _, entry := range entries {
+		entryList = append(entryList, entry)
+	}
+	sort.Slice(entryList, func(i, j int) bool { return entryList[i].File < entryList[j].File })
+
+	return writeFileAtomic(quarantineLog, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entryList)
+	})
+}
+
+// filterQuarantined splits files into those to process and those excluded by the quarantine
+func filterQuarantined(files []plannedFile, quarantine map[string]quarantineEntry) ([]plannedFile, []plannedFile) {
+	var keep, excluded []plannedFile
+	for _, file := range files {
+		key := fileKey(file.Path)
+		_, ok := quarantine[key]
+		if legacy, found := quarantine[legacyKey(file.Path)]; !ok && found {
+			// Re-key an entry from a log that keyed files by basename
+			legacy.File = key
+			quarantine[key] = legacy
+			ok = true
+		}
+		if ok {
+			excluded = append(excluded, file)
+		} else {
+			keep = append(keep, file)
+		}
+	}
+	return keep, excluded
+}
@@ -0,0 +1,67 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"scraper/downloader"
+)
+
+// isURL reports whether a job names a remote file rather than a local path
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// remoteClient has no overall timeout: fetches are bounded by their context so
+// long bodies can be streamed
+var remoteClient = &http.Client{}
+
+// openRemote requests url and returns the response body for streaming. The
+// request is retried with the scraper's backoff rules until the body starts;
+// once streaming, errors are returned as-is.
+func openRemote(ctx context.Context, url string, config downloader.RetryConfig) (io.ReadCloser, error) {
+	var lastErr error
+	for attempt := 0; attempt <= config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			delay := downloader.CalculateBackoffDelay(attempt-1, config)
+			slog.Info("retrying remote input", "url", url, "attempt", attempt+1, "delay", delay.Round(time.Millisecond), "error", lastErr)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %v", err)
+		}
+
+		resp, err := remoteClient.Do(req)
+		if err != nil {
+			lastErr = err
+			if config.IsRetryableError(err) && ctx.Err() == nil {
+				continue
+			}
+			return nil, fmt.Errorf("failed to fetch %s: %w", url, err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("HTTP status %d", resp.StatusCode)
+			if config.IsRetryableHTTPStatus(resp.StatusCode) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to fetch %s: %v", url, lastErr)
+		}
+
+		return resp.Body, nil
+	}
+
+	return nil, fmt.Errorf("failed to fetch %s after %d attempts: %w", url, config.MaxRetries+1, lastErr)
+}
@@ -0,0 +1,103 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+)
+
+// extractCheckpointFile records how far ExtractToCSV got, for -resume
+const extractCheckpointFile = "extract-checkpoint.json"
+
+// extractCheckpointInterval is how often ExtractToCSV saves its checkpoint
+const extractCheckpointInterval = 30 * time.Second
+
+// extractCheckpoint is the extract-checkpoint.json document. The first Records
+// records, Rows rows, have been written to matches.csv, which then ended at
+// Offset. The other fields identify the extraction it belongs to.
+type extractCheckpoint struct {
+	InputSize    int64     `json:"input_size"`
+	InputModTime time.Time `json:"input_mod_time"`
+	OptionsHash  string    `json:"options_hash"`
+	Columns      []string  `json:"columns"`
+	Records      int       `json:"records"`
+	Rows         int       `json:"rows"`
+	Offset       int64     `json:"offset"`
+}
+
+// newExtractCheckpoint returns an empty checkpoint for extracting input, as
+// described by info, with opts into columns
+func newExtractCheckpoint(info os.FileInfo, opts ExtractOptions, columns []string) *extractCheckpoint {
+	// Filters change which rows are written, so they must match to resume.
+	// fmt prints maps sorted by key, so the hash is stable.
+	opts.Resume = false
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%+v", opts)))
+	return &extractCheckpoint{
+		InputSize:    info.Size(),
+		InputModTime: info.ModTime(),
+		OptionsHash:  hex.EncodeToString(sum[:]),
+		Columns:      columns,
+	}
+}
+
+// sameExtraction reports whether c was saved by an extraction of the same
+// input with the same options and columns as other
+func (c *extractCheckpoint) sameExtraction(other *extractCheckpoint) bool {
+	return c.InputSize == other.InputSize &&
+		c.InputModTime.Equal(other.InputModTime) &&
+		c.OptionsHash == other.OptionsHash &&
+		slices.Equal(c.Columns, other.Columns)
+}
+
+func (c *extractCheckpoint) save() error {
+	return writeFileAtomic(extractCheckpointFile, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(c)
+	})
+}
+
+// resumePoint loads the checkpoint of an interrupted extraction matching
+// current, along with matches.csv. It returns nil, after logging why, when
+// the extraction has to start over.
+func resumePoint(current *extractCheckpoint, csvPath string) *extractCheckpoint {
+	data, err := os.ReadFile(extractCheckpointFile)
+	if os.IsNotExist(err) {
+		slog.Info("no extraction checkpoint, starting from the beginning", "file", extractCheckpointFile)
+		return nil
+	}
+	if err != nil {
+		slog.Warn("could not read extraction checkpoint, starting from the beginning", "file", extractCheckpointFile, "error", err)
+		return nil
+	}
+
+	var saved extractCheckpoint
+	if err := json.Unmarshal(data, &saved); err != nil {
+		slog.Warn("could not parse extraction checkpoint, starting from the beginning", "file", extractCheckpointFile, "error", err)
+		return nil
+	}
+	if !saved.sameExtraction(current) {
+		slog.Warn("extraction checkpoint is for a different input, options or columns, starting from the beginning", "file", extractCheckpointFile)
+		return nil
+	}
+
+	info, err := os.Stat(csvPath)
+	if err != nil || info.Size() < saved.Offset {
+		slog.Warn("output is missing or shorter than the checkpoint, starting from the beginning", "file", csvPath, "offset", saved.Offset)
+		return nil
+	}
+	return &saved
+}
+
+// clearExtractCheckpoint removes the checkpoint once an extraction completes
+func clearExtractCheckpoint() {
+	if err := os.Remove(extractCheckpointFile); err != nil && !os.IsNotExist(err) {
+		slog.Warn("could not remove extraction checkpoint", "file", extractCheckpointFile, "error", err)
+	}
+}
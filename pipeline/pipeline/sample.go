@@ -0,0 +1,38 @@
+package pipeline
+
+import (
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+)
+
+// recordSampler keeps each matched record with a fixed probability for
+// -sample-rate. It is the matcher's Keep hook, so it flips one coin per match
+// in output order. Workers share one generator, so a seed reproduces the same
+// sample only when files are matched in the same order, e.g. with -workers 1.
+type recordSampler struct {
+	rate float64
+
+	mu  sync.Mutex
+	rng *rand.Rand
+
+	matched atomic.Int64
+	sampled atomic.Int64
+}
+
+func newRecordSampler(rate float64, seed uint64) *recordSampler {
+	return &recordSampler{rate: rate, rng: rand.New(rand.NewPCG(seed, seed))}
+}
+
+// keep reports whether a match is in the sample
+func (s *recordSampler) keep(match map[string]interface{}) bool {
+	s.matched.Add(1)
+
+	s.mu.Lock()
+	keep := s.rng.Float64() < s.rate
+	s.mu.Unlock()
+	if keep {
+		s.sampled.Add(1)
+	}
+	return keep
+}
@@ -0,0 +1,90 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"search/matcher"
+)
+
+// billingCodeRecords renders n records, each with billing code 99283 and its index
+func billingCodeRecords(n int) []string {
+	records := make([]string, n)
+	for i := range records {
+		records[i] = fmt.Sprintf(`{"billing_code":"99283","i":%d}`, i)
+	}
+	return records
+}
+
+// sampleFile runs processFile over path with a sampler, returning the output
+func sampleFile(t *testing.T, path string, sampler *recordSampler, intraFileWorkers int) (matcher.Stats, string) {
+	t.Helper()
+	opts := workerOptions{
+		match:            matcher.BillingCodePredicate(map[string]bool{"99283": true}),
+		keep:             sampler.keep,
+		bufferSize:       matcher.DefaultBufferSize,
+		intraFileWorkers: intraFileWorkers,
+	}
+	var out bytes.Buffer
+	var bytesRead int64
+	stats, _, err := processFile(context.Background(), path, &out, opts, &bytesRead)
+	if err != nil {
+		t.Fatalf("processFile: %v", err)
+	}
+	return stats, out.String()
+}
+
+func TestRecordSamplerRate(t *testing.T) {
+	const n, rate = 10000, 0.2
+	records := billingCodeRecords(n)
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "object stream", input: strings.Join(records, "\n")},
+		{name: "array", input: "[" + strings.Join(records, ",") + "]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sampler := newRecordSampler(rate, 1)
+			stats, out := sampleFile(t, writeGzipFile(t, "in.json.gz", tt.input), sampler, 0)
+
+			if got := sampler.matched.Load(); got != n {
+				t.Errorf("matched = %d, want %d", got, n)
+			}
+			sampled := int(sampler.sampled.Load())
+			if stats.Matches != sampled || strings.Count(out, "\n") != sampled {
+				t.Errorf("Matches = %d, lines = %d, want the %d sampled", stats.Matches, strings.Count(out, "\n"), sampled)
+			}
+			if stats.NestedMatches != 0 {
+				t.Errorf("NestedMatches = %d, want 0", stats.NestedMatches)
+			}
+			// Within five standard deviations of the expected sample
+			if spread := 5 * math.Sqrt(n*rate*(1-rate)); math.Abs(float64(sampled)-n*rate) > spread {
+				t.Errorf("sampled %d of %d, want about %v", sampled, n, n*rate)
+			}
+		})
+	}
+}
+
+func TestRecordSamplerSeedReproduces(t *testing.T) {
+	path := writeGzipFile(t, "in.json.gz", "["+strings.Join(billingCodeRecords(2000), ",")+"]")
+	for _, intraFileWorkers := range []int{0, 4} {
+		t.Run(fmt.Sprintf("intra-file-workers=%d", intraFileWorkers), func(t *testing.T) {
+			_, first := sampleFile(t, path, newRecordSampler(0.5, 42), intraFileWorkers)
+			for run := 0; run < 5; run++ {
+				if _, out := sampleFile(t, path, newRecordSampler(0.5, 42), intraFileWorkers); out != first {
+					t.Fatalf("run %d sampled differently with the same seed", run+2)
+				}
+			}
+			if _, out := sampleFile(t, path, newRecordSampler(0.5, 43), intraFileWorkers); out == first {
+				t.Error("another seed sampled the same records")
+			}
+		})
+	}
+}
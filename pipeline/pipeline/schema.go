@@ -0,0 +1,103 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// schemaFailuresFile receives the matched records that fail -schema validation
+const schemaFailuresFile = "schema-failures.jsonl"
+
+// schemaFailure is one line of schema-failures.jsonl
+type schemaFailure struct {
+	Error  string          `json:"error"`
+	Record json.RawMessage `json:"record"`
+}
+
+// schemaWriter validates each encoded match record against a JSON Schema,
+// passing valid records on to w and writing the rest, with the validation
+// error, to schema-failures.jsonl. Like limitWriter it relies on the worker's
+// writer mutex and on the matcher writing one record per Write.
+type schemaWriter struct {
+	w        outputWriter
+	schema   *jsonschema.Schema
+	file     *os.File
+	failures *bufio.Writer
+	valid    int
+	invalid  int
+}
+
+// newSchemaWriter compiles the schema at schemaPath and opens the failures
+// file with flag (os.O_APPEND or os.O_TRUNC, like the matches output)
+func newSchemaWriter(w outputWriter, schemaPath string, flag int) (*schemaWriter, error) {
+	schema, err := jsonschema.Compile(schemaPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile schema %s: %v", schemaPath, err)
+	}
+	file, err := os.OpenFile(schemaFailuresFile, flag|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &schemaWriter{
+		w:        w,
+		schema:   schema,
+		file:     file,
+		failures: bufio.NewWriterSize(file, 64*1024),
+	}, nil
+}
+
+// validate checks one encoded record against the schema
+func (sw *schemaWriter) validate(p []byte) error {
+	// Numbers are kept as json.Number so integer checks see the exact value
+	var record interface{}
+	decoder := json.NewDecoder(bytes.NewReader(p))
+	decoder.UseNumber()
+	if err := decoder.Decode(&record); err != nil {
+		return err
+	}
+	return sw.schema.Validate(record)
+}
+
+// accepts reports whether a record is valid, and so would be passed on to w
+func (sw *schemaWriter) accepts(p []byte) bool {
+	return sw.validate(p) == nil
+}
+
+func (sw *schemaWriter) Write(p []byte) (int, error) {
+	err := sw.validate(p)
+	if err == nil {
+		sw.valid++
+		return sw.w.Write(p)
+	}
+
+	sw.invalid++
+	line, marshalErr := json.Marshal(schemaFailure{Error: err.Error(), Record: bytes.TrimSpace(p)})
+	if marshalErr != nil {
+		return 0, fmt.Errorf("failed to record schema failure: %v", marshalErr)
+	}
+	if _, err := sw.failures.Write(append(line, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (sw *schemaWriter) Flush() error {
+	if err := sw.failures.Flush(); err != nil {
+		return err
+	}
+	return sw.w.Flush()
+}
+
+// Close flushes and closes the failures file
+func (sw *schemaWriter) Close() error {
+	if err := sw.failures.Flush(); err != nil {
+		sw.file.Close()
+		return err
+	}
+	return sw.file.Close()
+}
@@ -0,0 +1,220 @@
+package pipeline
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"jsonformatter"
+	"search/matcher"
+)
+
+// defaultMaxRequestBodySize is the default -serve-max-body: the cap on the
+// bytes read from a request body, before any Content-Encoding is removed, and
+// on a /format document once decompressed
+const defaultMaxRequestBodySize = 1 << 30 // 1 GiB
+
+// errDecompressedTooLarge is returned for reads past the decompressed size cap
+var errDecompressedTooLarge = errors.New("decompressed request body too large")
+
+// matchServer serves the matcher and formatter over HTTP for -serve
+type matchServer struct {
+	match          matcher.MatchPredicate
+	skipBadRecords bool
+	maxRecordBytes int64
+	maxBodySize    int64
+}
+
+// handler routes POST /match and POST /format
+func (s *matchServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /match", s.handleMatch)
+	mux.HandleFunc("POST /format", s.handleFormat)
+	return mux
+}
+
+// limitedBody is a request body capped at maxBodySize. The processors wrap
+// read errors as text, so it remembers whether a cap was hit.
+type limitedBody struct {
+	r        io.Reader
+	tooLarge bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		b.tooLarge = true
+	}
+	return n, err
+}
+
+// decompressedLimit fails reads once more than n decompressed bytes have been
+// read, marking body too large, so a small gzip bomb cannot fill memory
+type decompressedLimit struct {
+	r    io.Reader
+	n    int64 // bytes left before the cap
+	body *limitedBody
+}
+
+func (d *decompressedLimit) Read(p []byte) (int, error) {
+	if d.n < 0 {
+		return 0, errDecompressedTooLarge
+	}
+	// One byte past the cap tells a body of exactly n bytes from a longer one
+	if int64(len(p)) > d.n+1 {
+		p = p[:d.n+1]
+	}
+	n, err := d.r.Read(p)
+	if int64(n) <= d.n {
+		d.n -= int64(n)
+		return n, err
+	}
+	n = int(d.n)
+	d.n = -1
+	d.body.tooLarge = true
+	return n, errDecompressedTooLarge
+}
+
+// errorStatus is the response status for a request that failed to process
+func (b *limitedBody) errorStatus() int {
+	if b.tooLarge {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// requestBody returns the request body limited to maxBodySize, with a gzip
+// Content-Encoding reported so the caller can pick the right reader
+func (s *matchServer) requestBody(w http.ResponseWriter, r *http.Request) (body *limitedBody, gzipped bool, err error) {
+	body = &limitedBody{r: http.MaxBytesReader(w, r.Body, s.maxBodySize)}
+	switch r.Header.Get("Content-Encoding") {
+	case "", "identity":
+		return body, false, nil
+	case "gzip":
+		return body, true, nil
+	default:
+		return nil, false, fmt.Errorf("unsupported Content-Encoding %q", r.Header.Get("Content-Encoding"))
+	}
+}
+
+// handleMatch streams the body through the matcher and writes the matching
+// records to the response as JSON Lines. ?jsonl=true treats the body as JSON
+// Lines. Counts are sent as trailers, since they are only known at the end.
+func (s *matchServer) handleMatch(w http.ResponseWriter, r *http.Request) {
+	body, gzipped, err := s.requestBody(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var processor *matcher.StreamingGzipProcessor
+	if gzipped {
+		processor, err = matcher.NewStreamingGzipProcessor(body, s.match)
+		if err != nil {
+			http.Error(w, err.Error(), body.errorStatus())
+			return
+		}
+	} else {
+		processor = matcher.NewStreamingProcessor(body, s.match)
+	}
+	processor.SkipBadRecords = s.skipBadRecords
+	processor.MaxRecordBytes = s.maxRecordBytes
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Trailer", "X-Records-Scanned, X-Matches, X-Error")
+
+	out := &responseCounter{w: w}
+	var stats matcher.Stats
+	if r.URL.Query().Get("jsonl") == "true" {
+		stats, err = processor.ProcessJSONLines(out)
+	} else {
+		stats, err = processor.ProcessMatches(out)
+	}
+
+	if err != nil {
+		if out.n == 0 {
+			w.Header().Del("Trailer")
+			http.Error(w, err.Error(), body.errorStatus())
+			return
+		}
+		// Matches were already sent, so the error can only go in a trailer
+		w.Header().Set("X-Error", err.Error())
+		slog.Warn("match request failed after streaming results", "remote", r.RemoteAddr, "error", err)
+	}
+	w.Header().Set("X-Records-Scanned", strconv.Itoa(stats.RecordsScanned))
+	w.Header().Set("X-Matches", strconv.Itoa(stats.Matches))
+	slog.Info("served match request", "remote", r.RemoteAddr, "records", stats.RecordsScanned, "matches", stats.Matches)
+}
+
+// handleFormat returns the body's JSON document indented. Unlike /match the
+// document is held in memory, so a gzipped one may decompress to no more than
+// maxBodySize bytes either.
+func (s *matchServer) handleFormat(w http.ResponseWriter, r *http.Request) {
+	body, gzipped, err := s.requestBody(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	var input io.Reader = body
+	if gzipped {
+		gzipReader, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, err.Error(), body.errorStatus())
+			return
+		}
+		defer gzipReader.Close()
+		// The document is held whole, so its decompressed size is capped too
+		input = &decompressedLimit{r: gzipReader, n: s.maxBodySize, body: body}
+	}
+
+	var formatted bytes.Buffer
+	if err := jsonformatter.FormatJSON(input, &formatted); err != nil {
+		http.Error(w, err.Error(), body.errorStatus())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(formatted.Bytes())
+}
+
+// responseCounter counts the bytes written to a response
+type responseCounter struct {
+	w io.Writer
+	n int64
+}
+
+func (rc *responseCounter) Write(p []byte) (int, error) {
+	n, err := rc.w.Write(p)
+	rc.n += int64(n)
+	return n, err
+}
+
+// serve runs the HTTP server on addr until ctx is cancelled
+func serve(ctx context.Context, addr string, s *matchServer) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           s.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("serving matcher", "addr", addr, "endpoints", "POST /match, POST /format", "max_body_bytes", s.maxBodySize)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package pipeline
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleFormatDecompressedLimit(t *testing.T) {
+	const maxBody = 64 * 1024
+	document := `{"billing_code":"99283"}`
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "small document", body: document, status: http.StatusOK},
+		{name: "exactly the cap", body: document + strings.Repeat(" ", maxBody-len(document)), status: http.StatusOK},
+		{name: "one byte over", body: document + strings.Repeat(" ", maxBody-len(document)+1), status: http.StatusRequestEntityTooLarge},
+		// Compresses to a few KB, well under the cap on the request body
+		{name: "gzip bomb", body: "[" + strings.Repeat(" ", 16*maxBody) + "]", status: http.StatusRequestEntityTooLarge},
+	}
+
+	server := &matchServer{maxBodySize: maxBody}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var compressed bytes.Buffer
+			zw := gzip.NewWriter(&compressed)
+			zw.Write([]byte(tt.body))
+			zw.Close()
+			if compressed.Len() > maxBody {
+				t.Fatalf("compressed body is %d bytes, over the cap", compressed.Len())
+			}
+
+			req := httptest.NewRequest("POST", "/format", &compressed)
+			req.Header.Set("Content-Encoding", "gzip")
+			rec := httptest.NewRecorder()
+			server.handler().ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package pipeline
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadServiceCodes reads the valid service codes, one per line, from path.
+// Blank lines and lines starting with # are ignored.
+func loadServiceCodes(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	codes := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		code := strings.TrimSpace(scanner.Text())
+		if code == "" || strings.HasPrefix(code, "#") {
+			continue
+		}
+		codes[code] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(codes) == 0 {
+		return nil, fmt.Errorf("no service codes found in %s", path)
+	}
+	return codes, nil
+}
+
+// serviceCodeFilter blanks service codes that are not in the valid set
+type serviceCodeFilter struct {
+	valid   map[string]bool
+	invalid int
+}
+
+// clean returns code if it is valid, or "" after counting it as invalid
+func (f *serviceCodeFilter) clean(code string) string {
+	if f.valid[code] {
+		return code
+	}
+	f.invalid++
+	return ""
+}
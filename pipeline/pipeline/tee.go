@@ -0,0 +1,151 @@
+package pipeline
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// decompressedTee saves the decompressed bytes of one input to a directory
+// for -tee-decompressed, as they are matched. They are written to a .tmp file
+// that is renamed into place only once the whole input has been read, so a
+// failed file leaves no partial output.
+type decompressedTee struct {
+	path string
+	file *os.File
+	buf  *bufio.Writer
+	done bool
+}
+
+// teeName is the decompressed file name of one input, or why it has none
+type teeName struct {
+	name string
+	err  error
+}
+
+// resolveTeeNames gives every input its decompressed file name. Inputs that
+// share a base name, as -input-glob and -manifest can list from different
+// directories, each get a hash of their path appended, e.g.
+// in-network-1a2b3c4d.json, so none overwrites another's output. An input
+// that still has no name of its own gets an error and fails when processed.
+func resolveTeeNames(files []string) map[string]teeName {
+	names := make(map[string]teeName, len(files))
+	claims := make(map[string][]string) // name -> inputs
+	for _, file := range files {
+		name, err := teeOutputName(file)
+		names[file] = teeName{name: name, err: err}
+		if err == nil {
+			claims[name] = append(claims[name], file)
+		}
+	}
+
+	taken := make(map[string]int) // final name -> inputs given it
+	for name, inputs := range claims {
+		if len(inputs) == 1 {
+			taken[name]++
+			continue
+		}
+		slog.Warn("inputs share a decompressed file name; each gets a hash of its path added", "name", name, "inputs", len(inputs))
+		ext := filepath.Ext(name)
+		stem := strings.TrimSuffix(name, ext)
+		for _, file := range inputs {
+			hash := fnv.New32a()
+			hash.Write([]byte(file))
+			unique := fmt.Sprintf("%s-%08x%s", stem, hash.Sum32(), ext)
+			names[file] = teeName{name: unique}
+			taken[unique]++
+		}
+	}
+	for file, tee := range names {
+		if tee.err == nil && taken[tee.name] > 1 {
+			names[file] = teeName{err: fmt.Errorf("no file name of its own for decompressed output of %s: %s is shared", file, tee.name)}
+		}
+	}
+	return names
+}
+
+// createDecompressedTee starts the output in dir for the input filePath,
+// under its name from names
+func createDecompressedTee(dir, filePath string, names map[string]teeName) (*decompressedTee, error) {
+	tee, ok := names[filePath]
+	if !ok {
+		tee.name, tee.err = teeOutputName(filePath)
+	}
+	if tee.err != nil {
+		return nil, tee.err
+	}
+	name := tee.name
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create decompressed output directory: %v", err)
+	}
+
+	outputPath := filepath.Join(dir, name)
+	file, err := os.Create(outputPath + ".tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create decompressed output: %v", err)
+	}
+	return &decompressedTee{
+		path: outputPath,
+		file: file,
+		buf:  bufio.NewWriterSize(file, 64*1024),
+	}, nil
+}
+
+// teeOutputName is the decompressed file name for an input: its base name,
+// from the URL path for remote inputs, without the .gz extension
+func teeOutputName(filePath string) (string, error) {
+	name := filepath.Base(filePath)
+	if isURL(filePath) {
+		parsed, err := url.Parse(filePath)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse input URL: %v", err)
+		}
+		name = path.Base(parsed.Path)
+	}
+	name = strings.TrimSuffix(name, ".gz")
+	if name == "" || name == "." || name == ".." || name == "/" {
+		return "", fmt.Errorf("no file name for decompressed output of %s", filePath)
+	}
+	return name, nil
+}
+
+func (t *decompressedTee) Write(p []byte) (int, error) {
+	n, err := t.buf.Write(p)
+	if err != nil {
+		return n, fmt.Errorf("failed to write decompressed output: %v", err)
+	}
+	return n, nil
+}
+
+// commit moves the finished output into place
+func (t *decompressedTee) commit() error {
+	t.done = true
+	err := t.buf.Flush()
+	if closeErr := t.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(t.file.Name(), t.path)
+	}
+	if err != nil {
+		os.Remove(t.file.Name())
+		return fmt.Errorf("failed to write decompressed output: %v", err)
+	}
+	return nil
+}
+
+// abort discards the output unless it was committed
+func (t *decompressedTee) abort() {
+	if t.done {
+		return
+	}
+	t.done = true
+	t.file.Close()
+	os.Remove(t.file.Name())
+}
@@ -0,0 +1,39 @@
+package pipeline
+
+import (
+	"fmt"
+	"hash/fnv"
+	"testing"
+)
+
+func TestResolveTeeNames(t *testing.T) {
+	pathHash := func(file string) string {
+		hash := fnv.New32a()
+		hash.Write([]byte(file))
+		return fmt.Sprintf("%08x", hash.Sum32())
+	}
+
+	names := resolveTeeNames([]string{"a/x.json.gz", "b/x.json.gz", "c/y.json.gz"})
+	want := map[string]string{
+		"a/x.json.gz": "x-" + pathHash("a/x.json.gz") + ".json",
+		"b/x.json.gz": "x-" + pathHash("b/x.json.gz") + ".json",
+		"c/y.json.gz": "y.json",
+	}
+	for file, name := range want {
+		if tee := names[file]; tee.err != nil || tee.name != name {
+			t.Errorf("%s: name %q, error %v, want %q", file, tee.name, tee.err, name)
+		}
+	}
+
+	// An input already named like another's disambiguated output
+	clash := "c/x-" + pathHash("a/x.json.gz") + ".json.gz"
+	names = resolveTeeNames([]string{"a/x.json.gz", "b/x.json.gz", clash})
+	for _, file := range []string{"a/x.json.gz", clash} {
+		if names[file].err == nil {
+			t.Errorf("%s: name %q, want an error", file, names[file].name)
+		}
+	}
+	if tee := names["b/x.json.gz"]; tee.err != nil {
+		t.Errorf("b/x.json.gz: %v", tee.err)
+	}
+}
@@ -0,0 +1,60 @@
+package pipeline
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// parseListFlag parses a -tin-allow, -tin-deny or -exclude-codes value: either
+// comma-separated entries or @path naming a file with one entry per line.
+// Empty means no list.
+func parseListFlag(value string) (map[string]bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	var entries []string
+	if path, ok := strings.CutPrefix(value, "@"); ok {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			entries = append(entries, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	} else {
+		entries = strings.Split(value, ",")
+	}
+
+	list := make(map[string]bool)
+	for _, entry := range entries {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list[entry] = true
+		}
+	}
+	return list, nil
+}
+
+// tinFilter keeps or drops rows by the TIN of their provider group
+type tinFilter struct {
+	allow    map[string]bool
+	deny     map[string]bool
+	filtered int
+}
+
+// keep reports whether a row for a group with this TIN should be written.
+// With an allow list, rows without a TIN are dropped.
+func (f *tinFilter) keep(tin string) bool {
+	if (f.allow != nil && !f.allow[tin]) || f.deny[tin] {
+		f.filtered++
+		return false
+	}
+	return true
+}
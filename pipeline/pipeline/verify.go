@@ -0,0 +1,64 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"search/matcher"
+)
+
+// maxVerifyLineSize bounds a single record in matches.jsonl
+const maxVerifyLineSize = 256 * 1024 * 1024
+
+// verifyReport summarises a verification pass over a matches file
+type verifyReport struct {
+	Records     int
+	Mismatches  int // records the predicate rejects
+	ParseErrors int // lines that are not valid JSON objects
+}
+
+// verifyMatches streams a JSON Lines matches file and re-checks every record
+// against match, logging each problem with its line number
+func verifyMatches(path string, match matcher.MatchPredicate) (verifyReport, error) {
+	var report verifyReport
+
+	file, err := openMatches(path)
+	if err != nil {
+		return report, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxVerifyLineSize)
+
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var record map[string]interface{}
+		if err := json.Unmarshal(line, &record); err != nil {
+			report.ParseErrors++
+			slog.Warn("invalid JSON in matches file", "file", path, "line", lineNum, "error", err)
+			continue
+		}
+		report.Records++
+
+		if !match(record) {
+			report.Mismatches++
+			slog.Warn("record does not satisfy the match predicate", "file", path, "line", lineNum, "billing_code", record["billing_code"])
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return report, fmt.Errorf("failed to read line %d: %v", lineNum+1, err)
+	}
+
+	return report, nil
+}
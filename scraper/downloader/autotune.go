@@ -0,0 +1,169 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AutoTuneConfig holds the settings of Downloader.AutoTune
+type AutoTuneConfig struct {
+	Start     int           // concurrency the tuner starts from
+	Floor     int           // lowest concurrency backing off can reach
+	Interval  time.Duration // how often the limit is recomputed
+	MinSample int           // responses needed before adjusting
+	Threshold float64       // throttled share of responses that halves the limit
+}
+
+// DefaultAutoTuneConfig is the auto-tuning configuration used by New
+var DefaultAutoTuneConfig = AutoTuneConfig{
+	Start:     2,
+	Floor:     1,
+	Interval:  5 * time.Second,
+	MinSample: 5,
+	Threshold: 0.05,
+}
+
+// concurrencyTuner is a semaphore whose size is adjusted from the share of
+// responses the server answers with 403 or 429
+type concurrencyTuner struct {
+	mu        sync.Mutex
+	limit     int
+	max       int
+	config    AutoTuneConfig
+	active    int
+	changed   chan struct{} // closed and replaced whenever a slot may have freed up
+	responses int
+	throttled int
+	onChange  func(int)
+}
+
+// newConcurrencyTuner starts at config.Start, kept between config.Floor and
+// max. Zero config fields take their DefaultAutoTuneConfig value.
+func newConcurrencyTuner(max int, config AutoTuneConfig, onChange func(int)) *concurrencyTuner {
+	if config.Start <= 0 {
+		config.Start = DefaultAutoTuneConfig.Start
+	}
+	if config.Floor <= 0 {
+		config.Floor = DefaultAutoTuneConfig.Floor
+	}
+	if config.Interval <= 0 {
+		config.Interval = DefaultAutoTuneConfig.Interval
+	}
+	if config.MinSample <= 0 {
+		config.MinSample = DefaultAutoTuneConfig.MinSample
+	}
+	if config.Threshold <= 0 {
+		config.Threshold = DefaultAutoTuneConfig.Threshold
+	}
+	if config.Floor > max {
+		config.Floor = max
+	}
+
+	start := config.Start
+	if start < config.Floor {
+		start = config.Floor
+	}
+	if start > max {
+		start = max
+	}
+	return &concurrencyTuner{
+		limit:    start,
+		max:      max,
+		config:   config,
+		changed:  make(chan struct{}),
+		onChange: onChange,
+	}
+}
+
+// acquire blocks until a slot is free under the current limit
+func (t *concurrencyTuner) acquire(ctx context.Context) error {
+	for {
+		t.mu.Lock()
+		if t.active < t.limit {
+			t.active++
+			t.mu.Unlock()
+			return nil
+		}
+		changed := t.changed
+		t.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (t *concurrencyTuner) release() {
+	t.mu.Lock()
+	t.active--
+	t.signal()
+	t.mu.Unlock()
+}
+
+// signal wakes every waiter; t.mu must be held
+func (t *concurrencyTuner) signal() {
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// observe records the status of one HTTP response
+func (t *concurrencyTuner) observe(statusCode int) {
+	t.mu.Lock()
+	t.responses++
+	if statusCode == http.StatusForbidden || statusCode == http.StatusTooManyRequests {
+		t.throttled++
+	}
+	t.mu.Unlock()
+}
+
+// adjust halves the limit, down to the floor, when too many responses were
+// throttled and otherwise raises it by one, then starts a new sample
+func (t *concurrencyTuner) adjust() {
+	t.mu.Lock()
+	if t.responses < t.config.MinSample {
+		t.mu.Unlock()
+		return
+	}
+
+	limit := t.limit
+	if float64(t.throttled)/float64(t.responses) > t.config.Threshold {
+		limit = limit / 2
+		if limit < t.config.Floor {
+			limit = t.config.Floor
+		}
+	} else if t.throttled == 0 && limit < t.max {
+		limit++
+	}
+	t.responses = 0
+	t.throttled = 0
+
+	changed := limit != t.limit
+	t.limit = limit
+	if changed {
+		t.signal()
+	}
+	t.mu.Unlock()
+
+	if changed && t.onChange != nil {
+		t.onChange(limit)
+	}
+}
+
+// run recomputes the limit every config.Interval until stop is closed
+func (t *concurrencyTuner) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(t.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.adjust()
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,645 @@
+package downloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DownloadResult represents the result of a download
+type DownloadResult struct {
+	URL      string
+	Success  bool
+	Error    error
+	FilePath string
+	Retries  int
+
+	Duration   time.Duration // time spent in downloadFile, including retries and backoff
+	Bytes      int64         // bytes written by the final attempt
+	StatusCode int           // HTTP status of the last response, 0 if none was received
+	FinalURL   string        // URL of the last response, after any redirects
+	SHA256     string        // hex SHA-256 of the downloaded file; empty if it already existed or HashFiles is off
+}
+
+// ErrExceedsMaxSize is returned for downloads larger than Downloader.MaxFileSize
+var ErrExceedsMaxSize = errors.New("exceeds max size")
+
+// Observer receives lifecycle events for each download, e.g. to export metrics
+type Observer interface {
+	DownloadStarted(url string)
+	DownloadFinished(result DownloadResult, elapsed time.Duration)
+}
+
+// Downloader downloads batches of URLs concurrently with retry logic
+type Downloader struct {
+	RetryConfig RetryConfig
+	Concurrency int
+	Client      *http.Client
+
+	// Progress, when set, receives periodic updates while Download runs
+	Progress ProgressCallback
+
+	// Limiter, when set, caps the aggregate throughput of all downloads
+	Limiter *BandwidthLimiter
+
+	// MaxFileSize, when positive, rejects files larger than this many bytes
+	MaxFileSize int64
+
+	// Observer, when set, is notified as each download starts and finishes
+	Observer Observer
+
+	// RequestDelay is slept by each download after it takes a concurrency slot
+	// and before its first request. Every slot waits independently, so requests
+	// start at most Concurrency per RequestDelay. Zero disables the delay.
+	RequestDelay time.Duration
+
+	// AutoTune starts with a low concurrency and adjusts it during the run from
+	// the rate of 403/429 responses, never exceeding Concurrency.
+	// AutoTuneConfig sets its thresholds, floor and pace.
+	// ConcurrencyChanged, when set, is called with each new limit.
+	AutoTune           bool
+	AutoTuneConfig     AutoTuneConfig
+	ConcurrencyChanged func(limit int)
+
+	// HostConfigs, when set, overrides RetryConfig and the client timeout for
+	// URLs on the listed hosts, keyed by lower-case host name without port
+	HostConfigs map[string]HostConfig
+
+	// RecursiveExisting also treats files in subdirectories of the download
+	// directory as already downloaded, matched by file name
+	RecursiveExisting bool
+
+	// ByHost writes each file to a subdirectory named after its URL's host
+	// instead of directly into the download directory
+	ByHost bool
+
+	// Storage, when set, is written to instead of the directory passed to
+	// Download
+	Storage Storage
+
+	// FirstByteTimeout, when positive, fails an attempt whose response body
+	// sends nothing for this long after the headers, with ErrFirstByteTimeout
+	FirstByteTimeout time.Duration
+
+	// BufferSize is the size of the buffer each response body is copied
+	// through. Zero uses DefaultBufferSize.
+	BufferSize int
+
+	// HashFiles computes the SHA-256 of each file as it is written, into
+	// DownloadResult.SHA256, without reading the file again
+	HashFiles bool
+}
+
+// HostConfig is the retry configuration and timeout used for one host
+type HostConfig struct {
+	RetryConfig RetryConfig
+	Timeout     time.Duration // whole-request timeout; 0 keeps the client's
+}
+
+// settingsFor returns the retry configuration and client to use for a URL
+func (d *Downloader) settingsFor(parsedURL *url.URL) (RetryConfig, *http.Client) {
+	hostConfig, ok := d.HostConfigs[strings.ToLower(parsedURL.Hostname())]
+	if !ok {
+		return d.RetryConfig, d.Client
+	}
+	client := d.Client
+	if hostConfig.Timeout > 0 {
+		// A shallow copy keeps sharing the transport and its connection pool
+		hostClient := *d.Client
+		hostClient.Timeout = hostConfig.Timeout
+		client = &hostClient
+	}
+	return hostConfig.RetryConfig, client
+}
+
+// DefaultRequestDelay is the server-friendly pause used by New
+const DefaultRequestDelay = 100 * time.Millisecond
+
+// DefaultBufferSize is the copy buffer used when Downloader.BufferSize is zero
+const DefaultBufferSize = 1024 * 1024 // 1MB
+
+// MinBufferSize is the smallest sensible Downloader.BufferSize
+const MinBufferSize = 4 * 1024 // 4KB
+
+// New creates a Downloader with the default retry configuration,
+// the hardware-based concurrency heuristic and a bulk-download HTTP client
+func New() *Downloader {
+	return &Downloader{
+		RetryConfig: DefaultRetryConfig,
+		Concurrency: OptimalConcurrency(),
+		Client:      NewHTTPClient(),
+
+		RequestDelay:   DefaultRequestDelay,
+		AutoTuneConfig: DefaultAutoTuneConfig,
+		HashFiles:      true,
+	}
+}
+
+// NewHTTPClient creates a highly optimized HTTP client for bulk downloads
+func NewHTTPClient() *http.Client {
+	return NewHTTPClientWithTLS(nil)
+}
+
+// NewHTTPClientWithTLS is NewHTTPClient using tlsConfig for HTTPS connections.
+// A nil tlsConfig keeps Go's default TLS behaviour.
+func NewHTTPClientWithTLS(tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Timeout: 60 * time.Second, // Longer timeout for large files
+		Transport: &http.Transport{
+			MaxIdleConns:          300, // Much higher connection pool
+			MaxIdleConnsPerHost:   100, // More connections per host
+			MaxConnsPerHost:       150, // Higher total connections per host
+			IdleConnTimeout:       120 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+			DisableCompression:    false,
+			WriteBufferSize:       64 * 1024, // 64KB write buffer
+			ReadBufferSize:        64 * 1024, // 64KB read buffer
+			TLSClientConfig:       tlsConfig,
+		},
+	}
+}
+
+// OptimalConcurrency returns a server-friendly number of concurrent downloads
+func OptimalConcurrency() int {
+	cores := runtime.NumCPU()
+
+	// Use much more conservative settings to avoid 403 errors
+	// The bcbsmn.mrf.bcbs.com server is blocking high concurrency
+	if cores >= 6 {
+		return 10 // Very conservative for server-friendly downloading
+	}
+
+	// Even more conservative fallback for other systems
+	baseConcurrency := 5 // Much lower to respect server limits
+
+	min := 5
+	max := 20 // Much lower maximum
+
+	if baseConcurrency < min {
+		return min
+	}
+	if baseConcurrency > max {
+		return max
+	}
+	return baseConcurrency
+}
+
+// Download fetches every URL into dir, or into d.Storage when set, skipping
+// files that already exist there. Results are returned in the same order as
+// urls. If ctx is cancelled the remaining downloads fail with the context
+// error, which is also returned.
+func (d *Downloader) Download(ctx context.Context, urls []string, dir string) ([]DownloadResult, error) {
+	storage, existingFileMap, err := d.prepare(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]DownloadResult, len(urls))
+	d.downloadFiles(ctx, urls, storage, existingFileMap, nil, func(index int, result DownloadResult) {
+		results[index] = result
+	})
+	return results, ctx.Err()
+}
+
+// DownloadStream is Download sending each result on the returned channel
+// instead of collecting them, for URL lists too long to hold every result.
+// Results are sent in the same order as urls. A download only starts once the
+// result streamWindow places before it has been sent, so a slow download holds
+// back at most that many finished ones. The channel must be read to the end;
+// it is closed after the last result, and if ctx was cancelled the remaining
+// downloads fail with its error.
+func (d *Downloader) DownloadStream(ctx context.Context, urls []string, dir string) (<-chan DownloadResult, error) {
+	storage, existingFileMap, err := d.prepare(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := make(chan DownloadResult, d.Concurrency)
+	// Each admitted download has a slot for its result, queued in URL order
+	order := make(chan chan DownloadResult, streamWindow*max(d.Concurrency, 1))
+	var mu sync.Mutex
+	slots := make(map[int]chan DownloadResult)
+
+	// Only this goroutine sends, so a slow reader blocks no download
+	go func() {
+		defer close(stream)
+		for slot := range order {
+			stream <- <-slot
+		}
+	}()
+	go func() {
+		defer close(order)
+		admit := func(index int) {
+			slot := make(chan DownloadResult, 1)
+			mu.Lock()
+			slots[index] = slot
+			mu.Unlock()
+			order <- slot // blocks while the window is full
+		}
+		d.downloadFiles(ctx, urls, storage, existingFileMap, admit, func(index int, result DownloadResult) {
+			mu.Lock()
+			slot := slots[index]
+			delete(slots, index)
+			mu.Unlock()
+			slot <- result
+		})
+	}()
+	return stream, nil
+}
+
+// streamWindow is how many results per concurrent download DownloadStream
+// lets finish ahead of the next one it sends
+const streamWindow = 2
+
+// prepare returns the storage to download to and the files already in it
+func (d *Downloader) prepare(dir string) (Storage, map[string]string, error) {
+	storage := d.Storage
+	if storage == nil {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, nil, fmt.Errorf("failed to create download directory: %v", err)
+		}
+		storage = LocalStorage{Dir: dir}
+	}
+
+	// Pre-check existing files in batch for faster processing. Host
+	// subdirectories have to be listed to find files downloaded by host.
+	existingFileMap := BuildExistingFileMap(storage, d.RecursiveExisting || d.ByHost)
+	return storage, existingFileMap, nil
+}
+
+// downloadFiles downloads multiple files concurrently, passing each result to
+// done with the index of its URL. done is called from several goroutines at
+// once. A download only starts once it has a slot, so the number of goroutines
+// stays within the concurrency however many URLs there are. admit, when set,
+// is called with each index in turn before its slot is taken, and may block.
+func (d *Downloader) downloadFiles(ctx context.Context, urls []string, storage Storage, existingFileMap map[string]string, admit func(index int), done func(index int, result DownloadResult)) {
+	concurrency := d.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+
+	// Slots are either a fixed-size semaphore or the auto-tuner
+	var acquire func() error
+	var release func()
+	var tuner *concurrencyTuner
+	stopTuner := make(chan struct{})
+	if d.AutoTune {
+		tuner = newConcurrencyTuner(concurrency, d.AutoTuneConfig, d.ConcurrencyChanged)
+		go tuner.run(stopTuner)
+		acquire = func() error { return tuner.acquire(ctx) }
+		release = tuner.release
+	} else {
+		semaphore := make(chan struct{}, concurrency)
+		acquire = func() error {
+			select {
+			case semaphore <- struct{}{}: // Acquire semaphore
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		release = func() { <-semaphore }
+	}
+
+	// Progress tracking
+	tracker := newProgressTracker(len(urls))
+	stopProgress := make(chan struct{})
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		if d.Progress != nil {
+			tracker.run(d.Progress, stopProgress)
+		}
+	}()
+
+	for i, urlString := range urls {
+		if admit != nil {
+			admit(i)
+		}
+		if err := acquire(); err != nil {
+			done(i, DownloadResult{URL: urlString, Error: err})
+			tracker.completed.Add(1)
+			continue
+		}
+
+		wg.Add(1)
+		go func(index int, url string) {
+			defer wg.Done()
+			// Count the file as completed however it finishes
+			defer tracker.completed.Add(1)
+			defer release()
+
+			// Add small delay to be more server-friendly
+			if d.RequestDelay > 0 {
+				if err := sleepContext(ctx, d.RequestDelay); err != nil {
+					done(index, DownloadResult{URL: url, Error: err})
+					return
+				}
+			}
+
+			if d.Observer != nil {
+				d.Observer.DownloadStarted(url)
+			}
+			start := time.Now()
+			result := d.downloadFile(ctx, url, storage, existingFileMap, &tracker.bytes, tuner)
+			if d.Observer != nil {
+				d.Observer.DownloadFinished(result, time.Since(start))
+			}
+			done(index, result)
+		}(i, urlString)
+	}
+
+	wg.Wait()
+	close(stopTuner)
+	close(stopProgress) // Stop the progress goroutine after its final update
+	<-progressDone
+}
+
+// downloadFile downloads a single file with optimized I/O and retry logic
+func (d *Downloader) downloadFile(ctx context.Context, urlString string, storage Storage, existingFileMap map[string]string, bytesWritten *atomic.Int64, tuner *concurrencyTuner) (result DownloadResult) {
+	result.URL = urlString
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start) }()
+
+	// Create filename from URL
+	parsedURL, err := url.Parse(urlString)
+	if err != nil {
+		result.Error = fmt.Errorf("invalid URL: %v", err)
+		return result
+	}
+
+	relPath := RelativePath(parsedURL, d.ByHost)
+	retryConfig, client := d.settingsFor(parsedURL)
+
+	// Check if file already exists using the pre-built map (much faster)
+	if existing, ok := ExistingPath(existingFileMap, relPath, d.RecursiveExisting); ok {
+		result.Success = true
+		result.FilePath = storage.Path(existing)
+		return result
+	}
+
+	// Attempt download with retry logic
+	var delay time.Duration
+	for attempt := 0; attempt <= retryConfig.MaxRetries; attempt++ {
+		if attempt > 0 {
+			// Calculate and apply backoff delay
+			delay = NextBackoffDelay(attempt-1, delay, retryConfig)
+			if err := sleepContext(ctx, delay); err != nil {
+				result.Error = err
+				return result
+			}
+		}
+
+		// Download the file using the optimized HTTP client
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlString, nil)
+		if err != nil {
+			result.Error = fmt.Errorf("invalid request: %v", err)
+			return result
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			result.Error = fmt.Errorf("HTTP request failed: %v", err)
+			result.Retries = attempt
+
+			// Check if this is a retryable error and we have retries left
+			if retryConfig.IsRetryableError(err) && attempt < retryConfig.MaxRetries && ctx.Err() == nil {
+				continue
+			}
+			return result
+		}
+
+		result.StatusCode = resp.StatusCode
+		result.FinalURL = resp.Request.URL.String()
+		if tuner != nil {
+			tuner.observe(resp.StatusCode)
+		}
+
+		// Check HTTP status code
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			result.Error = fmt.Errorf("HTTP status %d", resp.StatusCode)
+			result.Retries = attempt
+
+			// Check if this is a retryable status and we have retries left
+			if retryConfig.IsRetryableHTTPStatus(resp.StatusCode) && attempt < retryConfig.MaxRetries {
+				continue
+			}
+			return result
+		}
+
+		// Reject oversized files up front when the server tells us the size
+		if d.MaxFileSize > 0 && resp.ContentLength > d.MaxFileSize {
+			resp.Body.Close()
+			result.Error = fmt.Errorf("%w: Content-Length %d > %d bytes", ErrExceedsMaxSize, resp.ContentLength, d.MaxFileSize)
+			result.Retries = attempt
+			return result
+		}
+
+		// Create the file with larger buffer for better I/O performance
+		file, err := storage.Create(relPath)
+		if err != nil {
+			resp.Body.Close()
+			result.Error = fmt.Errorf("failed to create file: %v", err)
+			result.Retries = attempt
+			return result
+		}
+
+		// Use a larger buffer for faster copying (1MB by default)
+		bufferSize := d.BufferSize
+		if bufferSize <= 0 {
+			bufferSize = DefaultBufferSize
+		}
+		buffer := make([]byte, bufferSize)
+		var body io.Reader = resp.Body
+		var firstByte *firstByteReader
+		if d.FirstByteTimeout > 0 {
+			firstByte = newFirstByteReader(resp.Body, d.FirstByteTimeout)
+			body = firstByte
+		}
+		if d.Limiter != nil {
+			body = &rateLimitedReader{ctx: ctx, r: body, limiter: d.Limiter}
+		}
+		if d.MaxFileSize > 0 {
+			// Read one byte past the cap so chunked/unknown-length bodies can be detected
+			body = io.LimitReader(body, d.MaxFileSize+1)
+		}
+		var out io.Writer = file
+		var hasher hash.Hash
+		if d.HashFiles {
+			hasher = sha256.New()
+			out = io.MultiWriter(file, hasher)
+		}
+		written, err := io.CopyBuffer(countingWriter{w: out, n: bytesWritten}, body, buffer)
+		result.Bytes = written
+
+		// Close resources. Storage may only finish writing on Close, so a
+		// partial file is aborted instead of closed and then removed.
+		if firstByte != nil {
+			firstByte.stop()
+		}
+		resp.Body.Close()
+		oversized := err == nil && d.MaxFileSize > 0 && written > d.MaxFileSize
+		if err != nil || oversized {
+			abortFile(storage, relPath, file, err)
+		} else if err = file.Close(); err != nil {
+			storage.Remove(relPath)
+		}
+
+		if oversized {
+			// Size violations are not retryable
+			result.Error = fmt.Errorf("%w: response body > %d bytes", ErrExceedsMaxSize, d.MaxFileSize)
+			result.Retries = attempt
+			return result
+		}
+
+		if err != nil {
+			result.Retries = attempt
+
+			// A stalled response is retried like a network error
+			if errors.Is(err, ErrFirstByteTimeout) {
+				result.Error = err
+				if attempt < retryConfig.MaxRetries && ctx.Err() == nil {
+					continue
+				}
+				return result
+			}
+			result.Error = fmt.Errorf("failed to write file: %v", err)
+
+			// File writing errors are usually not retryable (disk space, permissions)
+			return result
+		}
+
+		// Success!
+		result.Success = true
+		if hasher != nil {
+			result.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+		}
+		result.FilePath = storage.Path(relPath)
+		result.Retries = attempt
+		return result
+	}
+
+	// This should never be reached due to the loop logic, but just in case
+	result.Error = fmt.Errorf("max retries exceeded")
+	result.Retries = retryConfig.MaxRetries
+	return result
+}
+
+// sleepContext waits for the given duration or until ctx is cancelled
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// FilenameFromURL extracts the local filename from the last segment of the URL path
+func FilenameFromURL(parsedURL *url.URL) string {
+	pathParts := strings.Split(parsedURL.Path, "/")
+	filename := pathParts[len(pathParts)-1]
+	if filename == "" {
+		filename = "unknown_file"
+	}
+	return filename
+}
+
+// RelativePath is the slash-separated path, relative to the download
+// directory, that a URL downloads to: its file name, under a directory named
+// after the URL's host when byHost is set
+func RelativePath(parsedURL *url.URL, byHost bool) string {
+	filename := FilenameFromURL(parsedURL)
+	if !byHost {
+		return filename
+	}
+	host := strings.ToLower(parsedURL.Hostname())
+	if host == "" {
+		host = "unknown_host"
+	}
+	// IPv6 literals contain colons, which Windows rejects in file names
+	host = strings.ReplaceAll(host, ":", "_")
+	return host + "/" + filename
+}
+
+// CountExistingFiles counts the files at the top level of storage and, when
+// recursive is set, in its subdirectories
+func CountExistingFiles(storage Storage, recursive bool) int {
+	return len(listExistingFiles(storage, recursive))
+}
+
+// BuildExistingFileMap maps the path, relative to the root of storage and
+// slash-separated, of each existing file to itself for fast lookup by the path
+// a URL downloads to. When recursive is set, files in subdirectories are
+// listed too and each file name is also mapped to a file of that name, so
+// ExistingPath can match by name; a file at the top level takes precedence,
+// then the lexically first.
+func BuildExistingFileMap(storage Storage, recursive bool) map[string]string {
+	fileMap := make(map[string]string)
+	for _, relPath := range listExistingFiles(storage, recursive) {
+		fileMap[relPath] = relPath
+	}
+	if recursive {
+		for relPath := range fileMap {
+			if !strings.Contains(relPath, "/") {
+				continue
+			}
+			name := path.Base(relPath)
+			existing, ok := fileMap[name]
+			if !ok || (strings.Contains(existing, "/") && relPath < existing) {
+				fileMap[name] = relPath
+			}
+		}
+	}
+	return fileMap
+}
+
+// ExistingPath returns the path of the existing file that stands in for a
+// download to relPath: the file at relPath itself or, when recursive is set,
+// any file of the same name in the map built by BuildExistingFileMap
+func ExistingPath(existingFileMap map[string]string, relPath string, recursive bool) (string, bool) {
+	if existing, ok := existingFileMap[relPath]; ok {
+		return existing, true
+	}
+	if recursive {
+		existing, ok := existingFileMap[path.Base(relPath)]
+		return existing, ok
+	}
+	return "", false
+}
+
+// listExistingFiles returns the names of the files in storage, leaving out
+// those in subdirectories unless recursive is set
+func listExistingFiles(storage Storage, recursive bool) []string {
+	names := storage.List()
+	if recursive {
+		return names
+	}
+	topLevel := names[:0]
+	for _, name := range names {
+		if !strings.Contains(name, "/") {
+			topLevel = append(topLevel, name)
+		}
+	}
+	return topLevel
+}
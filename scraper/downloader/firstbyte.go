@@ -0,0 +1,58 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// ErrFirstByteTimeout is returned when a response sends its headers but no body
+// within Downloader.FirstByteTimeout. It is retried like a network error.
+var ErrFirstByteTimeout = errors.New("no response body received")
+
+// firstByteReader closes body if its first byte does not arrive within the
+// timeout, failing the blocked read, so a server that sends headers and then
+// stalls fails fast however long the whole download is allowed to take
+type firstByteReader struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	state   atomic.Int32 // firstByteWaiting until the first byte or the timeout, whichever comes first
+}
+
+// States of a firstByteReader. Each moves only from firstByteWaiting, so once
+// the first byte has arrived the timer can no longer close the body.
+const (
+	firstByteWaiting int32 = iota
+	firstByteArrived       // or the reader was stopped
+	firstByteTimedOut
+)
+
+func newFirstByteReader(body io.ReadCloser, timeout time.Duration) *firstByteReader {
+	fb := &firstByteReader{body: body, timeout: timeout}
+	fb.timer = time.AfterFunc(timeout, func() {
+		if fb.state.CompareAndSwap(firstByteWaiting, firstByteTimedOut) {
+			body.Close()
+		}
+	})
+	return fb
+}
+
+func (fb *firstByteReader) Read(p []byte) (int, error) {
+	n, err := fb.body.Read(p)
+	if n > 0 && fb.state.CompareAndSwap(firstByteWaiting, firstByteArrived) {
+		fb.timer.Stop()
+	}
+	if err != nil && err != io.EOF && fb.state.Load() == firstByteTimedOut {
+		return n, fmt.Errorf("%w within %v", ErrFirstByteTimeout, fb.timeout)
+	}
+	return n, err
+}
+
+// stop disarms the timer once the body is no longer read
+func (fb *firstByteReader) stop() {
+	fb.state.CompareAndSwap(firstByteWaiting, firstByteArrived)
+	fb.timer.Stop()
+}
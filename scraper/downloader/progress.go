@@ -0,0 +1,86 @@
+package downloader
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Progress is a snapshot of a running download batch
+type Progress struct {
+	Completed      int           // files finished (downloaded, skipped or failed)
+	Total          int           // files in the batch
+	Bytes          int64         // bytes written to disk so far
+	Elapsed        time.Duration // time since the batch started
+	BytesPerSecond float64       // average throughput since the batch started
+	ETA            time.Duration // estimated time remaining, zero when unknown
+	Done           bool          // true for the final update of the batch
+}
+
+// ProgressCallback receives periodic progress updates from Download
+type ProgressCallback func(Progress)
+
+// progressInterval is how often progress callbacks fire while downloading
+const progressInterval = 2 * time.Second
+
+// progressTracker collects counters from the download workers
+type progressTracker struct {
+	total     int
+	start     time.Time
+	completed atomic.Int64
+	bytes     atomic.Int64
+}
+
+func newProgressTracker(total int) *progressTracker {
+	return &progressTracker{total: total, start: time.Now()}
+}
+
+// snapshot computes throughput and ETA from the current counters
+func (pt *progressTracker) snapshot(done bool) Progress {
+	p := Progress{
+		Completed: int(pt.completed.Load()),
+		Total:     pt.total,
+		Bytes:     pt.bytes.Load(),
+		Elapsed:   time.Since(pt.start),
+		Done:      done,
+	}
+
+	if seconds := p.Elapsed.Seconds(); seconds > 0 {
+		p.BytesPerSecond = float64(p.Bytes) / seconds
+	}
+	// Estimate remaining time from the average time per completed file
+	if p.Completed > 0 && p.Completed < p.Total {
+		perFile := p.Elapsed / time.Duration(p.Completed)
+		p.ETA = perFile * time.Duration(p.Total-p.Completed)
+	}
+
+	return p
+}
+
+// run reports progress on a ticker until stop is closed, then sends a final update
+func (pt *progressTracker) run(callback ProgressCallback, stop <-chan struct{}) {
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			callback(pt.snapshot(false))
+		case <-stop:
+			callback(pt.snapshot(true))
+			return
+		}
+	}
+}
+
+// countingWriter adds the number of bytes written to a shared counter
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (cw countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n.Add(int64(n))
+	return n, err
+}
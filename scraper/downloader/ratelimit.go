@@ -0,0 +1,83 @@
+package downloader
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// BandwidthLimiter is a token bucket on bytes shared across concurrent downloads,
+// so the aggregate throughput stays under the configured rate
+type BandwidthLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	burst  float64 // maximum tokens that can accumulate
+	tokens float64
+	last   time.Time
+}
+
+// NewBandwidthLimiter creates a limiter allowing bytesPerSec bytes per second in total
+func NewBandwidthLimiter(bytesPerSec int64) *BandwidthLimiter {
+	return &BandwidthLimiter{
+		rate:   float64(bytesPerSec),
+		burst:  float64(bytesPerSec),
+		tokens: float64(bytesPerSec),
+		last:   time.Now(),
+	}
+}
+
+// chunkSize is the largest read that should be made in one go, so that a single
+// large buffer can't consume more than one second of budget at once
+func (l *BandwidthLimiter) chunkSize() int {
+	return int(l.burst)
+}
+
+// WaitN takes n bytes from the bucket, blocking until they are available or ctx is done
+func (l *BandwidthLimiter) WaitN(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	// Take the tokens now (possibly going into debt) and wait off the deficit,
+	// which keeps waiters in arrival order without a queue
+	l.tokens -= float64(n)
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	return sleepContext(ctx, wait)
+}
+
+// rateLimitedReader throttles reads from r through a shared BandwidthLimiter
+type rateLimitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *BandwidthLimiter
+}
+
+func (rl *rateLimitedReader) Read(p []byte) (int, error) {
+	if err := rl.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if max := rl.limiter.chunkSize(); max > 0 && len(p) > max {
+		p = p[:max]
+	}
+
+	n, err := rl.r.Read(p)
+	if n > 0 {
+		if waitErr := rl.limiter.WaitN(rl.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,24 @@
+package downloader
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// DefaultMaxRedirects matches the limit net/http applies when CheckRedirect is nil
+const DefaultMaxRedirects = 10
+
+// RedirectPolicy returns an http.Client CheckRedirect function following at most
+// maxRedirects redirects. With zero the 3xx response itself is returned, which
+// downloadFile then reports as a non-200 status.
+func RedirectPolicy(maxRedirects int) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if maxRedirects == 0 {
+			return http.ErrUseLastResponse
+		}
+		if len(via) > maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,188 @@
+package downloader
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// RetryConfig holds configuration for retry logic
+type RetryConfig struct {
+	MaxRetries    int
+	InitialDelay  time.Duration
+	MaxDelay      time.Duration
+	BackoffFactor float64
+	JitterFactor  float64 // used by JitterProportional
+	JitterMode    JitterMode
+
+	// RetryableStatuses and RetryableErrors override the default retry lists when non-nil
+	RetryableStatuses []int
+	RetryableErrors   []string
+}
+
+// JitterMode selects how backoff delays are randomised
+type JitterMode string
+
+const (
+	// JitterProportional adds up to ±JitterFactor of the exponential delay.
+	// The empty mode means this one.
+	JitterProportional JitterMode = "proportional"
+	// JitterNone uses the exponential delay as is
+	JitterNone JitterMode = "none"
+	// JitterFull picks uniformly between 0 and the exponential delay
+	JitterFull JitterMode = "full"
+	// JitterEqual keeps half the exponential delay and randomises the other half
+	JitterEqual JitterMode = "equal"
+	// JitterDecorrelated picks uniformly between InitialDelay and three times
+	// the previous delay, so retries of different clients drift apart
+	JitterDecorrelated JitterMode = "decorrelated"
+)
+
+// JitterModes lists the valid modes, for flag help and errors
+var JitterModes = []JitterMode{JitterProportional, JitterNone, JitterFull, JitterEqual, JitterDecorrelated}
+
+// ParseJitterMode validates a jitter mode name
+func ParseJitterMode(name string) (JitterMode, error) {
+	for _, mode := range JitterModes {
+		if JitterMode(name) == mode {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("unknown jitter mode %q", name)
+}
+
+// DefaultRetryConfig is the retry configuration used when none is supplied
+var DefaultRetryConfig = RetryConfig{
+	MaxRetries:    3,
+	InitialDelay:  1 * time.Second,
+	MaxDelay:      30 * time.Second,
+	BackoffFactor: 2.0,
+	JitterFactor:  0.1,
+	JitterMode:    JitterProportional,
+}
+
+// CalculateBackoffDelay calculates the delay for the next retry attempt.
+// JitterDecorrelated depends on the previous delay, which is taken to be the
+// exponential delay of the previous attempt; loops that know the delay they
+// actually slept should use NextBackoffDelay.
+func CalculateBackoffDelay(attempt int, config RetryConfig) time.Duration {
+	var previous time.Duration
+	if attempt > 0 {
+		previous = time.Duration(exponentialDelay(attempt-1, config))
+	}
+	return NextBackoffDelay(attempt, previous, config)
+}
+
+// NextBackoffDelay calculates the delay for the next retry attempt given the
+// delay slept before the previous one (0 before the first retry)
+func NextBackoffDelay(attempt int, previous time.Duration, config RetryConfig) time.Duration {
+	exponential := exponentialDelay(attempt, config)
+
+	var delay float64
+	switch config.JitterMode {
+	case JitterNone:
+		delay = exponential
+	case JitterFull:
+		delay = rand.Float64() * exponential
+	case JitterEqual:
+		delay = exponential/2 + rand.Float64()*exponential/2
+	case JitterDecorrelated:
+		base := float64(config.InitialDelay)
+		upper := 3 * float64(previous)
+		if upper < base {
+			upper = base * 3
+		}
+		delay = base + rand.Float64()*(upper-base)
+	default:
+		if attempt <= 0 {
+			return config.InitialDelay
+		}
+		// Add jitter to prevent thundering herd
+		jitter := exponential * config.JitterFactor * (rand.Float64()*2 - 1) // ±jitterFactor
+		delay = exponential + jitter
+	}
+
+	// Cap at maximum delay
+	if delay > float64(config.MaxDelay) {
+		delay = float64(config.MaxDelay)
+	}
+
+	return time.Duration(delay)
+}
+
+// exponentialDelay is initial * (factor ^ attempt), before jitter and the cap
+func exponentialDelay(attempt int, config RetryConfig) float64 {
+	if attempt <= 0 {
+		return float64(config.InitialDelay)
+	}
+	return float64(config.InitialDelay) * math.Pow(config.BackoffFactor, float64(attempt))
+}
+
+// DefaultRetryableErrors are the error substrings retried when RetryConfig.RetryableErrors is nil
+var DefaultRetryableErrors = []string{
+	"timeout",
+	"connection reset",
+	"connection refused",
+	"temporary failure",
+	"no route to host",
+	"network is unreachable",
+}
+
+// DefaultRetryableStatuses are the HTTP statuses retried when RetryConfig.RetryableStatuses is nil
+var DefaultRetryableStatuses = []int{
+	429, // Too Many Requests
+	500, // Internal Server Error
+	502, // Bad Gateway
+	503, // Service Unavailable
+	504, // Gateway Timeout
+}
+
+// IsRetryableError determines if an error should trigger a retry
+func IsRetryableError(err error) bool {
+	return DefaultRetryConfig.IsRetryableError(err)
+}
+
+// IsRetryableHTTPStatus determines if an HTTP status code should trigger a retry
+func IsRetryableHTTPStatus(statusCode int) bool {
+	return DefaultRetryConfig.IsRetryableHTTPStatus(statusCode)
+}
+
+// IsRetryableError determines if an error should trigger a retry under this config
+func (c RetryConfig) IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	retryableErrors := c.RetryableErrors
+	if retryableErrors == nil {
+		retryableErrors = DefaultRetryableErrors
+	}
+
+	// Check for network-related errors that are typically retryable
+	errStr := strings.ToLower(err.Error())
+	for _, retryable := range retryableErrors {
+		if strings.Contains(errStr, strings.ToLower(retryable)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsRetryableHTTPStatus determines if an HTTP status code should trigger a retry under this config
+func (c RetryConfig) IsRetryableHTTPStatus(statusCode int) bool {
+	retryableStatusCodes := c.RetryableStatuses
+	if retryableStatusCodes == nil {
+		retryableStatusCodes = DefaultRetryableStatuses
+	}
+
+	for _, code := range retryableStatusCodes {
+		if statusCode == code {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,78 @@
+package downloader
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextBackoffDelayBounds(t *testing.T) {
+	config := RetryConfig{
+		InitialDelay:  time.Second,
+		MaxDelay:      30 * time.Second,
+		BackoffFactor: 2,
+		JitterFactor:  0.1,
+	}
+	capped := func(d float64) time.Duration {
+		return min(time.Duration(d), config.MaxDelay)
+	}
+
+	tests := []struct {
+		mode JitterMode
+		// bounds returns the least and greatest delay for an attempt
+		bounds func(attempt int, previous time.Duration) (lo, hi time.Duration)
+	}{
+		{JitterNone, func(attempt int, _ time.Duration) (time.Duration, time.Duration) {
+			d := capped(exponentialDelay(attempt, config))
+			return d, d
+		}},
+		{JitterFull, func(attempt int, _ time.Duration) (time.Duration, time.Duration) {
+			return 0, capped(exponentialDelay(attempt, config))
+		}},
+		{JitterEqual, func(attempt int, _ time.Duration) (time.Duration, time.Duration) {
+			exponential := exponentialDelay(attempt, config)
+			return capped(exponential / 2), capped(exponential)
+		}},
+		{JitterDecorrelated, func(_ int, previous time.Duration) (time.Duration, time.Duration) {
+			upper := max(3*previous, 3*config.InitialDelay)
+			return capped(float64(config.InitialDelay)), capped(float64(upper))
+		}},
+		{JitterProportional, func(attempt int, _ time.Duration) (time.Duration, time.Duration) {
+			if attempt == 0 {
+				return config.InitialDelay, config.InitialDelay
+			}
+			exponential := exponentialDelay(attempt, config)
+			return capped(exponential * (1 - config.JitterFactor)), capped(exponential * (1 + config.JitterFactor))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			config := config
+			config.JitterMode = tt.mode
+			for sample := 0; sample < 1000; sample++ {
+				var previous time.Duration
+				for attempt := 0; attempt < 8; attempt++ {
+					d := NextBackoffDelay(attempt, previous, config)
+					lo, hi := tt.bounds(attempt, previous)
+					if d < lo || d > hi {
+						t.Fatalf("attempt %d after %v: delay %v outside [%v, %v]", attempt, previous, d, lo, hi)
+					}
+					previous = d
+				}
+			}
+		})
+	}
+}
+
+func TestNextBackoffDelayNoneIsDeterministic(t *testing.T) {
+	config := DefaultRetryConfig
+	config.JitterMode = JitterNone
+	for attempt := 0; attempt < 8; attempt++ {
+		first := NextBackoffDelay(attempt, 0, config)
+		for i := 0; i < 100; i++ {
+			if d := NextBackoffDelay(attempt, 0, config); d != first {
+				t.Fatalf("attempt %d: delay %v, then %v", attempt, first, d)
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package downloader
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Storage is where downloaded files are written. Names are slash-separated
+// paths relative to the root of the storage, as returned by RelativePath.
+type Storage interface {
+	// Create starts writing name, replacing any existing file. The file is
+	// only complete once Close returns nil.
+	Create(name string) (io.WriteCloser, error)
+	// Exists reports whether name has been written
+	Exists(name string) bool
+	// List returns the names of every file, including those in subdirectories
+	List() []string
+	// Remove deletes name, e.g. a partially written download
+	Remove(name string) error
+	// Path is where name is, reported as DownloadResult.FilePath
+	Path(name string) string
+}
+
+// Aborter is implemented by writers returned by Storage.Create that can
+// discard a partly written file instead of completing it, such as an upload
+// that would otherwise publish the truncated file on Close
+type Aborter interface {
+	// Abort ends the write with err; the file is never created
+	Abort(err error) error
+}
+
+// abortFile discards the partly written file name: a writer that is an
+// Aborter is aborted, any other is closed and the file removed
+func abortFile(storage Storage, name string, file io.WriteCloser, err error) {
+	if aborter, ok := file.(Aborter); ok {
+		aborter.Abort(err)
+		return
+	}
+	file.Close()
+	storage.Remove(name)
+}
+
+// LocalStorage keeps downloads in a directory on the local filesystem
+type LocalStorage struct {
+	Dir string
+}
+
+// Create creates name and any parent directories it needs
+func (s LocalStorage) Create(name string) (io.WriteCloser, error) {
+	filePath := s.Path(name)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(filePath)
+}
+
+func (s LocalStorage) Exists(name string) bool {
+	_, err := os.Stat(s.Path(name))
+	return err == nil
+}
+
+func (s LocalStorage) List() []string {
+	var relPaths []string
+	filepath.WalkDir(s.Dir, func(walkPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip unreadable subdirectories rather than giving up on the rest
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(s.Dir, walkPath)
+		if err != nil {
+			return nil
+		}
+		relPaths = append(relPaths, filepath.ToSlash(relPath))
+		return nil
+	})
+	return relPaths
+}
+
+func (s LocalStorage) Remove(name string) error {
+	return os.Remove(s.Path(name))
+}
+
+func (s LocalStorage) Path(name string) string {
+	return filepath.Join(s.Dir, filepath.FromSlash(name))
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"scraper/scrape"
+)
+
+func main() {
+	scrape.Main(os.Args[0], os.Args[1:])
+}
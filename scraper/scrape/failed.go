@@ -0,0 +1,88 @@
+package scrape
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"scraper/downloader"
+)
+
+// writeFailedURLs writes the URL of every unsuccessful download among results,
+// out of total downloads, to path in
+// the format loadURLsFromFile reads, so the file can be passed straight back
+// in. A header comment records when the run started and how many downloads
+// failed for each reason, each URL is preceded by a comment with its own
+// error, and the #config lines for the hosts involved are carried over.
+func writeFailedURLs(path string, results []downloader.DownloadResult, total int, directives map[string]hostDirective, started time.Time) (int, error) {
+	var failed []downloader.DownloadResult
+	reasons := make(map[string]int)
+	hosts := make(map[string]bool)
+	for _, result := range results {
+		if result.Success {
+			continue
+		}
+		failed = append(failed, result)
+		reasons[failureReason(result)]++
+		if parsedURL, err := url.Parse(result.URL); err == nil {
+			hosts[strings.ToLower(parsedURL.Hostname())] = true
+		}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	w := bufio.NewWriter(file)
+
+	fmt.Fprintf(w, "# failed downloads from the run started %s: %d of %d\n", started.Format(time.RFC3339), len(failed), total)
+	reasonNames := make([]string, 0, len(reasons))
+	for reason := range reasons {
+		reasonNames = append(reasonNames, reason)
+	}
+	sort.Slice(reasonNames, func(i, j int) bool {
+		if reasons[reasonNames[i]] != reasons[reasonNames[j]] {
+			return reasons[reasonNames[i]] > reasons[reasonNames[j]]
+		}
+		return reasonNames[i] < reasonNames[j]
+	})
+	for _, reason := range reasonNames {
+		fmt.Fprintf(w, "#   %d x %s\n", reasons[reason], reason)
+	}
+
+	directiveHosts := make([]string, 0, len(directives))
+	for host := range directives {
+		if hosts[host] {
+			directiveHosts = append(directiveHosts, host)
+		}
+	}
+	sort.Strings(directiveHosts)
+	for _, host := range directiveHosts {
+		fmt.Fprintln(w, directives[host].line(host))
+	}
+
+	for _, result := range failed {
+		fmt.Fprintf(w, "# %s\n%s\n", failureReason(result), result.URL)
+	}
+
+	err = w.Flush()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(failed), nil
+}
+
+// failureReason is the one-line error of a failed download
+func failureReason(result downloader.DownloadResult) string {
+	if result.Error == nil {
+		return "unknown error"
+	}
+	return strings.ReplaceAll(result.Error.Error(), "\n", " ")
+}
@@ -0,0 +1,121 @@
+package scrape
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"scraper/downloader"
+)
+
+// configDirectivePrefix starts a URL file line that overrides retry settings
+// for one host, e.g. "#config host=cdn.example.com max-retries=5 timeout=120s".
+// Being a comment, it is ignored by older versions of the scraper.
+const configDirectivePrefix = "#config"
+
+// hostDirective holds the settings of the #config lines for one host. Unset
+// settings keep the values given on the command line.
+type hostDirective struct {
+	maxRetries   *int
+	initialDelay time.Duration
+	maxDelay     time.Duration
+	timeout      time.Duration
+}
+
+// isConfigDirective reports whether a URL file line is a #config directive
+func isConfigDirective(line string) bool {
+	fields := strings.Fields(line)
+	return len(fields) > 0 && fields[0] == configDirectivePrefix
+}
+
+// parseConfigDirective merges a #config line into directives, keyed by host.
+// A later line for the same host overrides the settings it repeats.
+func parseConfigDirective(line string, directives map[string]hostDirective) error {
+	var host string
+	var settings [][2]string
+	for _, field := range strings.Fields(line)[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || value == "" {
+			return fmt.Errorf("invalid #config setting %q: want key=value", field)
+		}
+		if key == "host" {
+			host = strings.ToLower(value)
+			continue
+		}
+		settings = append(settings, [2]string{key, value})
+	}
+	if host == "" {
+		return fmt.Errorf("#config line has no host=: %q", line)
+	}
+
+	directive := directives[host]
+	for _, setting := range settings {
+		key, value := setting[0], setting[1]
+		switch key {
+		case "max-retries":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid #config max-retries %q for %s", value, host)
+			}
+			directive.maxRetries = &n
+		case "initial-delay", "max-delay", "timeout":
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return fmt.Errorf("invalid #config %s %q for %s", key, value, host)
+			}
+			switch key {
+			case "initial-delay":
+				directive.initialDelay = d
+			case "max-delay":
+				directive.maxDelay = d
+			default:
+				directive.timeout = d
+			}
+		default:
+			return fmt.Errorf("unknown #config setting %q (want host, max-retries, initial-delay, max-delay or timeout)", key)
+		}
+	}
+	directives[host] = directive
+	return nil
+}
+
+// line formats the directive as the #config line that parses back into it
+func (d hostDirective) line(host string) string {
+	fields := []string{configDirectivePrefix, "host=" + host}
+	if d.maxRetries != nil {
+		fields = append(fields, "max-retries="+strconv.Itoa(*d.maxRetries))
+	}
+	if d.initialDelay > 0 {
+		fields = append(fields, "initial-delay="+d.initialDelay.String())
+	}
+	if d.maxDelay > 0 {
+		fields = append(fields, "max-delay="+d.maxDelay.String())
+	}
+	if d.timeout > 0 {
+		fields = append(fields, "timeout="+d.timeout.String())
+	}
+	return strings.Join(fields, " ")
+}
+
+// hostConfigs applies each host's directive on top of the run's retry configuration
+func hostConfigs(directives map[string]hostDirective, base downloader.RetryConfig) map[string]downloader.HostConfig {
+	if len(directives) == 0 {
+		return nil
+	}
+	configs := make(map[string]downloader.HostConfig, len(directives))
+	for host, directive := range directives {
+		retry := base
+		if directive.maxRetries != nil {
+			retry.MaxRetries = *directive.maxRetries
+		}
+		if directive.initialDelay > 0 {
+			retry.InitialDelay = directive.initialDelay
+		}
+		if directive.maxDelay > 0 {
+			retry.MaxDelay = directive.maxDelay
+		}
+		configs[host] = downloader.HostConfig{RetryConfig: retry, Timeout: directive.timeout}
+	}
+	return configs
+}
@@ -0,0 +1,109 @@
+package scrape
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"scraper/downloader"
+)
+
+// promObserver exports download lifecycle events as Prometheus metrics
+type promObserver struct {
+	succeeded prometheus.Counter
+	failed    prometheus.Counter
+	retried   prometheus.Counter
+	inFlight  prometheus.Gauge
+	duration  prometheus.Histogram
+}
+
+func newPromObserver(registry *prometheus.Registry) *promObserver {
+	o := &promObserver{
+		succeeded: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "scraper_downloads_succeeded_total",
+			Help: "Downloads that completed successfully (including files already present).",
+		}),
+		failed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "scraper_downloads_failed_total",
+			Help: "Downloads that failed after all retries.",
+		}),
+		retried: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "scraper_download_retries_total",
+			Help: "Retry attempts made across all downloads.",
+		}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "scraper_downloads_in_flight",
+			Help: "Downloads currently in progress.",
+		}),
+		duration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "scraper_download_duration_seconds",
+			Help:    "Time taken per file, including retries.",
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 14), // 0.1s .. ~27m
+		}),
+	}
+	registry.MustRegister(o.succeeded, o.failed, o.retried, o.inFlight, o.duration)
+	return o
+}
+
+func (o *promObserver) DownloadStarted(url string) {
+	o.inFlight.Inc()
+}
+
+func (o *promObserver) DownloadFinished(result downloader.DownloadResult, elapsed time.Duration) {
+	o.inFlight.Dec()
+	o.duration.Observe(elapsed.Seconds())
+	o.retried.Add(float64(result.Retries))
+	if result.Success {
+		o.succeeded.Inc()
+	} else {
+		o.failed.Inc()
+	}
+}
+
+// startMetricsServer serves /metrics on addr until ctx is cancelled or the
+// returned shutdown function is called
+func startMetricsServer(ctx context.Context, addr string) (*promObserver, func()) {
+	registry := prometheus.NewRegistry()
+	observer := newPromObserver(registry)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		slog.Info("serving metrics", "addr", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("metrics server failed", "addr", addr, "error", err)
+		}
+	}()
+
+	stopped := make(chan struct{})
+	shutdown := func() {
+		select {
+		case <-stopped:
+			return
+		default:
+			close(stopped)
+		}
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("metrics server shutdown failed", "error", err)
+		}
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			shutdown()
+		case <-stopped:
+		}
+	}()
+
+	return observer, shutdown
+}
@@ -0,0 +1,87 @@
+package scrape
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+
+	"scraper/downloader"
+)
+
+// DownloadPlan describes what a run would do without touching the network or disk
+type DownloadPlan struct {
+	New        []string            // URLs that would be downloaded
+	Existing   []string            // URLs whose file is already present
+	Invalid    []string            // lines rejected by isURL or url.Parse
+	Collisions map[string][]string // relative path -> URLs that would write to it
+}
+
+// buildDownloadPlan classifies URLs against the existing files and detects
+// collisions between the paths they download to, laid out by host when byHost
+// is set and matched by name in subdirectories when recursive is set
+func buildDownloadPlan(urls []string, invalid []string, existingFileMap map[string]string, byHost, recursive bool) DownloadPlan {
+	plan := DownloadPlan{
+		Invalid:    append([]string(nil), invalid...),
+		Collisions: make(map[string][]string),
+	}
+
+	byPath := make(map[string][]string)
+	for _, urlString := range urls {
+		parsedURL, err := url.Parse(urlString)
+		if err != nil {
+			plan.Invalid = append(plan.Invalid, urlString)
+			continue
+		}
+
+		relPath := downloader.RelativePath(parsedURL, byHost)
+		byPath[relPath] = append(byPath[relPath], urlString)
+
+		if _, ok := downloader.ExistingPath(existingFileMap, relPath, recursive); ok {
+			plan.Existing = append(plan.Existing, urlString)
+		} else {
+			plan.New = append(plan.New, urlString)
+		}
+	}
+
+	for relPath, sources := range byPath {
+		if len(sources) > 1 {
+			plan.Collisions[relPath] = sources
+		}
+	}
+
+	return plan
+}
+
+// Print writes a human-readable summary of the plan
+func (p DownloadPlan) Print(w io.Writer, downloadDir string) {
+	fmt.Fprintf(w, "Dry run - no files will be downloaded or written\n")
+	fmt.Fprintf(w, "Download directory: %s\n", downloadDir)
+	fmt.Fprintf(w, "New downloads:      %d\n", len(p.New))
+	fmt.Fprintf(w, "Already present:    %d\n", len(p.Existing))
+	fmt.Fprintf(w, "Invalid URLs:       %d\n", len(p.Invalid))
+	fmt.Fprintf(w, "Name collisions:    %d\n", len(p.Collisions))
+
+	if len(p.Invalid) > 0 {
+		fmt.Fprintf(w, "\nInvalid URLs:\n")
+		for _, line := range p.Invalid {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+	}
+
+	if len(p.Collisions) > 0 {
+		filenames := make([]string, 0, len(p.Collisions))
+		for filename := range p.Collisions {
+			filenames = append(filenames, filename)
+		}
+		sort.Strings(filenames)
+
+		fmt.Fprintf(w, "\nName collisions (these URLs would overwrite each other):\n")
+		for _, filename := range filenames {
+			fmt.Fprintf(w, "  %s\n", filename)
+			for _, source := range p.Collisions[filename] {
+				fmt.Fprintf(w, "    %s\n", source)
+			}
+		}
+	}
+}
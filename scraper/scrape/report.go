@@ -0,0 +1,130 @@
+package scrape
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"time"
+
+	"scraper/downloader"
+)
+
+// slowestDownloadsReported is how many of the slowest downloads the summary lists
+const slowestDownloadsReported = 10
+
+// reportEntry is one download in the -report JSON file
+type reportEntry struct {
+	URL        string  `json:"url"`
+	Success    bool    `json:"success"`
+	Error      string  `json:"error,omitempty"`
+	FilePath   string  `json:"file_path,omitempty"`
+	Retries    int     `json:"retries"`
+	Seconds    float64 `json:"seconds"`
+	Bytes      int64   `json:"bytes"`
+	StatusCode int     `json:"status_code,omitempty"`
+	FinalURL   string  `json:"final_url,omitempty"`
+	SHA256     string  `json:"sha256,omitempty"`
+}
+
+// reportWriter writes the -report JSON array one download at a time, so a
+// run streaming its results never holds them all
+type reportWriter struct {
+	file    *os.File
+	w       *bufio.Writer
+	entries int
+}
+
+func createReport(path string) (*reportWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &reportWriter{file: file, w: bufio.NewWriter(file)}, nil
+}
+
+// add appends the entry for one download result
+func (r *reportWriter) add(result downloader.DownloadResult) error {
+	entry := reportEntry{
+		URL:        result.URL,
+		Success:    result.Success,
+		FilePath:   result.FilePath,
+		Retries:    result.Retries,
+		Seconds:    result.Duration.Seconds(),
+		Bytes:      result.Bytes,
+		StatusCode: result.StatusCode,
+		SHA256:     result.SHA256,
+	}
+	if result.FinalURL != result.URL {
+		entry.FinalURL = result.FinalURL
+	}
+	if result.Error != nil {
+		entry.Error = result.Error.Error()
+	}
+
+	data, err := json.MarshalIndent(entry, "  ", "  ")
+	if err != nil {
+		return err
+	}
+	separator := ",\n  "
+	if r.entries == 0 {
+		separator = "[\n  "
+	}
+	r.entries++
+	if _, err := r.w.WriteString(separator); err != nil {
+		return err
+	}
+	_, err = r.w.Write(data)
+	return err
+}
+
+// close ends the array and closes the file
+func (r *reportWriter) close() error {
+	end := "\n]\n"
+	if r.entries == 0 {
+		end = "[]\n"
+	}
+	_, err := r.w.WriteString(end)
+	if flushErr := r.w.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// slowestDownloads keeps the downloads that took longest, skipping files that
+// were already present
+type slowestDownloads struct {
+	results []downloader.DownloadResult // longest first
+}
+
+func (s *slowestDownloads) add(result downloader.DownloadResult) {
+	if result.StatusCode == 0 {
+		return
+	}
+	i := sort.Search(len(s.results), func(i int) bool { return s.results[i].Duration < result.Duration })
+	if i >= slowestDownloadsReported {
+		return
+	}
+	s.results = slices.Insert(s.results, i, result)
+	if len(s.results) > slowestDownloadsReported {
+		s.results = s.results[:slowestDownloadsReported]
+	}
+}
+
+// log lists the slowest downloads
+func (s *slowestDownloads) log() {
+	for _, result := range s.results {
+		slog.Info("slow download",
+			"url", result.URL,
+			"duration", result.Duration.Round(time.Millisecond),
+			"bytes", result.Bytes,
+			"status", result.StatusCode,
+			"retries", result.Retries,
+		)
+	}
+}
@@ -0,0 +1,78 @@
+package scrape
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"scraper/downloader"
+)
+
+// parseStatusList parses a comma-separated list of HTTP status codes
+func parseStatusList(value string) ([]int, error) {
+	var statuses []int
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		code, err := strconv.Atoi(field)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid HTTP status %q", field)
+		}
+		statuses = append(statuses, code)
+	}
+	return statuses, nil
+}
+
+// applyRetryFlags overrides the retry lists in config from the -retry-statuses,
+// -no-retry-status and -retry-errors flag values. Empty values keep the defaults.
+func applyRetryFlags(config *downloader.RetryConfig, retryStatuses, noRetryStatuses, retryErrors string) error {
+	statuses := downloader.DefaultRetryableStatuses
+	if retryStatuses != "" {
+		parsed, err := parseStatusList(retryStatuses)
+		if err != nil {
+			return fmt.Errorf("-retry-statuses: %v", err)
+		}
+		statuses = parsed
+	}
+
+	if noRetryStatuses != "" {
+		removed, err := parseStatusList(noRetryStatuses)
+		if err != nil {
+			return fmt.Errorf("-no-retry-status: %v", err)
+		}
+		kept := []int{}
+		for _, code := range statuses {
+			keep := true
+			for _, r := range removed {
+				if code == r {
+					keep = false
+					break
+				}
+			}
+			if keep {
+				kept = append(kept, code)
+			}
+		}
+		statuses = kept
+	}
+
+	if retryStatuses != "" || noRetryStatuses != "" {
+		config.RetryableStatuses = statuses
+	}
+
+	if retryErrors != "" {
+		errs := []string{}
+		for _, field := range strings.Split(retryErrors, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				return fmt.Errorf("-retry-errors: empty substring in %q", retryErrors)
+			}
+			errs = append(errs, field)
+		}
+		config.RetryableErrors = errs
+	}
+
+	return nil
+}
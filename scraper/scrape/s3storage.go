@@ -0,0 +1,164 @@
+package scrape
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// s3Storage uploads downloads to an S3 bucket for an -output-dir of the form
+// s3://bucket/prefix. Credentials and region come from the default AWS
+// configuration: environment variables, shared config files or an instance role.
+type s3Storage struct {
+	ctx      context.Context
+	client   *s3.Client
+	uploader *manager.Uploader
+	bucket   string
+	prefix   string // empty or ending in "/"
+}
+
+// newS3Storage returns the storage for location, an s3:// URL. Requests are
+// made with ctx, so cancelling it abandons uploads in progress.
+func newS3Storage(ctx context.Context, location string) (*s3Storage, error) {
+	bucket, prefix, err := parseS3Location(location)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %v", err)
+	}
+	client := s3.NewFromConfig(cfg)
+	return &s3Storage{
+		ctx:      ctx,
+		client:   client,
+		uploader: manager.NewUploader(client),
+		bucket:   bucket,
+		prefix:   prefix,
+	}, nil
+}
+
+// parseS3Location splits s3://bucket/prefix into the bucket and the key
+// prefix, which is empty or ends in a slash
+func parseS3Location(location string) (string, string, error) {
+	parsed, err := url.Parse(location)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid S3 location %q: %v", location, err)
+	}
+	if parsed.Scheme != "s3" || parsed.Host == "" {
+		return "", "", fmt.Errorf("invalid S3 location %q: want s3://bucket/prefix", location)
+	}
+	prefix := strings.Trim(parsed.Path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return parsed.Host, prefix, nil
+}
+
+func (s *s3Storage) key(name string) string {
+	return s.prefix + name
+}
+
+// Create streams what is written to a multipart upload, which completes when
+// the returned writer is closed
+func (s *s3Storage) Create(name string) (io.WriteCloser, error) {
+	reader, writer := io.Pipe()
+	upload := &s3Upload{writer: writer, done: make(chan error, 1)}
+	go func() {
+		_, err := s.uploader.Upload(s.ctx, &s3.PutObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(s.key(name)),
+			Body:   reader,
+		})
+		// Fail further writes if the upload stopped before reading everything
+		reader.CloseWithError(err)
+		upload.done <- err
+	}()
+	return upload, nil
+}
+
+func (s *s3Storage) Exists(name string) bool {
+	_, err := s.client.HeadObject(s.ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(name)),
+	})
+	return err == nil
+}
+
+// List returns the names of the objects under the prefix. If listing fails
+// part way, the names listed so far are returned.
+func (s *s3Storage) List() []string {
+	var names []string
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(s.ctx)
+		if err != nil {
+			slog.Warn("could not list existing S3 objects", "bucket", s.bucket, "prefix", s.prefix, "error", err)
+			break
+		}
+		for _, object := range page.Contents {
+			name := strings.TrimPrefix(aws.ToString(object.Key), s.prefix)
+			if name != "" && !strings.HasSuffix(name, "/") {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+func (s *s3Storage) Remove(name string) error {
+	_, err := s.client.DeleteObject(s.ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(name)),
+	})
+	return err
+}
+
+func (s *s3Storage) Path(name string) string {
+	return "s3://" + s.bucket + "/" + s.key(name)
+}
+
+// s3Upload is the writer returned by s3Storage.Create
+type s3Upload struct {
+	writer *io.PipeWriter
+	done   chan error
+}
+
+func (u *s3Upload) Write(p []byte) (int, error) {
+	return u.writer.Write(p)
+}
+
+// Abort fails the input with err, so the uploader stops without creating
+// the object, aborting a multipart upload, and waits for it to give up
+func (u *s3Upload) Abort(err error) error {
+	if err == nil {
+		err = errUploadAborted
+	}
+	u.writer.CloseWithError(err)
+	<-u.done
+	return nil
+}
+
+// errUploadAborted ends an upload aborted without a more specific error
+var errUploadAborted = errors.New("upload aborted")
+
+// Close ends the input and waits for the upload to complete
+func (u *s3Upload) Close() error {
+	u.writer.Close()
+	if err := <-u.done; err != nil {
+		return fmt.Errorf("S3 upload failed: %v", err)
+	}
+	return nil
+}
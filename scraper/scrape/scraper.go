@@ -0,0 +1,414 @@
+package scrape
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"time"
+
+	"logger"
+	"scraper/downloader"
+)
+
+// loadURLsFromFile reads URLs from a text file (one URL per line).
+// Lines that are not comments but fail the isURL check are returned as invalid.
+// #config lines are returned as per-host directives.
+func loadURLsFromFile(filename string) ([]string, []string, map[string]hostDirective, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer file.Close()
+
+	var urls []string
+	var invalid []string
+	directives := make(map[string]hostDirective)
+	scanner := bufio.NewScanner(file)
+
+	lineNum := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		lineNum++
+		if isConfigDirective(line) {
+			if err := parseConfigDirective(line, directives); err != nil {
+				return nil, nil, nil, fmt.Errorf("line %d: %v", lineNum, err)
+			}
+			continue
+		}
+		// Skip empty lines and comments
+		if line != "" && !strings.HasPrefix(line, "#") {
+			// Fix Unicode escapes and check if it's a URL
+			cleanedURL := fixUnicodeEscapes(line)
+			if isURL(cleanedURL) {
+				urls = append(urls, cleanedURL)
+			} else {
+				invalid = append(invalid, line)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return urls, invalid, directives, nil
+}
+
+// fixUnicodeEscapes converts Unicode escapes to actual characters
+func fixUnicodeEscapes(str string) string {
+	// Replace the most common Unicode escapes in URLs
+	str = strings.ReplaceAll(str, "\\u0026", "&")
+	str = strings.ReplaceAll(str, "\\u003d", "=")
+	str = strings.ReplaceAll(str, "\\u003f", "?")
+	str = strings.ReplaceAll(str, "\\u007e", "~")
+	return str
+}
+
+// isURL checks if a string is a valid URL
+func isURL(str string) bool {
+	return strings.HasPrefix(str, "http://") || strings.HasPrefix(str, "https://")
+}
+
+// maxAutoTuneConcurrency caps -auto-tune when -concurrency is not given
+const maxAutoTuneConcurrency = 32
+
+// Main runs the scraper on the command-line arguments args; name is the
+// program name shown in its usage message
+func Main(name string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	var logConfig logger.Config
+	logConfig.RegisterFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "print the download plan without making network requests or writing files")
+	quiet := fs.Bool("quiet", false, "suppress the terminal progress display")
+	maxFileSize := fs.Int64("max-file-size", 0, "reject downloads larger than this many bytes (0 = unlimited)")
+	metricsAddr := fs.String("metrics-addr", "", "serve Prometheus metrics on this address (e.g. :9090) while downloading")
+	maxBytesPerSec := fs.Int64("max-bytes-per-sec", 0, "cap the total download throughput across all downloads (0 = unlimited)")
+	retryStatuses := fs.String("retry-statuses", "", "comma-separated HTTP statuses to retry, replacing the defaults (429,500,502,503,504)")
+	noRetryStatus := fs.String("no-retry-status", "", "comma-separated HTTP statuses to remove from the retried set")
+	retryErrors := fs.String("retry-errors", "", "comma-separated error substrings to retry, replacing the built-in network error list")
+	jitterMode := fs.String("jitter-mode", string(downloader.JitterProportional), "how retry delays are randomised: proportional (±10% of the exponential delay), none, full (0 to the delay), equal (half fixed, half random) or decorrelated (from the initial delay to 3x the previous one)")
+	firstByteTimeout := fs.Duration("first-byte-timeout", 0, "retry a download whose response sends no body for this long after its headers (0 = wait for the overall timeout)")
+	bufferSize := fs.Int("buffer-size", downloader.DefaultBufferSize, "size in bytes of the buffer each download is copied through; larger buffers can help on fast networks and disks")
+	delay := fs.Duration("delay", downloader.DefaultRequestDelay, "pause before each download starts (0 disables); with N concurrent downloads, at most N requests start per delay")
+	concurrency := fs.Int("concurrency", 0, "maximum concurrent downloads (0 = hardware-based default)")
+	autoTune := fs.Bool("auto-tune", false, "start with low concurrency and adjust it from the rate of 403/429 responses, up to -concurrency")
+	autoTuneFloor := fs.Int("auto-tune-floor", downloader.DefaultAutoTuneConfig.Floor, "lowest concurrency -auto-tune backs off to")
+	autoTuneThreshold := fs.Float64("auto-tune-threshold", downloader.DefaultAutoTuneConfig.Threshold, "share of 403/429 responses in an -auto-tune interval that halves the concurrency")
+	autoTuneInterval := fs.Duration("auto-tune-interval", downloader.DefaultAutoTuneConfig.Interval, "how often -auto-tune recomputes the concurrency; it grows by one per calm interval")
+	clientCert := fs.String("client-cert", "", "PEM client certificate to present for mutual TLS (requires -client-key)")
+	clientKey := fs.String("client-key", "", "PEM private key for -client-cert")
+	caCert := fs.String("ca-cert", "", "PEM CA certificates to trust instead of the system roots")
+	insecure := fs.Bool("insecure", false, "skip TLS certificate verification (unsafe; for testing only)")
+	pinSHA256 := fs.String("pin-sha256", "", "accept only a server certificate with this SHA-256 fingerprint instead of verifying its CA chain")
+	maxRedirects := fs.Int("max-redirects", downloader.DefaultMaxRedirects, "follow at most this many redirects per download; 0 treats any 3xx response as an error")
+	trace := fs.Bool("trace", false, "log DNS, connect, TLS handshake and time-to-first-byte timings, response status and selected headers of every request at debug level")
+	recursiveExisting := fs.Bool("recursive-existing", false, "also skip URLs whose file is already in a subdirectory of downloads, matched by file name")
+	byHost := fs.Bool("by-host", false, "save each file under downloads/<hostname>/ instead of directly in downloads (later stages read the flat layout)")
+	outputDir := fs.String("output-dir", "downloads", "directory to download into, or s3://bucket/prefix to upload to S3 with the default AWS credentials (later stages read local files)")
+	streamResults := fs.Bool("stream-results", false, "handle each download's result as it finishes, in URL order, instead of keeping every result until the run ends; for very long URL lists")
+	hashFiles := fs.Bool("sha256", true, "compute the SHA-256 of each file as it downloads, for the log and -report; -sha256=false saves the CPU")
+	failedOut := fs.String("failed-out", "", "write the URLs that failed to download to this file, in the urls.txt format, to retry just those")
+	reportFile := fs.String("report", "", "write each download's outcome, duration, size and HTTP status to this JSON file")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags] [urls.txt]\n", name)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if err := logger.Init(logConfig); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	if *concurrency < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -concurrency must not be negative\n")
+		os.Exit(2)
+	}
+	if *maxRedirects < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -max-redirects must not be negative\n")
+		os.Exit(2)
+	}
+	if *autoTuneFloor < 1 {
+		fmt.Fprintf(os.Stderr, "Error: -auto-tune-floor must be at least 1\n")
+		os.Exit(2)
+	}
+	if *autoTuneThreshold <= 0 || *autoTuneThreshold > 1 {
+		fmt.Fprintf(os.Stderr, "Error: -auto-tune-threshold must be above 0 and at most 1\n")
+		os.Exit(2)
+	}
+	if *autoTuneInterval <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: -auto-tune-interval must be positive\n")
+		os.Exit(2)
+	}
+	if *firstByteTimeout < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -first-byte-timeout must not be negative\n")
+		os.Exit(2)
+	}
+	if *bufferSize < downloader.MinBufferSize {
+		fmt.Fprintf(os.Stderr, "Error: -buffer-size must be at least %d\n", downloader.MinBufferSize)
+		os.Exit(2)
+	}
+	if *delay < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -delay must not be negative\n")
+		os.Exit(2)
+	}
+
+	if *insecure && *pinSHA256 != "" {
+		fmt.Fprintf(os.Stderr, "Error: -insecure and -pin-sha256 are mutually exclusive\n")
+		os.Exit(2)
+	}
+	tlsConfig, err := downloader.LoadTLSConfig(downloader.TLSOptions{
+		CertFile:  *clientCert,
+		KeyFile:   *clientKey,
+		CAFile:    *caCert,
+		Insecure:  *insecure,
+		PinSHA256: *pinSHA256,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if *insecure {
+		slog.Warn("TLS CERTIFICATE VERIFICATION IS DISABLED: downloads can be intercepted or tampered with")
+	}
+
+	retryConfig := downloader.DefaultRetryConfig
+	if err := applyRetryFlags(&retryConfig, *retryStatuses, *noRetryStatus, *retryErrors); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if retryConfig.JitterMode, err = downloader.ParseJitterMode(*jitterMode); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -jitter-mode: %v\n", err)
+		os.Exit(2)
+	}
+
+	slog.Info("starting URL downloader", "cpu_cores", runtime.NumCPU())
+
+	// Read URLs from file
+	urlFile := "urls.txt" // Fixed path - file is in same directory
+	if fs.NArg() > 0 {
+		urlFile = fs.Arg(0)
+	}
+
+	slog.Info("reading URLs", "file", urlFile)
+	urls, invalidURLs, directives, err := loadURLsFromFile(urlFile)
+	if err != nil {
+		slog.Error("error reading URL file", "file", urlFile, "error", err)
+		fmt.Fprintln(os.Stderr, "Usage: ./scraper [urls.txt]")
+		fmt.Fprintln(os.Stderr, "Create a urls.txt file with one URL per line")
+		os.Exit(1)
+	}
+
+	slog.Info("loaded URLs", "count", len(urls), "invalid", len(invalidURLs))
+	hostConfig := hostConfigs(directives, retryConfig)
+	for host, config := range hostConfig {
+		slog.Info("using host retry settings", "host", host,
+			"max_retries", config.RetryConfig.MaxRetries,
+			"initial_delay", config.RetryConfig.InitialDelay,
+			"max_delay", config.RetryConfig.MaxDelay,
+			"timeout", config.Timeout,
+		)
+	}
+
+	// Cancel outstanding downloads on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	downloadDir := *outputDir
+	var storage downloader.Storage = downloader.LocalStorage{Dir: downloadDir}
+	if strings.HasPrefix(downloadDir, "s3://") {
+		s3, err := newS3Storage(ctx, downloadDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -output-dir: %v\n", err)
+			os.Exit(2)
+		}
+		storage = s3
+	}
+
+	if *dryRun {
+		plan := buildDownloadPlan(urls, invalidURLs, downloader.BuildExistingFileMap(storage, *recursiveExisting || *byHost), *byHost, *recursiveExisting)
+		plan.Print(os.Stdout, downloadDir)
+		return
+	}
+
+	if len(urls) == 0 {
+		slog.Warn("no valid URLs found in the file", "file", urlFile)
+		return
+	}
+
+	// Check existing files
+	existingFiles := downloader.CountExistingFiles(storage, *recursiveExisting || *byHost)
+	slog.Info("found existing files", "dir", downloadDir, "count", existingFiles, "recursive", *recursiveExisting)
+
+	d := downloader.New()
+	d.RetryConfig = retryConfig
+	d.HostConfigs = hostConfig
+	d.RecursiveExisting = *recursiveExisting
+	d.ByHost = *byHost
+	d.Storage = storage
+	if tlsConfig != nil {
+		d.Client = downloader.NewHTTPClientWithTLS(tlsConfig)
+	}
+	d.Client.CheckRedirect = downloader.RedirectPolicy(*maxRedirects)
+	if *trace {
+		d.Client.Transport = newTracingTransport(d.Client.Transport)
+		warnTraceHidden()
+	}
+	d.RequestDelay = *delay
+	d.FirstByteTimeout = *firstByteTimeout
+	d.BufferSize = *bufferSize
+	d.HashFiles = *hashFiles
+	if *concurrency > 0 {
+		d.Concurrency = *concurrency
+	} else if *autoTune {
+		d.Concurrency = maxAutoTuneConcurrency
+	}
+	if *autoTune {
+		d.AutoTune = true
+		d.AutoTuneConfig.Floor = *autoTuneFloor
+		d.AutoTuneConfig.Threshold = *autoTuneThreshold
+		d.AutoTuneConfig.Interval = *autoTuneInterval
+		d.ConcurrencyChanged = func(limit int) {
+			slog.Info("adjusted download concurrency", "concurrency", limit)
+		}
+	}
+	if !*quiet {
+		d.Progress = printProgress
+	}
+	d.MaxFileSize = *maxFileSize
+	if *maxBytesPerSec > 0 {
+		d.Limiter = downloader.NewBandwidthLimiter(*maxBytesPerSec)
+		slog.Info("limiting download bandwidth", "bytes_per_sec", *maxBytesPerSec)
+	}
+	if d.AutoTune {
+		slog.Info("starting download process", "concurrency", d.Concurrency, "auto_tune", true,
+			"auto_tune_floor", d.AutoTuneConfig.Floor,
+			"auto_tune_threshold", d.AutoTuneConfig.Threshold,
+			"auto_tune_interval", d.AutoTuneConfig.Interval,
+		)
+	} else {
+		slog.Info("starting download process", "concurrency", d.Concurrency, "auto_tune", false)
+	}
+
+	if *metricsAddr != "" {
+		observer, shutdown := startMetricsServer(ctx, *metricsAddr)
+		defer shutdown()
+		d.Observer = observer
+	}
+
+	var report *reportWriter
+	if *reportFile != "" {
+		if report, err = createReport(*reportFile); err != nil {
+			slog.Warn("could not write download report", "file", *reportFile, "error", err)
+		}
+	}
+
+	// Results are summarised as they are handled, so that with
+	// -stream-results only the failed ones are kept
+	successCount := 0
+	retriedCount := 0
+	totalRetries := 0
+	var failed []downloader.DownloadResult
+	var slowest slowestDownloads
+	handle := func(result downloader.DownloadResult) {
+		if result.Success {
+			successCount++
+			if result.SHA256 != "" {
+				slog.Info("downloaded file", "url", result.URL, "file", result.FilePath, "bytes", result.Bytes, "sha256", result.SHA256)
+			}
+			if result.Retries > 0 {
+				retriedCount++
+				totalRetries += result.Retries
+			}
+		} else {
+			slog.Error("download failed", "url", result.URL, "final_url", result.FinalURL, "attempts", result.Retries+1, "error", result.Error)
+			failed = append(failed, result)
+		}
+		slowest.add(result)
+		if report != nil {
+			if err := report.add(result); err != nil {
+				slog.Warn("could not write download report", "file", *reportFile, "error", err)
+				report.close()
+				report = nil
+			}
+		}
+	}
+
+	started := time.Now()
+	if *streamResults {
+		var stream <-chan downloader.DownloadResult
+		if stream, err = d.DownloadStream(ctx, urls, downloadDir); err == nil {
+			for result := range stream {
+				handle(result)
+			}
+			err = ctx.Err()
+		}
+	} else {
+		var results []downloader.DownloadResult
+		results, err = d.Download(ctx, urls, downloadDir)
+		for _, result := range results {
+			handle(result)
+		}
+	}
+	if err != nil {
+		slog.Error("download run did not complete", "error", err)
+	}
+
+	// Print summary
+	slog.Info("download summary",
+		"total", len(urls),
+		"successful", successCount,
+		"failed", len(urls)-successCount,
+		"success_rate", fmt.Sprintf("%.1f%%", float64(successCount)/float64(len(urls))*100),
+		"dir", downloadDir,
+	)
+	if retriedCount > 0 {
+		slog.Info("retry summary",
+			"retried_downloads", retriedCount,
+			"retried_rate", fmt.Sprintf("%.1f%%", float64(retriedCount)/float64(len(urls))*100),
+			"avg_retries", fmt.Sprintf("%.1f", float64(totalRetries)/float64(retriedCount)),
+		)
+	}
+	slowest.log()
+
+	if *failedOut != "" {
+		if failedCount, err := writeFailedURLs(*failedOut, failed, len(urls), directives, started); err != nil {
+			slog.Warn("could not write failed URLs", "file", *failedOut, "error", err)
+		} else {
+			slog.Info("wrote failed URLs", "file", *failedOut, "urls", failedCount)
+		}
+	}
+
+	if report != nil {
+		if err := report.close(); err != nil {
+			slog.Warn("could not write download report", "file", *reportFile, "error", err)
+		} else {
+			slog.Info("wrote download report", "file", *reportFile, "downloads", report.entries)
+		}
+	}
+}
+
+// printProgress renders a progress update on stderr
+func printProgress(p downloader.Progress) {
+	percentage := 100.0
+	if p.Total > 0 {
+		percentage = float64(p.Completed) / float64(p.Total) * 100
+	}
+
+	eta := "--"
+	if p.ETA > 0 {
+		eta = p.ETA.Round(time.Second).String()
+	}
+
+	fmt.Fprintf(os.Stderr, "\rProgress: %.1f%% (%d/%d) %.2f MB/s ETA %s   ",
+		percentage, p.Completed, p.Total, p.BytesPerSecond/(1024*1024), eta)
+	if p.Done {
+		fmt.Fprintln(os.Stderr) // New line after final progress
+	}
+}
@@ -0,0 +1,95 @@
+package scrape
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+// tracedHeaders are the response headers logged by -trace. They identify the
+// server or CDN in front of it and explain throttling, without logging cookies.
+var tracedHeaders = []string{
+	"Server",
+	"Via",
+	"Content-Type",
+	"Content-Length",
+	"Location",
+	"Retry-After",
+	"X-Cache",
+	"CF-Ray",
+	"CF-Cache-Status",
+	"X-Amz-Cf-Id",
+	"X-Amz-Request-Id",
+}
+
+// tracingTransport logs the DNS, connect, TLS and first-byte timings of each
+// request and the status and selected headers of its response at debug
+// level. Every redirect hop is a separate request and is traced separately.
+type tracingTransport struct {
+	next http.RoundTripper
+}
+
+func newTracingTransport(next http.RoundTripper) *tracingTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &tracingTransport{next: next}
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	url := req.URL.String()
+	start := time.Now()
+	elapsed := func() time.Duration { return time.Since(start) }
+
+	// Timings are relative to the start of the request, so hooks that run
+	// concurrently (e.g. dialing several addresses) share no state
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			slog.Debug("trace: got connection", "url", url, "reused", info.Reused, "was_idle", info.WasIdle, "elapsed", elapsed())
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			slog.Debug("trace: dns lookup done", "url", url, "host", req.URL.Hostname(), "addrs", len(info.Addrs), "error", info.Err, "elapsed", elapsed())
+		},
+		ConnectDone: func(network, addr string, err error) {
+			slog.Debug("trace: connect done", "url", url, "addr", addr, "error", err, "elapsed", elapsed())
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			slog.Debug("trace: tls handshake done", "url", url,
+				"version", tls.VersionName(state.Version),
+				"cipher", tls.CipherSuiteName(state.CipherSuite),
+				"alpn", state.NegotiatedProtocol,
+				"resumed", state.DidResume,
+				"error", err,
+				"elapsed", elapsed(),
+			)
+		},
+		GotFirstResponseByte: func() {
+			slog.Debug("trace: first response byte", "url", url, "ttfb", elapsed())
+		},
+	}
+
+	resp, err := t.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err != nil {
+		slog.Debug("trace: request failed", "url", url, "error", err, "elapsed", elapsed())
+		return resp, err
+	}
+
+	attrs := []any{"url", url, "status", resp.StatusCode, "proto", resp.Proto, "elapsed", elapsed()}
+	for _, name := range tracedHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			attrs = append(attrs, name, value)
+		}
+	}
+	slog.Debug("trace: response", attrs...)
+	return resp, nil
+}
+
+// warnTraceHidden warns when -trace is set but debug logs are filtered out
+func warnTraceHidden() {
+	if !slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		slog.Warn("-trace logs at debug level; add -log-level debug to see it")
+	}
+}